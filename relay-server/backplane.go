@@ -0,0 +1,744 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ==========================================
+// 多实例背板（Backplane）
+// ==========================================
+//
+// 房间只存在于单个进程的内存中。多个中继实例部署在负载均衡之后时，
+// 同一房间的客户端可能连到不同实例。每个实例把本地客户端发来的消息
+// 发布到背板，同时订阅本实例上存在的房间，收到其他实例发布的消息后
+// 转发给本地客户端。
+
+// Envelope 通过背板在实例间传递的消息
+type Envelope struct {
+	Origin   string // 发布消息的实例 ID
+	Room     string // 房间键（见 roomKey）
+	ClientID string // 发送消息的客户端 ID
+	Type     int    // WebSocket 消息类型
+	Data     []byte // 客户端发来的原始消息
+
+	// Continued 分片条目首帧之后的分片（不编码）：发布队列已满时有限等待，不单独丢弃
+	Continued bool
+}
+
+// encodeEnvelope 编码背板消息：原始消息前加一个短头，房间由频道名确定，不重复写入
+// 格式：类型(1) | 实例 ID 长度(1) | 实例 ID | 客户端 ID 长度(1) | 客户端 ID | 原始消息
+func encodeEnvelope(env Envelope) ([]byte, error) {
+	if len(env.Origin) > 255 || len(env.ClientID) > 255 {
+		return nil, errors.New("背板消息的实例 ID 或客户端 ID 过长")
+	}
+	buf := make([]byte, 0, 3+len(env.Origin)+len(env.ClientID)+len(env.Data))
+	buf = append(buf, byte(env.Type), byte(len(env.Origin)))
+	buf = append(buf, env.Origin...)
+	buf = append(buf, byte(len(env.ClientID)))
+	buf = append(buf, env.ClientID...)
+	return append(buf, env.Data...), nil
+}
+
+// decodeEnvelope 解码背板消息
+func decodeEnvelope(room string, payload []byte) (Envelope, error) {
+	env := Envelope{Room: room}
+	field := func() (string, bool) {
+		if len(payload) < 1 || len(payload) < 1+int(payload[0]) {
+			return "", false
+		}
+		n := int(payload[0])
+		value := string(payload[1 : 1+n])
+		payload = payload[1+n:]
+		return value, true
+	}
+
+	if len(payload) < 1 {
+		return env, errors.New("背板消息过短")
+	}
+	env.Type = int(payload[0])
+	payload = payload[1:]
+	var ok bool
+	if env.Origin, ok = field(); !ok {
+		return env, errors.New("背板消息过短")
+	}
+	if env.ClientID, ok = field(); !ok {
+		return env, errors.New("背板消息过短")
+	}
+	env.Data = payload
+	return env, nil
+}
+
+// EnvelopeHandler 背板消息处理函数
+type EnvelopeHandler func(env Envelope)
+
+// Backplane 实例间消息背板
+type Backplane interface {
+	// Publish 发布消息到房间
+	Publish(env Envelope) error
+	// Subscribe 订阅房间消息，返回取消订阅函数
+	Subscribe(room string, handler EnvelopeHandler) (func(), error)
+	// Close 关闭背板
+	Close() error
+}
+
+// roomKey 背板中的房间键，V1 与 V2 房间相互隔离
+func roomKey(roomID string, isV2 bool) string {
+	if isV2 {
+		return "v2:" + roomID
+	}
+	return "v1:" + roomID
+}
+
+// ==========================================
+// 内存背板
+// ==========================================
+
+// MemoryBackplane 进程内背板，用于在同一进程中运行多个 RelayServer（如测试）
+type MemoryBackplane struct {
+	handlers map[string]map[int]EnvelopeHandler
+	nextID   int
+	mu       sync.RWMutex
+}
+
+// NewMemoryBackplane 创建进程内背板
+func NewMemoryBackplane() *MemoryBackplane {
+	return &MemoryBackplane{
+		handlers: make(map[string]map[int]EnvelopeHandler),
+	}
+}
+
+// Publish 发布消息到房间
+func (b *MemoryBackplane) Publish(env Envelope) error {
+	b.mu.RLock()
+	handlers := make([]EnvelopeHandler, 0, len(b.handlers[env.Room]))
+	for _, handler := range b.handlers[env.Room] {
+		handlers = append(handlers, handler)
+	}
+	b.mu.RUnlock()
+
+	for _, handler := range handlers {
+		handler(env)
+	}
+	return nil
+}
+
+// Subscribe 订阅房间消息
+func (b *MemoryBackplane) Subscribe(room string, handler EnvelopeHandler) (func(), error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.handlers[room] == nil {
+		b.handlers[room] = make(map[int]EnvelopeHandler)
+	}
+	b.nextID++
+	id := b.nextID
+	b.handlers[room][id] = handler
+
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.handlers[room], id)
+		if len(b.handlers[room]) == 0 {
+			delete(b.handlers, room)
+		}
+	}, nil
+}
+
+// Close 关闭背板
+func (b *MemoryBackplane) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers = make(map[string]map[int]EnvelopeHandler)
+	return nil
+}
+
+// ==========================================
+// Redis 背板（RESP 协议，兼容 Redis / KeyDB / Valkey 等）
+// ==========================================
+
+// redisPublishQueueSize 每个实例等待发布的消息数上限
+const redisPublishQueueSize = 1024
+
+// redisPipelineSize 一次写出的 PUBLISH 命令数上限
+const redisPipelineSize = 64
+
+var (
+	// redisPublishWait 队列已满时分片条目的后续分片最多等待的时长
+	redisPublishWait = 5 * time.Second
+	// redisPingInterval 订阅连接的 PING 间隔，两个间隔内收不到任何数据视为连接已断开
+	redisPingInterval = 15 * time.Second
+)
+
+var (
+	errBackplaneClosed  = errors.New("背板已关闭")
+	errPublishQueueFull = errors.New("背板发布队列已满")
+)
+
+// RedisBackplane 基于 Redis PUBLISH/SUBSCRIBE 的背板
+// 使用两条连接：一条用于发布，一条专用于订阅（断线后自动重连并重新订阅）
+// 发布不在调用方协程中进行：消息进入有界队列，由发布协程以 pipeline 批量写出
+type RedisBackplane struct {
+	addr     string
+	password string
+	db       int
+	prefix   string
+
+	publishWait  time.Duration
+	pingInterval time.Duration
+
+	queue   chan Envelope
+	pubConn *redisConn // 仅由发布协程使用，Close 时关闭以中断阻塞的读写
+	pubMu   sync.Mutex
+
+	subConn  *redisConn
+	handlers map[string]map[int]EnvelopeHandler
+	nextID   int
+	subMu    sync.Mutex
+
+	closed chan struct{}
+}
+
+// NewRedisBackplane 创建 Redis 背板
+// rawURL 格式: redis://[:password@]host:port[/db][?prefix=nextpaste]
+func NewRedisBackplane(rawURL string) (*RedisBackplane, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("无效的背板地址: %w", err)
+	}
+	if u.Scheme != "redis" {
+		return nil, fmt.Errorf("不支持的背板协议: %s", u.Scheme)
+	}
+
+	b := &RedisBackplane{
+		addr:         u.Host,
+		prefix:       "nextpaste",
+		publishWait:  redisPublishWait,
+		pingInterval: redisPingInterval,
+		queue:        make(chan Envelope, redisPublishQueueSize),
+		handlers:     make(map[string]map[int]EnvelopeHandler),
+		closed:       make(chan struct{}),
+	}
+	if !strings.Contains(b.addr, ":") {
+		b.addr += ":6379"
+	}
+	if u.User != nil {
+		b.password, _ = u.User.Password()
+	}
+	if db := strings.Trim(u.Path, "/"); db != "" {
+		if b.db, err = strconv.Atoi(db); err != nil {
+			return nil, fmt.Errorf("无效的数据库编号: %s", db)
+		}
+	}
+	if prefix := u.Query().Get("prefix"); prefix != "" {
+		b.prefix = prefix
+	}
+
+	// 启动前先确认 Redis 可达
+	conn, err := b.dial()
+	if err != nil {
+		return nil, err
+	}
+	b.pubConn = conn
+
+	go b.publishLoop()
+	go b.subscribeLoop()
+	return b, nil
+}
+
+// channel 房间对应的 Redis 频道名
+func (b *RedisBackplane) channel(room string) string {
+	return b.prefix + ":" + room
+}
+
+// dial 建立连接并完成认证、选库
+func (b *RedisBackplane) dial() (*redisConn, error) {
+	nc, err := net.DialTimeout("tcp", b.addr, 5*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("连接 Redis 失败: %w", err)
+	}
+	conn := newRedisConn(nc)
+
+	if b.password != "" {
+		if _, err := conn.do("AUTH", b.password); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("Redis 认证失败: %w", err)
+		}
+	}
+	if b.db != 0 {
+		if _, err := conn.do("SELECT", strconv.Itoa(b.db)); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("Redis 选库失败: %w", err)
+		}
+	}
+	return conn, nil
+}
+
+// Publish 把消息放入发布队列，不等待写出；队列已满（Redis 过慢或不可达）时丢弃并返回错误
+// 分片条目的后续分片在队列已满时最多等待 publishWait，避免远端收到缺少中间分片的条目
+func (b *RedisBackplane) Publish(env Envelope) error {
+	select {
+	case <-b.closed:
+		return errBackplaneClosed
+	default:
+	}
+
+	select {
+	case b.queue <- env:
+		return nil
+	default:
+	}
+	if !env.Continued {
+		return errPublishQueueFull
+	}
+
+	timer := time.NewTimer(b.publishWait)
+	defer timer.Stop()
+	select {
+	case b.queue <- env:
+		return nil
+	case <-timer.C:
+		return errPublishQueueFull
+	case <-b.closed:
+		return errBackplaneClosed
+	}
+}
+
+// publishLoop 发布协程：取出队列中已有的消息，一次写出并读取全部回复
+func (b *RedisBackplane) publishLoop() {
+	batch := make([]Envelope, 0, redisPipelineSize)
+	for {
+		batch = batch[:0]
+		select {
+		case <-b.closed:
+			return
+		case env := <-b.queue:
+			batch = append(batch, env)
+		}
+	drain:
+		for len(batch) < redisPipelineSize {
+			select {
+			case env := <-b.queue:
+				batch = append(batch, env)
+			default:
+				break drain
+			}
+		}
+
+		if err := b.publishBatch(batch); err != nil {
+			select {
+			case <-b.closed:
+				return
+			default:
+				slog.Error("发布到背板失败", "messages", len(batch), "error", err)
+			}
+		}
+	}
+}
+
+// publishBatch 以 pipeline 发布一批消息，连接失败时重连一次
+func (b *RedisBackplane) publishBatch(batch []Envelope) error {
+	var buf []byte
+	count := 0
+	for _, env := range batch {
+		payload, err := encodeEnvelope(env)
+		if err != nil {
+			slog.Warn("背板消息编码失败", "room", env.Room, "error", err)
+			continue
+		}
+		buf = appendCommand(buf, []byte("PUBLISH"), []byte(b.channel(env.Room)), payload)
+		count++
+	}
+	if count == 0 {
+		return nil
+	}
+
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		var conn *redisConn
+		if conn, err = b.publishConn(); err != nil {
+			return err
+		}
+		if err = conn.write(buf); err == nil {
+			err = conn.readReplies(count)
+		}
+		var replyErr redisError
+		if err == nil || errors.As(err, &replyErr) {
+			// Redis 已处理全部命令（个别命令出错），重发会造成重复
+			return err
+		}
+		b.dropPublishConn(conn)
+	}
+	return err
+}
+
+// publishConn 获取发布连接，未连接时重新建立
+func (b *RedisBackplane) publishConn() (*redisConn, error) {
+	b.pubMu.Lock()
+	defer b.pubMu.Unlock()
+
+	if b.pubConn != nil {
+		return b.pubConn, nil
+	}
+	select {
+	case <-b.closed:
+		return nil, errBackplaneClosed
+	default:
+	}
+	conn, err := b.dial()
+	if err != nil {
+		return nil, err
+	}
+	b.pubConn = conn
+	return conn, nil
+}
+
+// dropPublishConn 关闭出错的发布连接，下一批消息重新连接
+func (b *RedisBackplane) dropPublishConn(conn *redisConn) {
+	b.pubMu.Lock()
+	defer b.pubMu.Unlock()
+
+	conn.Close()
+	if b.pubConn == conn {
+		b.pubConn = nil
+	}
+}
+
+// Subscribe 订阅房间消息
+func (b *RedisBackplane) Subscribe(room string, handler EnvelopeHandler) (func(), error) {
+	channel := b.channel(room)
+
+	b.subMu.Lock()
+	defer b.subMu.Unlock()
+
+	first := len(b.handlers[channel]) == 0
+	if first {
+		b.handlers[channel] = make(map[int]EnvelopeHandler)
+	}
+	b.nextID++
+	id := b.nextID
+	b.handlers[channel][id] = handler
+
+	if first && b.subConn != nil {
+		if err := b.subConn.send("SUBSCRIBE", channel); err != nil {
+			// 订阅连接会在读取协程中重连，并重新订阅全部频道
+			slog.Warn("订阅背板频道失败", "channel", channel, "error", err)
+		}
+	}
+
+	return func() {
+		b.subMu.Lock()
+		defer b.subMu.Unlock()
+
+		delete(b.handlers[channel], id)
+		if len(b.handlers[channel]) == 0 {
+			delete(b.handlers, channel)
+			if b.subConn != nil {
+				b.subConn.send("UNSUBSCRIBE", channel)
+			}
+		}
+	}, nil
+}
+
+// Close 关闭背板
+func (b *RedisBackplane) Close() error {
+	select {
+	case <-b.closed:
+		return nil
+	default:
+		close(b.closed)
+	}
+
+	b.pubMu.Lock()
+	if b.pubConn != nil {
+		b.pubConn.Close()
+		b.pubConn = nil
+	}
+	b.pubMu.Unlock()
+
+	b.subMu.Lock()
+	if b.subConn != nil {
+		b.subConn.Close()
+		b.subConn = nil
+	}
+	b.subMu.Unlock()
+	return nil
+}
+
+// subscribeLoop 维护订阅连接，断线后自动重连
+func (b *RedisBackplane) subscribeLoop() {
+	backoff := time.Second
+
+	for {
+		select {
+		case <-b.closed:
+			return
+		default:
+		}
+
+		conn, err := b.dial()
+		if err != nil {
+			slog.Warn("背板订阅连接失败，稍后重试", "retryIn", backoff.String(), "error", err)
+			select {
+			case <-time.After(backoff):
+			case <-b.closed:
+				return
+			}
+			if backoff < 30*time.Second {
+				backoff *= 2
+			}
+			continue
+		}
+		backoff = time.Second
+
+		b.subMu.Lock()
+		b.subConn = conn
+		channels := make([]string, 0, len(b.handlers))
+		for channel := range b.handlers {
+			channels = append(channels, channel)
+		}
+		if len(channels) > 0 {
+			conn.send("SUBSCRIBE", channels...)
+		}
+		b.subMu.Unlock()
+
+		done := make(chan struct{})
+		go b.keepalive(conn, done)
+		err = b.readMessages(conn)
+		close(done)
+
+		b.subMu.Lock()
+		if b.subConn == conn {
+			b.subConn = nil
+		}
+		b.subMu.Unlock()
+		conn.Close()
+
+		select {
+		case <-b.closed:
+			return
+		default:
+			slog.Warn("背板订阅连接断开，正在重连", "error", err)
+		}
+	}
+}
+
+// keepalive 定期在订阅连接上发送 PING，直到 done 关闭
+// 半开的连接收不到 PONG，readMessages 读取超时后重连
+func (b *RedisBackplane) keepalive(conn *redisConn, done <-chan struct{}) {
+	ticker := time.NewTicker(b.pingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if err := conn.send("PING"); err != nil {
+				conn.Close()
+				return
+			}
+		}
+	}
+}
+
+// readMessages 读取订阅推送并分发给处理函数，两个 PING 间隔内没有任何数据时返回超时错误
+func (b *RedisBackplane) readMessages(conn *redisConn) error {
+	for {
+		conn.conn.SetReadDeadline(time.Now().Add(2 * b.pingInterval))
+		reply, err := conn.read()
+		if err != nil {
+			return err
+		}
+
+		// 订阅模式下的 PONG 是 ["pong", ""]，只用于刷新读取期限
+		parts, ok := reply.([]interface{})
+		if !ok || len(parts) != 3 {
+			continue
+		}
+		kind, _ := parts[0].(string)
+		if kind != "message" {
+			// subscribe / unsubscribe 确认
+			continue
+		}
+		channel, _ := parts[1].(string)
+		payload, _ := parts[2].(string)
+
+		env, err := decodeEnvelope(strings.TrimPrefix(channel, b.prefix+":"), []byte(payload))
+		if err != nil {
+			slog.Warn("背板消息解析失败", "channel", channel, "error", err)
+			continue
+		}
+
+		b.subMu.Lock()
+		handlers := make([]EnvelopeHandler, 0, len(b.handlers[channel]))
+		for _, handler := range b.handlers[channel] {
+			handlers = append(handlers, handler)
+		}
+		b.subMu.Unlock()
+
+		for _, handler := range handlers {
+			handler(env)
+		}
+	}
+}
+
+// ==========================================
+// 最小 RESP 客户端
+// ==========================================
+
+var errRedisNil = errors.New("redis: nil")
+
+// redisError Redis 返回的错误回复（命令已被处理，连接仍然可用）
+type redisError string
+
+func (e redisError) Error() string {
+	return string(e)
+}
+
+// redisConn Redis 连接
+type redisConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	mu     sync.Mutex // 保护写入
+}
+
+func newRedisConn(conn net.Conn) *redisConn {
+	return &redisConn{
+		conn:   conn,
+		reader: bufio.NewReader(conn),
+	}
+}
+
+// Close 关闭连接
+func (c *redisConn) Close() error {
+	return c.conn.Close()
+}
+
+// do 发送命令并读取一个回复
+func (c *redisConn) do(cmd string, args ...string) (interface{}, error) {
+	if err := c.send(cmd, args...); err != nil {
+		return nil, err
+	}
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	defer c.conn.SetReadDeadline(time.Time{})
+	return c.read()
+}
+
+// readReplies 读取 n 个回复（pipeline），返回第一个错误回复；连接出错时立即返回
+func (c *redisConn) readReplies(n int) error {
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	defer c.conn.SetReadDeadline(time.Time{})
+
+	var first error
+	for i := 0; i < n; i++ {
+		_, err := c.read()
+		var replyErr redisError
+		if errors.As(err, &replyErr) {
+			if first == nil {
+				first = err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return first
+}
+
+// send 发送命令
+func (c *redisConn) send(cmd string, args ...string) error {
+	parts := make([][]byte, 0, len(args)+1)
+	parts = append(parts, []byte(cmd))
+	for _, arg := range args {
+		parts = append(parts, []byte(arg))
+	}
+	return c.write(appendCommand(nil, parts...))
+}
+
+// write 写出已编码的命令
+func (c *redisConn) write(buf []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	_, err := c.conn.Write(buf)
+	return err
+}
+
+// appendCommand 把命令编码为 RESP 数组追加到 buf
+func appendCommand(buf []byte, args ...[]byte) []byte {
+	buf = append(buf, '*')
+	buf = strconv.AppendInt(buf, int64(len(args)), 10)
+	buf = append(buf, "\r\n"...)
+	for _, arg := range args {
+		buf = append(buf, '$')
+		buf = strconv.AppendInt(buf, int64(len(arg)), 10)
+		buf = append(buf, "\r\n"...)
+		buf = append(buf, arg...)
+		buf = append(buf, "\r\n"...)
+	}
+	return buf
+}
+
+// read 读取一个 RESP 值
+func (c *redisConn) read() (interface{}, error) {
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("redis: 空回复")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, errRedisNil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(c.reader, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, errRedisNil
+		}
+		items := make([]interface{}, 0, n)
+		for i := 0; i < n; i++ {
+			item, err := c.read()
+			if err != nil && err != errRedisNil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("redis: 未知的回复类型 %q", line[0])
+	}
+}
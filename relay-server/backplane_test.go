@@ -0,0 +1,710 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"net"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// ==========================================
+// 背板测试
+// ==========================================
+//
+// fakeRedis 是进程内的 RESP 替身，只实现背板用到的命令，用于测试
+// RedisBackplane 的发布、订阅、重连与 RESP 解析，不依赖真实的 Redis。
+
+// fakeRedis 进程内的 RESP 替身：支持 AUTH、SELECT、PING、PUBLISH、SUBSCRIBE、UNSUBSCRIBE
+type fakeRedis struct {
+	t        *testing.T
+	ln       net.Listener
+	password string
+
+	mu        sync.Mutex
+	conns     map[*fakeRedisConn]bool
+	subs      map[string]map[*fakeRedisConn]bool
+	published [][]byte                // 收到的 PUBLISH 内容
+	stall     chan struct{}           // 非空时 PUBLISH 在此阻塞，模拟过慢的 Redis
+	frozen    map[*fakeRedisConn]bool // 不再回复也不再推送的连接，模拟半开连接
+}
+
+// fakeRedisConn fakeRedis 的一条客户端连接
+type fakeRedisConn struct {
+	conn net.Conn
+	mu   sync.Mutex // 保护写入：订阅推送来自其他连接的协程
+}
+
+// reply 写出一个 RESP 回复
+func (c *fakeRedisConn) reply(data string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.conn.Write([]byte(data))
+}
+
+// bulk RESP 批量字符串
+func bulk(s string) string {
+	return "$" + strconv.Itoa(len(s)) + "\r\n" + s + "\r\n"
+}
+
+// newFakeRedis 在回环地址上启动 RESP 替身
+func newFakeRedis(t *testing.T, password string) *fakeRedis {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("监听失败: %v", err)
+	}
+	f := &fakeRedis{
+		t:        t,
+		ln:       ln,
+		password: password,
+		conns:    make(map[*fakeRedisConn]bool),
+		subs:     make(map[string]map[*fakeRedisConn]bool),
+		frozen:   make(map[*fakeRedisConn]bool),
+	}
+	go f.serve()
+	t.Cleanup(func() {
+		ln.Close()
+		f.dropAll()
+	})
+	return f
+}
+
+// url 背板地址
+func (f *fakeRedis) url(password string) string {
+	if password != "" {
+		return "redis://:" + password + "@" + f.ln.Addr().String() + "/1?prefix=test"
+	}
+	return "redis://" + f.ln.Addr().String() + "/1?prefix=test"
+}
+
+// serve 接受连接
+func (f *fakeRedis) serve() {
+	for {
+		nc, err := f.ln.Accept()
+		if err != nil {
+			return
+		}
+		c := &fakeRedisConn{conn: nc}
+		f.mu.Lock()
+		f.conns[c] = true
+		f.mu.Unlock()
+		go f.handle(c)
+	}
+}
+
+// handle 读取并执行一条连接上的命令
+func (f *fakeRedis) handle(c *fakeRedisConn) {
+	defer f.remove(c)
+	reader := &redisConn{conn: c.conn, reader: bufio.NewReader(c.conn)}
+	authed := f.password == ""
+	for {
+		reply, err := reader.read()
+		if err != nil {
+			return
+		}
+		parts, _ := reply.([]interface{})
+		args := make([]string, 0, len(parts))
+		for _, part := range parts {
+			s, _ := part.(string)
+			args = append(args, s)
+		}
+		if len(args) == 0 {
+			c.reply("-ERR empty command\r\n")
+			continue
+		}
+		f.mu.Lock()
+		frozen := f.frozen[c]
+		f.mu.Unlock()
+		if frozen {
+			continue
+		}
+
+		switch strings.ToUpper(args[0]) {
+		case "AUTH":
+			if len(args) == 2 && args[1] == f.password {
+				authed = true
+				c.reply("+OK\r\n")
+			} else {
+				c.reply("-WRONGPASS invalid password\r\n")
+			}
+		case "SELECT":
+			c.reply("+OK\r\n")
+		case "PING":
+			if f.subscribed(c) {
+				c.reply("*2\r\n" + bulk("pong") + bulk(""))
+			} else {
+				c.reply("+PONG\r\n")
+			}
+		case "PUBLISH":
+			if !authed {
+				c.reply("-NOAUTH Authentication required.\r\n")
+				continue
+			}
+			f.mu.Lock()
+			stall := f.stall
+			f.mu.Unlock()
+			if stall != nil {
+				<-stall
+			}
+			c.reply(":" + strconv.Itoa(f.publish(args[1], args[2])) + "\r\n")
+		case "SUBSCRIBE", "UNSUBSCRIBE":
+			kind := strings.ToLower(args[0])
+			for _, channel := range args[1:] {
+				c.reply("*3\r\n" + bulk(kind) + bulk(channel) + ":" + strconv.Itoa(f.subscribe(c, channel, kind == "subscribe")) + "\r\n")
+			}
+		default:
+			c.reply("-ERR unknown command '" + args[0] + "'\r\n")
+		}
+	}
+}
+
+// publish 推送给频道的订阅者，返回订阅者数量
+func (f *fakeRedis) publish(channel, payload string) int {
+	f.mu.Lock()
+	f.published = append(f.published, []byte(payload))
+	subscribers := make([]*fakeRedisConn, 0, len(f.subs[channel]))
+	for c := range f.subs[channel] {
+		if !f.frozen[c] {
+			subscribers = append(subscribers, c)
+		}
+	}
+	f.mu.Unlock()
+
+	for _, c := range subscribers {
+		c.reply("*3\r\n" + bulk("message") + bulk(channel) + bulk(payload))
+	}
+	return len(subscribers)
+}
+
+// subscribe 订阅或取消订阅频道，返回该连接订阅的频道数
+func (f *fakeRedis) subscribe(c *fakeRedisConn, channel string, on bool) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if on {
+		if f.subs[channel] == nil {
+			f.subs[channel] = make(map[*fakeRedisConn]bool)
+		}
+		f.subs[channel][c] = true
+	} else {
+		delete(f.subs[channel], c)
+	}
+	count := 0
+	for _, subscribers := range f.subs {
+		if subscribers[c] {
+			count++
+		}
+	}
+	return count
+}
+
+// subscribed 连接是否处于订阅模式
+func (f *fakeRedis) subscribed(c *fakeRedisConn) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, subscribers := range f.subs {
+		if subscribers[c] {
+			return true
+		}
+	}
+	return false
+}
+
+// freezeSubscribers 让当前的订阅连接不再回复也不再收到推送，但不关闭，模拟网络中断后的半开连接
+func (f *fakeRedis) freezeSubscribers() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, subscribers := range f.subs {
+		for c := range subscribers {
+			f.frozen[c] = true
+		}
+	}
+}
+
+// remove 连接断开
+func (f *fakeRedis) remove(c *fakeRedisConn) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.conns, c)
+	delete(f.frozen, c)
+	for _, subscribers := range f.subs {
+		delete(subscribers, c)
+	}
+	c.conn.Close()
+}
+
+// dropAll 断开所有连接，模拟 Redis 重启
+func (f *fakeRedis) dropAll() {
+	f.mu.Lock()
+	conns := make([]*fakeRedisConn, 0, len(f.conns))
+	for c := range f.conns {
+		conns = append(conns, c)
+	}
+	f.mu.Unlock()
+	for _, c := range conns {
+		c.conn.Close()
+	}
+}
+
+// subscribers 频道的订阅连接数（不含半开连接）
+func (f *fakeRedis) subscribers(channel string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	count := 0
+	for c := range f.subs[channel] {
+		if !f.frozen[c] {
+			count++
+		}
+	}
+	return count
+}
+
+// lastPublished 最近一次 PUBLISH 的内容
+func (f *fakeRedis) lastPublished() []byte {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.published) == 0 {
+		return nil
+	}
+	return f.published[len(f.published)-1]
+}
+
+// newTestRedisBackplane 连接到 RESP 替身的背板，测试结束时关闭
+func newTestRedisBackplane(t *testing.T, f *fakeRedis) *RedisBackplane {
+	t.Helper()
+	b, err := NewRedisBackplane(f.url(f.password))
+	if err != nil {
+		t.Fatalf("NewRedisBackplane: %v", err)
+	}
+	t.Cleanup(func() { b.Close() })
+	return b
+}
+
+// collect 订阅房间，收到的消息写入通道
+func collect(t *testing.T, b Backplane, room string) <-chan Envelope {
+	t.Helper()
+	ch := make(chan Envelope, 64)
+	unsubscribe, err := b.Subscribe(room, func(env Envelope) { ch <- env })
+	if err != nil {
+		t.Fatalf("订阅 %s 失败: %v", room, err)
+	}
+	t.Cleanup(unsubscribe)
+	return ch
+}
+
+// receive 等待一条背板消息
+func receive(t *testing.T, ch <-chan Envelope) Envelope {
+	t.Helper()
+	select {
+	case env := <-ch:
+		return env
+	case <-time.After(timeout):
+		t.Fatalf("等待背板消息超时")
+	}
+	return Envelope{}
+}
+
+func TestEnvelopeRoundTrip(t *testing.T) {
+	env := Envelope{
+		Origin:   "instance-1",
+		Room:     "v2:room",
+		ClientID: "client-1",
+		Type:     websocket.BinaryMessage,
+		Data:     []byte("\x00\r\n原始帧\xff"),
+	}
+	payload, err := encodeEnvelope(env)
+	if err != nil {
+		t.Fatalf("encodeEnvelope: %v", err)
+	}
+	if !bytes.HasSuffix(payload, env.Data) || len(payload) != 3+len(env.Origin)+len(env.ClientID)+len(env.Data) {
+		t.Fatalf("编码结果 %q 应为短头加原始消息", payload)
+	}
+	got, err := decodeEnvelope("v2:room", payload)
+	if err != nil {
+		t.Fatalf("decodeEnvelope: %v", err)
+	}
+	if got.Origin != env.Origin || got.Room != env.Room || got.ClientID != env.ClientID || got.Type != env.Type || !bytes.Equal(got.Data, env.Data) {
+		t.Fatalf("解码结果 = %+v，期望 %+v", got, env)
+	}
+
+	for _, payload := range [][]byte{nil, {2}, {2, 5, 'a'}, {2, 1, 'a', 3, 'b'}} {
+		if _, err := decodeEnvelope("v2:room", payload); err == nil {
+			t.Errorf("decodeEnvelope(%q) 应返回错误", payload)
+		}
+	}
+	if _, err := encodeEnvelope(Envelope{Origin: strings.Repeat("x", 256)}); err == nil {
+		t.Errorf("过长的实例 ID 应返回错误")
+	}
+}
+
+func TestRedisConnRead(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  interface{}
+		err   error
+	}{
+		{"simple string", "+OK\r\n", "OK", nil},
+		{"integer", ":42\r\n", int64(42), nil},
+		{"bulk string", "$5\r\na\r\nbc\r\n", "a\r\nbc", nil},
+		{"empty bulk string", "$0\r\n\r\n", "", nil},
+		{"null bulk string", "$-1\r\n", nil, errRedisNil},
+		{"null array", "*-1\r\n", nil, errRedisNil},
+		{"array", "*3\r\n$7\r\nmessage\r\n$4\r\nroom\r\n:1\r\n", []interface{}{"message", "room", int64(1)}, nil},
+		{"array with null", "*2\r\n$-1\r\n+OK\r\n", []interface{}{nil, "OK"}, nil},
+		{"nested array", "*1\r\n*1\r\n:7\r\n", []interface{}{[]interface{}{int64(7)}}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &redisConn{reader: bufio.NewReader(strings.NewReader(tt.input))}
+			got, err := c.read()
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v，期望 %v", err, tt.err)
+			}
+			if !equalReply(got, tt.want) {
+				t.Fatalf("read() = %#v，期望 %#v", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("error reply", func(t *testing.T) {
+		c := &redisConn{reader: bufio.NewReader(strings.NewReader("-ERR unknown command\r\n"))}
+		_, err := c.read()
+		var replyErr redisError
+		if !errors.As(err, &replyErr) || err.Error() != "ERR unknown command" {
+			t.Fatalf("err = %v，期望 Redis 错误回复", err)
+		}
+	})
+	for _, input := range []string{"", "\r\n", "?x\r\n", "$5\r\nab\r\n", ":abc\r\n", "*2\r\n+OK\r\n"} {
+		c := &redisConn{reader: bufio.NewReader(strings.NewReader(input))}
+		if _, err := c.read(); err == nil {
+			t.Errorf("read(%q) 应返回错误", input)
+		}
+	}
+}
+
+// equalReply 比较 RESP 回复
+func equalReply(a, b interface{}) bool {
+	as, aok := a.([]interface{})
+	bs, bok := b.([]interface{})
+	if aok != bok {
+		return false
+	}
+	if !aok {
+		return a == b
+	}
+	if len(as) != len(bs) {
+		return false
+	}
+	for i := range as {
+		if !equalReply(as[i], bs[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestAppendCommand(t *testing.T) {
+	got := appendCommand(nil, []byte("PUBLISH"), []byte("test:v2:room"), []byte("a\r\nb"))
+	want := "*3\r\n$7\r\nPUBLISH\r\n$12\r\ntest:v2:room\r\n$4\r\na\r\nb\r\n"
+	if string(got) != want {
+		t.Fatalf("appendCommand = %q，期望 %q", got, want)
+	}
+}
+
+func TestRedisBackplanePublishesRawFrames(t *testing.T) {
+	f := newFakeRedis(t, "secret")
+	pub := newTestRedisBackplane(t, f)
+	sub := newTestRedisBackplane(t, f)
+	received := collect(t, sub, "v2:room")
+	eventually(t, func() bool { return f.subscribers("test:v2:room") == 1 }, "等待订阅生效")
+
+	frame := testFrame(frameTypeText, 0, 1, 0, [16]byte{1}, []byte("经背板转发\r\n的文本"))
+	env := Envelope{Origin: "instance-a", Room: "v2:room", ClientID: "client-a", Type: websocket.BinaryMessage, Data: frame}
+	if err := pub.Publish(env); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+
+	got := receive(t, received)
+	if got.Origin != env.Origin || got.Room != env.Room || got.ClientID != env.ClientID || got.Type != env.Type || !bytes.Equal(got.Data, frame) {
+		t.Fatalf("收到 %+v，期望 %+v", got, env)
+	}
+	// 频道中的内容是原始帧加短头，没有 JSON/Base64 转换
+	if payload := f.lastPublished(); !bytes.HasSuffix(payload, frame) {
+		t.Fatalf("PUBLISH 内容 %q 不以原始帧结尾", abbrev(payload))
+	}
+}
+
+func TestRedisBackplanePreservesOrderInPipeline(t *testing.T) {
+	f := newFakeRedis(t, "")
+	pub := newTestRedisBackplane(t, f)
+	sub := newTestRedisBackplane(t, f)
+	received := collect(t, sub, "v2:room")
+	eventually(t, func() bool { return f.subscribers("test:v2:room") == 1 }, "等待订阅生效")
+
+	const count = 500
+	for i := 0; i < count; i++ {
+		env := Envelope{Origin: "a", Room: "v2:room", ClientID: "c", Type: websocket.BinaryMessage, Data: []byte(strconv.Itoa(i))}
+		if err := pub.Publish(env); err != nil {
+			t.Fatalf("第 %d 条 Publish: %v", i, err)
+		}
+	}
+	for i := 0; i < count; i++ {
+		if got := receive(t, received); string(got.Data) != strconv.Itoa(i) {
+			t.Fatalf("第 %d 条消息内容为 %q，顺序被打乱", i, got.Data)
+		}
+	}
+}
+
+func TestRedisBackplanePublishDoesNotBlock(t *testing.T) {
+	f := newFakeRedis(t, "")
+	pub := newTestRedisBackplane(t, f)
+
+	// Redis 不再回复 PUBLISH：队列写满后 Publish 立即返回错误，而不是阻塞调用方
+	stall := make(chan struct{})
+	f.mu.Lock()
+	f.stall = stall
+	f.mu.Unlock()
+	t.Cleanup(func() { close(stall) })
+
+	start := time.Now()
+	var full error
+	for i := 0; i < redisPublishQueueSize+2*redisPipelineSize+1; i++ {
+		if err := pub.Publish(Envelope{Origin: "a", Room: "v2:room", Type: websocket.BinaryMessage, Data: []byte("x")}); err != nil {
+			full = err
+			break
+		}
+	}
+	if !errors.Is(full, errPublishQueueFull) {
+		t.Fatalf("err = %v，期望队列已满", full)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("Publish 耗时 %v，不应等待 Redis", elapsed)
+	}
+}
+
+func TestRedisBackplaneContinuedFramesWait(t *testing.T) {
+	defer func(wait time.Duration) { redisPublishWait = wait }(redisPublishWait)
+	redisPublishWait = 300 * time.Millisecond
+	f := newFakeRedis(t, "")
+	pub := newTestRedisBackplane(t, f)
+
+	stall := make(chan struct{})
+	f.mu.Lock()
+	f.stall = stall
+	f.mu.Unlock()
+	// 发布协程取走第一批消息后阻塞，之后队列保持写满
+	for i := 0; ; i++ {
+		if i > redisPublishQueueSize+2*redisPipelineSize {
+			t.Fatalf("队列一直未满")
+		}
+		if err := pub.Publish(Envelope{Origin: "a", Room: "v2:room", Type: websocket.BinaryMessage, Data: []byte("x")}); err != nil {
+			time.Sleep(50 * time.Millisecond)
+			if len(pub.queue) == cap(pub.queue) {
+				break
+			}
+		}
+	}
+
+	// 后续分片在队列已满时等待，超过期限才放弃
+	continued := Envelope{Origin: "a", Room: "v2:room", Type: websocket.BinaryMessage, Data: []byte("y"), Continued: true}
+	start := time.Now()
+	if err := pub.Publish(continued); !errors.Is(err, errPublishQueueFull) {
+		t.Fatalf("err = %v，期望等待后队列仍满", err)
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Fatalf("后续分片只等待了 %v", elapsed)
+	}
+
+	// 等待期间 Redis 恢复，后续分片进入队列
+	result := make(chan error, 1)
+	go func() { result <- pub.Publish(continued) }()
+	time.Sleep(50 * time.Millisecond)
+	close(stall)
+	select {
+	case err := <-result:
+		if err != nil {
+			t.Fatalf("Redis 恢复后 Publish: %v", err)
+		}
+	case <-time.After(timeout):
+		t.Fatalf("Publish 未返回")
+	}
+}
+
+func TestRedisBackplaneResubscribesAfterSilentDrop(t *testing.T) {
+	defer func(interval time.Duration) { redisPingInterval = interval }(redisPingInterval)
+	redisPingInterval = 50 * time.Millisecond
+	f := newFakeRedis(t, "")
+	pub := newTestRedisBackplane(t, f)
+	sub := newTestRedisBackplane(t, f)
+	received := collect(t, sub, "v2:room")
+	eventually(t, func() bool { return f.subscribers("test:v2:room") == 1 }, "等待订阅生效")
+
+	// 订阅连接没有断开但不再有数据：PING 得不到回复，读取超时后重连并重新订阅
+	f.freezeSubscribers()
+	eventually(t, func() bool { return f.subscribers("test:v2:room") == 1 }, "等待重新订阅")
+
+	env := Envelope{Origin: "a", Room: "v2:room", ClientID: "c", Type: websocket.BinaryMessage, Data: []byte("半开连接之后")}
+	if err := pub.Publish(env); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	if got := receive(t, received); !bytes.Equal(got.Data, env.Data) {
+		t.Fatalf("收到 %q，期望 %q", got.Data, env.Data)
+	}
+}
+
+// flakyBackplane 记录发布的消息，fail 返回 true 的消息发布失败
+type flakyBackplane struct {
+	*MemoryBackplane
+	fail func(env Envelope) bool
+
+	mu        sync.Mutex
+	attempts  []Envelope
+	published []Envelope
+}
+
+func (b *flakyBackplane) Publish(env Envelope) error {
+	b.mu.Lock()
+	b.attempts = append(b.attempts, env)
+	failed := b.fail(env)
+	if !failed {
+		b.published = append(b.published, env)
+	}
+	b.mu.Unlock()
+	if failed {
+		return errPublishQueueFull
+	}
+	return b.MemoryBackplane.Publish(env)
+}
+
+func TestRelaySkipsRestOfItemAfterPublishFailure(t *testing.T) {
+	bp := &flakyBackplane{MemoryBackplane: NewMemoryBackplane()}
+	bp.fail = func(env Envelope) bool {
+		header, _ := parseFrameHeader(env.Data)
+		return (header.MsgID == 1 && header.Seq == 0) || (header.MsgID == 2 && header.Seq == 1)
+	}
+	server := NewRelayServer(nil)
+	server.SetBackplane(bp)
+	ts := httptest.NewServer(newMux(server))
+	t.Cleanup(ts.Close)
+
+	alice := dial(t, ts, "/v2/ws/room", [16]byte{})
+	for _, msgID := range []uint32{1, 2} {
+		for seq := uint32(0); seq < 3; seq++ {
+			flags := frameFlagMF
+			if seq == 2 {
+				flags = 0
+			}
+			alice.send(websocket.BinaryMessage, testFrame(frameTypeFile, flags, msgID, seq, alice.sender, []byte("分片")))
+		}
+	}
+	alice.send(websocket.BinaryMessage, testFrame(frameTypeText, 0, 3, 0, alice.sender, []byte("下一个条目")))
+	eventually(t, func() bool {
+		bp.mu.Lock()
+		defer bp.mu.Unlock()
+		return len(bp.published) > 0 && bytes.HasSuffix(bp.published[len(bp.published)-1].Data, []byte("下一个条目"))
+	}, "等待下一个条目发布")
+
+	// 条目 1 的首帧失败后不再发布其余分片；条目 2 的第二个分片失败后不再发布尾帧
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+	var got []string
+	for _, env := range bp.attempts {
+		header, _ := parseFrameHeader(env.Data)
+		got = append(got, strconv.Itoa(int(header.MsgID))+"/"+strconv.Itoa(int(header.Seq))+"/"+strconv.FormatBool(env.Continued))
+	}
+	if want := "1/0/false,2/0/false,2/1/true,3/0/false"; strings.Join(got, ",") != want {
+		t.Fatalf("发布的分片 = %v，期望 %s", got, want)
+	}
+}
+
+func TestRedisBackplaneReconnects(t *testing.T) {
+	f := newFakeRedis(t, "secret")
+	pub := newTestRedisBackplane(t, f)
+	sub := newTestRedisBackplane(t, f)
+	received := collect(t, sub, "v2:room")
+	eventually(t, func() bool { return f.subscribers("test:v2:room") == 1 }, "等待订阅生效")
+
+	// Redis 重启：订阅连接重连后重新订阅，发布连接在下一次发布时重连
+	f.dropAll()
+	eventually(t, func() bool { return f.subscribers("test:v2:room") == 1 }, "等待重新订阅")
+
+	env := Envelope{Origin: "a", Room: "v2:room", ClientID: "c", Type: websocket.BinaryMessage, Data: []byte("重连之后")}
+	if err := pub.Publish(env); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	if got := receive(t, received); !bytes.Equal(got.Data, env.Data) {
+		t.Fatalf("收到 %q，期望 %q", got.Data, env.Data)
+	}
+}
+
+func TestRedisBackplaneRejectsWrongPassword(t *testing.T) {
+	f := newFakeRedis(t, "secret")
+	if _, err := NewRedisBackplane(f.url("wrong")); err == nil || !strings.Contains(err.Error(), "认证失败") {
+		t.Fatalf("err = %v，期望认证失败", err)
+	}
+}
+
+func TestRelaysShareRoomsOverBackplane(t *testing.T) {
+	backplanes := []struct {
+		name string
+		new  func(t *testing.T) (bp func() Backplane, subscribed func(room string) int)
+	}{
+		{"memory", func(t *testing.T) (func() Backplane, func(string) int) {
+			bp := NewMemoryBackplane()
+			return func() Backplane { return bp }, func(room string) int {
+				bp.mu.RLock()
+				defer bp.mu.RUnlock()
+				return len(bp.handlers[room])
+			}
+		}},
+		{"redis", func(t *testing.T) (func() Backplane, func(string) int) {
+			f := newFakeRedis(t, "")
+			return func() Backplane { return newTestRedisBackplane(t, f) }, func(room string) int {
+				return f.subscribers("test:" + room)
+			}
+		}},
+	}
+	for _, tt := range backplanes {
+		t.Run(tt.name, func(t *testing.T) {
+			newBackplane, subscribed := tt.new(t)
+			relay := func() *httptest.Server {
+				server := NewRelayServer(nil)
+				server.SetBackplane(newBackplane())
+				ts := httptest.NewServer(newMux(server))
+				t.Cleanup(ts.Close)
+				return ts
+			}
+			a, b := relay(), relay()
+
+			alice := dial(t, a, "/v2/ws/room", [16]byte{})
+			bob := dial(t, b, "/v2/ws/room", [16]byte{})
+			other := dial(t, b, "/v2/ws/other", [16]byte{})
+			v1 := dial(t, a, "/ws/room", [16]byte{})
+			eventually(t, func() bool { return subscribed("v2:room") == 2 }, "等待两个实例订阅房间")
+
+			// 连到不同实例的同一房间互相可见，不回发给发送者，也不串到其他房间
+			frame := testFrame(frameTypeText, 0, 1, 0, alice.sender, []byte("来自实例 A"))
+			alice.send(websocket.BinaryMessage, frame)
+			bob.expect(websocket.BinaryMessage, frame)
+			reply := testFrame(frameTypeText, 0, 1, 0, bob.sender, []byte("来自实例 B"))
+			bob.send(websocket.BinaryMessage, reply)
+			alice.expect(websocket.BinaryMessage, reply)
+			alice.expectNone(200 * time.Millisecond)
+			bob.expectNone(0)
+			other.expectNone(0)
+			v1.expectNone(0)
+
+			// 房间在实例上清空后取消订阅
+			bob.leave()
+			eventually(t, func() bool { return subscribed("v2:room") == 1 }, "等待实例 B 取消订阅")
+		})
+	}
+}
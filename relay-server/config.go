@@ -0,0 +1,397 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ==========================================
+// 配置
+// ==========================================
+//
+// 优先级（从低到高）：默认值 < 配置文件 < 环境变量 < 命令行参数
+// 收到 SIGHUP 时重新加载配置文件和环境变量；监听地址、TLS、信箱模式与背板
+// 需要重启才能生效，其余配置立即生效。
+
+// Config 中继服务器配置
+type Config struct {
+	Listen         []string        `yaml:"listen"`          // 监听地址，如 0.0.0.0:8080
+	TLS            TLSConfig       `yaml:"tls"`             // TLS 证书
+	Limits         LimitsConfig    `yaml:"limits"`          // 资源限制
+	Auth           AuthConfig      `yaml:"auth"`            // 连接鉴权
+	AllowedOrigins []string        `yaml:"allowed_origins"` // 允许的浏览器 Origin
+	TrustedProxies []string        `yaml:"trusted_proxies"` // 可信反向代理（IP 或 CIDR），用于解析 X-Forwarded-For
+	Log            LogConfig       `yaml:"log"`             // 日志
+	Mailbox        MailboxSettings `yaml:"mailbox"`         // 离线信箱
+	Backplane      string          `yaml:"backplane"`       // 多实例背板地址
+	Shutdown       ShutdownConfig  `yaml:"shutdown"`        // 优雅关闭
+
+	trustedNets []*net.IPNet // 解析后的可信代理
+}
+
+// TLSConfig TLS 证书配置，同时设置时启用 wss
+type TLSConfig struct {
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+}
+
+// LimitsConfig 资源限制，0 表示不限制
+type LimitsConfig struct {
+	MaxRooms          int   `yaml:"max_rooms"`            // 最大房间数（V1 + V2）
+	MaxClientsPerRoom int   `yaml:"max_clients_per_room"` // 单个房间最大客户端数
+	MaxMessageSize    int64 `yaml:"max_message_size"`     // 单条 WebSocket 消息最大字节数
+}
+
+// AuthConfig 连接鉴权，Tokens 为空时不鉴权
+// 客户端通过 "Authorization: Bearer <token>" 头或 "?token=<token>" 参数携带令牌
+type AuthConfig struct {
+	Tokens []string `yaml:"tokens"`
+}
+
+// LogConfig 日志配置
+type LogConfig struct {
+	Level  string `yaml:"level"`  // debug | info | warn | error
+	Format string `yaml:"format"` // json | text
+}
+
+// MailboxSettings 离线信箱配置
+type MailboxSettings struct {
+	Mode     string        `yaml:"mode"` // off | memory | disk
+	Dir      string        `yaml:"dir"`
+	MaxItems int           `yaml:"max_items"`
+	MaxBytes int64         `yaml:"max_bytes"`
+	TTL      time.Duration `yaml:"ttl"`
+}
+
+// ShutdownConfig 优雅关闭配置
+type ShutdownConfig struct {
+	DrainTimeout   time.Duration `yaml:"drain_timeout"`
+	ReconnectAfter time.Duration `yaml:"reconnect_after"`
+}
+
+// DefaultConfig 默认配置
+func DefaultConfig() *Config {
+	return &Config{
+		Listen: []string{"0.0.0.0:8080"},
+		Limits: LimitsConfig{
+			MaxMessageSize: 64 * 1024 * 1024,
+		},
+		Log: LogConfig{
+			Level:  "info",
+			Format: "json",
+		},
+		Mailbox: MailboxSettings{
+			Mode:     "off",
+			Dir:      "mailbox",
+			MaxItems: 20,
+			MaxBytes: 32 * 1024 * 1024,
+			TTL:      24 * time.Hour,
+		},
+		Shutdown: ShutdownConfig{
+			DrainTimeout:   30 * time.Second,
+			ReconnectAfter: 5 * time.Second,
+		},
+	}
+}
+
+// LoadConfig 依次加载默认值、配置文件（path 为空时跳过）和环境变量
+func LoadConfig(path string) (*Config, error) {
+	cfg := DefaultConfig()
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("读取配置文件失败: %w", err)
+		}
+		if err := yaml.Unmarshal(data, cfg); err != nil {
+			return nil, fmt.Errorf("解析配置文件失败: %w", err)
+		}
+	}
+
+	if err := cfg.applyEnv(os.LookupEnv); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// envPrefix 环境变量前缀
+const envPrefix = "NEXTPASTE_RELAY_"
+
+// applyEnv 应用环境变量覆盖
+func (c *Config) applyEnv(lookup func(string) (string, bool)) error {
+	list := func(v string) []string {
+		var items []string
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		return items
+	}
+
+	overrides := []struct {
+		name  string
+		apply func(v string) error
+	}{
+		{"LISTEN", func(v string) error { c.Listen = list(v); return nil }},
+		{"TLS_CERT_FILE", func(v string) error { c.TLS.CertFile = v; return nil }},
+		{"TLS_KEY_FILE", func(v string) error { c.TLS.KeyFile = v; return nil }},
+		{"MAX_ROOMS", intSetter(&c.Limits.MaxRooms)},
+		{"MAX_CLIENTS_PER_ROOM", intSetter(&c.Limits.MaxClientsPerRoom)},
+		{"MAX_MESSAGE_SIZE", int64Setter(&c.Limits.MaxMessageSize)},
+		{"AUTH_TOKENS", func(v string) error { c.Auth.Tokens = list(v); return nil }},
+		{"ALLOWED_ORIGINS", func(v string) error { c.AllowedOrigins = list(v); return nil }},
+		{"TRUSTED_PROXIES", func(v string) error { c.TrustedProxies = list(v); return nil }},
+		{"LOG_LEVEL", func(v string) error { c.Log.Level = v; return nil }},
+		{"LOG_FORMAT", func(v string) error { c.Log.Format = v; return nil }},
+		{"MAILBOX", func(v string) error { c.Mailbox.Mode = v; return nil }},
+		{"MAILBOX_DIR", func(v string) error { c.Mailbox.Dir = v; return nil }},
+		{"MAILBOX_MAX_ITEMS", intSetter(&c.Mailbox.MaxItems)},
+		{"MAILBOX_MAX_BYTES", int64Setter(&c.Mailbox.MaxBytes)},
+		{"MAILBOX_TTL", durationSetter(&c.Mailbox.TTL)},
+		{"BACKPLANE", func(v string) error { c.Backplane = v; return nil }},
+		{"DRAIN_TIMEOUT", durationSetter(&c.Shutdown.DrainTimeout)},
+		{"RECONNECT_AFTER", durationSetter(&c.Shutdown.ReconnectAfter)},
+	}
+
+	for _, o := range overrides {
+		v, ok := lookup(envPrefix + o.name)
+		if !ok {
+			continue
+		}
+		if err := o.apply(v); err != nil {
+			return fmt.Errorf("环境变量 %s%s 无效: %w", envPrefix, o.name, err)
+		}
+	}
+	return nil
+}
+
+func intSetter(dst *int) func(string) error {
+	return func(v string) error {
+		n, err := strconv.Atoi(v)
+		if err == nil {
+			*dst = n
+		}
+		return err
+	}
+}
+
+func int64Setter(dst *int64) func(string) error {
+	return func(v string) error {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err == nil {
+			*dst = n
+		}
+		return err
+	}
+}
+
+func durationSetter(dst *time.Duration) func(string) error {
+	return func(v string) error {
+		d, err := time.ParseDuration(v)
+		if err == nil {
+			*dst = d
+		}
+		return err
+	}
+}
+
+// Validate 校验配置并预处理可信代理列表
+func (c *Config) Validate() error {
+	if len(c.Listen) == 0 {
+		return fmt.Errorf("至少需要一个监听地址")
+	}
+	for _, addr := range c.Listen {
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			return fmt.Errorf("无效的监听地址 %q: %w", addr, err)
+		}
+	}
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		return fmt.Errorf("tls.cert_file 与 tls.key_file 需要同时设置")
+	}
+	if _, err := parseLogLevel(c.Log.Level); err != nil {
+		return err
+	}
+	if c.Log.Format != "json" && c.Log.Format != "text" {
+		return fmt.Errorf("未知的日志格式: %s", c.Log.Format)
+	}
+	switch c.Mailbox.Mode {
+	case "", "off", "memory", "disk":
+	default:
+		return fmt.Errorf("未知的信箱模式: %s", c.Mailbox.Mode)
+	}
+
+	c.trustedNets = c.trustedNets[:0]
+	for _, proxy := range c.TrustedProxies {
+		if !strings.Contains(proxy, "/") {
+			if strings.Contains(proxy, ":") {
+				proxy += "/128"
+			} else {
+				proxy += "/32"
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return fmt.Errorf("无效的可信代理 %q: %w", proxy, err)
+		}
+		c.trustedNets = append(c.trustedNets, ipNet)
+	}
+	return nil
+}
+
+// TLSEnabled 是否启用 TLS
+func (c *Config) TLSEnabled() bool {
+	return c.TLS.CertFile != "" && c.TLS.KeyFile != ""
+}
+
+// parseLogLevel 解析日志级别
+func parseLogLevel(level string) (slog.Level, error) {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return l, fmt.Errorf("未知的日志级别: %s", level)
+	}
+	return l, nil
+}
+
+// authorized 检查请求是否携带有效令牌
+func (c *Config) authorized(r *http.Request) bool {
+	if len(c.Auth.Tokens) == 0 {
+		return true
+	}
+
+	token := r.URL.Query().Get("token")
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		token = strings.TrimPrefix(auth, "Bearer ")
+	}
+	if token == "" {
+		return false
+	}
+	for _, t := range c.Auth.Tokens {
+		if t == token {
+			return true
+		}
+	}
+	return false
+}
+
+// originAllowed 检查 WebSocket 升级请求的来源
+// - 没有 Origin 头：非浏览器客户端（桌面端、鸿蒙端），允许
+// - 与请求 Host 同源：允许
+// - 命中 allowed_origins：允许，支持 "*" 与 "https://*.example.com" 形式的子域名通配
+func (c *Config) originAllowed(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+
+	for _, allowed := range c.AllowedOrigins {
+		if matchOrigin(allowed, u) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchOrigin 判断来源是否匹配允许列表中的一项
+func matchOrigin(pattern string, origin *url.URL) bool {
+	if pattern == "*" {
+		return true
+	}
+
+	p, err := url.Parse(strings.TrimSuffix(pattern, "/"))
+	if err != nil || !strings.EqualFold(p.Scheme, origin.Scheme) {
+		return false
+	}
+	if suffix, ok := strings.CutPrefix(p.Host, "*."); ok {
+		host := strings.ToLower(origin.Host)
+		suffix = strings.ToLower(suffix)
+		return strings.HasSuffix(host, "."+suffix)
+	}
+	return strings.EqualFold(p.Host, origin.Host)
+}
+
+// clientIP 获取客户端真实 IP
+// 只有直连地址属于可信代理时才采信 X-Forwarded-For，并从右向左取第一个不可信地址
+func (c *Config) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !c.isTrustedProxy(host) {
+		return host
+	}
+
+	forwarded := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		ip := strings.TrimSpace(forwarded[i])
+		if ip == "" {
+			continue
+		}
+		if !c.isTrustedProxy(ip) {
+			return ip
+		}
+		host = ip
+	}
+	return host
+}
+
+// isTrustedProxy 是否为可信代理地址
+func (c *Config) isTrustedProxy(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, ipNet := range c.trustedNets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ==========================================
+// 日志
+// ==========================================
+
+// logLevel 全局日志级别，重新加载配置时更新
+var logLevel = new(slog.LevelVar)
+
+// setupLogger 初始化全局结构化日志
+func setupLogger(cfg *Config) {
+	level, _ := parseLogLevel(cfg.Log.Level)
+	logLevel.Set(level)
+
+	opts := &slog.HandlerOptions{Level: logLevel}
+	var handler slog.Handler
+	if cfg.Log.Format == "text" {
+		handler = slog.NewTextHandler(os.Stderr, opts)
+	} else {
+		handler = slog.NewJSONHandler(os.Stderr, opts)
+	}
+	slog.SetDefault(slog.New(handler))
+}
+
+// shortID 截短客户端 ID 用于日志
+func shortID(id string) string {
+	if len(id) > 8 {
+		return id[:8]
+	}
+	return id
+}
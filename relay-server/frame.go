@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+)
+
+// ==========================================
+// V1.1 二进制协议头部（中继只读取头部，不解析 Payload）
+// ==========================================
+
+const (
+	frameMagic      uint16 = 0x4E50 // ASCII 'NP'
+	frameHeaderSize        = 33
+
+	frameTypeHeartbeat uint8 = 0x0
+	frameTypeHandshake uint8 = 0x1
+	frameTypeText      uint8 = 0x2
+	frameTypeImage     uint8 = 0x3
+	frameTypeFile      uint8 = 0x4
+
+	frameFlagMF      uint8 = 0x01 // 有后续分片
+	frameFlagHasMeta uint8 = 0x02 // 包含元数据
+)
+
+// frameHeader V2 二进制帧头部
+type frameHeader struct {
+	Type   uint8
+	Flags  uint8
+	MsgID  uint32
+	Seq    uint32
+	Sender string // 发送者 UUID（十六进制）
+}
+
+// parseFrameHeader 解析二进制帧头部，不是合法帧时返回 false
+func parseFrameHeader(data []byte) (frameHeader, bool) {
+	if len(data) < frameHeaderSize {
+		return frameHeader{}, false
+	}
+	if binary.BigEndian.Uint16(data[0:2]) != frameMagic {
+		return frameHeader{}, false
+	}
+
+	return frameHeader{
+		Type:   data[2] & 0x0F,
+		Flags:  data[3],
+		MsgID:  binary.BigEndian.Uint32(data[5:9]),
+		Seq:    binary.BigEndian.Uint32(data[9:13]),
+		Sender: hex.EncodeToString(data[13:29]),
+	}, true
+}
+
+// isContent 是否为剪贴板内容帧（文本/图片/文件）
+func (h frameHeader) isContent() bool {
+	return h.Type == frameTypeText || h.Type == frameTypeImage || h.Type == frameTypeFile
+}
+
+// isLast 是否为条目的最后一个分片
+func (h frameHeader) isLast() bool {
+	return h.Flags&frameFlagMF == 0
+}
+
+// handshakeInfo 握手帧中的设备信息
+type handshakeInfo struct {
+	Name string `json:"name"`
+	OS   string `json:"os"`
+}
+
+// parseHandshake 解析握手帧的 JSON 负载，失败时返回 false
+func parseHandshake(data []byte) (handshakeInfo, bool) {
+	var info handshakeInfo
+	if len(data) <= frameHeaderSize {
+		return info, false
+	}
+	if err := json.Unmarshal(data[frameHeaderSize:], &info); err != nil {
+		return info, false
+	}
+	return info, true
+}
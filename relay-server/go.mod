@@ -5,6 +5,7 @@ go 1.21
 require (
 	github.com/google/uuid v1.6.0
 	github.com/gorilla/websocket v1.5.1
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require golang.org/x/net v0.17.0 // indirect
@@ -0,0 +1,592 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ==========================================
+// 离线信箱（Store-and-forward）
+// ==========================================
+//
+// 房间内没有其他在线成员时，广播会丢失条目。开启信箱后，中继按房间缓存
+// 完整的剪贴板条目（文本/图片/文件的全部分片），在其他成员重新连接并
+// 发送握手后补发。成员以 V2 帧头中的发送者 UUID 标识，每个成员每个条目
+// 只会收到一次。仅对 V2 房间生效。
+//
+// 条目的接收者按广播时实际收到全部分片的成员记录。连接的首个帧到达前不知道
+// 成员 UUID，先记在连接 ID 上，成员识别后（Pending）再换算为成员，避免尚未
+// 发送首帧的在线成员在识别后重复收到同一条目；识别前就断开的连接在 Leave 时清理。
+//
+// 房间信箱只在内容变化时保存；磁盘存储把成员与条目元数据写入房间索引，
+// 条目的分片在存入时单独写一次，之后的投递记录只重写索引。
+
+// MailboxConfig 信箱限制
+type MailboxConfig struct {
+	MaxItems int           // 每个房间最多保留的条目数
+	MaxBytes int64         // 每个房间条目总字节数上限
+	TTL      time.Duration // 条目保留时长
+}
+
+// MailboxItem 信箱中的一个完整条目
+type MailboxItem struct {
+	ID        string // 发送者 UUID + MsgID
+	Sender    string
+	Type      uint8
+	Frames    [][]byte
+	Size      int64
+	CreatedAt time.Time
+
+	// Pending 条目产生时不在线的已知成员，投递后移除
+	Pending map[string]bool
+	// Open 条目产生时房间内没有其他已知成员，任何新加入的成员都可领取一次
+	Open bool
+	// Delivered 已投递的成员
+	Delivered map[string]bool
+	// Unidentified 广播时收到了条目、但尚未发送首帧的连接 ID，识别后换算为成员
+	Unidentified map[string]bool
+}
+
+// RoomMailbox 单个房间的信箱状态
+type RoomMailbox struct {
+	RoomID  string
+	Members map[string]time.Time // 成员 UUID -> 最后活跃时间
+	Items   []*MailboxItem
+
+	dirty bool // 读取后有变化，需要保存
+}
+
+// MailboxStore 信箱存储后端
+type MailboxStore interface {
+	// Load 读取房间信箱，不存在时返回 nil；条目的分片可能尚未读取（Frames 为 nil）
+	Load(roomID string) (*RoomMailbox, error)
+	// LoadFrames 读取条目的分片
+	LoadFrames(roomID, itemID string) ([][]byte, error)
+	// Save 保存房间信箱，并清理已移除条目的数据
+	Save(box *RoomMailbox) error
+	// Delete 删除房间信箱
+	Delete(roomID string) error
+	// Rooms 列出所有存有信箱的房间
+	Rooms() ([]string, error)
+}
+
+// Mailbox 离线信箱
+type Mailbox struct {
+	config MailboxConfig
+	store  MailboxStore
+	mu     sync.Mutex
+	stopCh chan struct{}
+}
+
+// NewMailbox 创建离线信箱，并启动过期清理协程
+func NewMailbox(config MailboxConfig, store MailboxStore) *Mailbox {
+	mb := &Mailbox{
+		config: config,
+		store:  store,
+		stopCh: make(chan struct{}),
+	}
+	go mb.janitor()
+	return mb
+}
+
+// SetConfig 更新信箱限制（用于热重载），在下次访问房间时生效
+func (mb *Mailbox) SetConfig(config MailboxConfig) {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+	mb.config = config
+}
+
+// MaxBytes 单个房间的容量上限
+func (mb *Mailbox) MaxBytes() int64 {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+	return mb.config.MaxBytes
+}
+
+// Close 停止过期清理协程
+func (mb *Mailbox) Close() {
+	close(mb.stopCh)
+}
+
+// load 读取房间信箱并清理过期条目（调用方需持有 mb.mu）
+func (mb *Mailbox) load(roomID string) *RoomMailbox {
+	box, err := mb.store.Load(roomID)
+	if err != nil {
+		slog.Error("读取房间信箱失败", "room", roomID, "error", err)
+	}
+	if box == nil {
+		box = &RoomMailbox{RoomID: roomID}
+	}
+	if box.Members == nil {
+		box.Members = make(map[string]time.Time)
+	}
+	mb.prune(box)
+	return box
+}
+
+// save 保存有变化的房间信箱，信箱为空时删除（调用方需持有 mb.mu）
+func (mb *Mailbox) save(box *RoomMailbox) {
+	if !box.dirty {
+		return
+	}
+	box.dirty = false
+
+	var err error
+	if len(box.Items) == 0 && len(box.Members) == 0 {
+		err = mb.store.Delete(box.RoomID)
+	} else {
+		err = mb.store.Save(box)
+	}
+	if err != nil {
+		slog.Error("保存房间信箱失败", "room", box.RoomID, "error", err)
+	}
+}
+
+// touch 刷新成员的最后活跃时间；只有新成员或距上次记录超过保留时长的十分之一时
+// 才标记信箱需要保存，避免每次重连都重写信箱
+func (mb *Mailbox) touch(box *RoomMailbox, member string, now time.Time) {
+	lastSeen, ok := box.Members[member]
+	box.Members[member] = now
+	if !ok || (mb.config.TTL > 0 && now.Sub(lastSeen) > mb.config.TTL/10) {
+		box.dirty = true
+	}
+}
+
+// Put 存入一个完整条目
+// recipients: 条目广播时实际收到全部分片的连接 ID -> 成员 UUID（连接尚未识别时为空）
+func (mb *Mailbox) Put(roomID string, item *MailboxItem, recipients map[string]string) {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+
+	box := mb.load(roomID)
+	now := time.Now()
+	mb.touch(box, item.Sender, now)
+
+	item.CreatedAt = now
+	item.Delivered = make(map[string]bool)
+	item.Pending = make(map[string]bool)
+	item.Unidentified = make(map[string]bool)
+	for connID, member := range recipients {
+		if member == "" {
+			// 尚未识别的连接，识别后在 Pending 中换算为成员
+			item.Unidentified[connID] = true
+			continue
+		}
+		mb.touch(box, member, now)
+		item.Delivered[member] = true
+	}
+	for member := range box.Members {
+		if member != item.Sender && !item.Delivered[member] {
+			item.Pending[member] = true
+		}
+	}
+	// 房间里只有发送者自己：任何之后加入的成员都可以领取
+	item.Open = len(box.Members) == 1
+
+	if !item.Open && len(item.Pending) == 0 {
+		// 所有已知成员都在线，无需缓存
+		mb.save(box)
+		return
+	}
+
+	box.Items = append(box.Items, item)
+	box.dirty = true
+	mb.enforceLimits(box)
+	mb.save(box)
+}
+
+// Pending 成员（重新）加入房间时，获取待投递给该成员的条目
+// connID 为成员当前的连接，该连接识别前已实时收到的条目记为已投递
+func (mb *Mailbox) Pending(roomID, member, connID string) []*MailboxItem {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+
+	box := mb.load(roomID)
+	mb.touch(box, member, time.Now())
+
+	var items []*MailboxItem
+	kept := box.Items[:0]
+	for _, item := range box.Items {
+		if item.Unidentified[connID] {
+			delete(item.Unidentified, connID)
+			item.Delivered[member] = true
+			delete(item.Pending, member)
+			box.dirty = true
+			if !item.Open && len(item.Pending) == 0 {
+				continue
+			}
+		}
+		kept = append(kept, item)
+		if item.Sender == member || item.Delivered[member] {
+			continue
+		}
+		if !item.Open && !item.Pending[member] {
+			continue
+		}
+		if item.Frames == nil {
+			frames, err := mb.store.LoadFrames(roomID, item.ID)
+			if err != nil {
+				slog.Error("读取信箱条目失败", "room", roomID, "item", item.ID, "error", err)
+				continue
+			}
+			item.Frames = frames
+		}
+		items = append(items, item)
+	}
+	box.Items = kept
+	mb.save(box)
+	return items
+}
+
+// Leave 连接断开：清理该连接识别前实时收到的条目记录，已识别成员的投递记录保持不变
+func (mb *Mailbox) Leave(roomID, connID string) {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+
+	box := mb.load(roomID)
+	for _, item := range box.Items {
+		if item.Unidentified[connID] {
+			delete(item.Unidentified, connID)
+			box.dirty = true
+		}
+	}
+	mb.save(box)
+}
+
+// MarkDelivered 标记条目已投递给成员，并移除所有成员都已收到的条目
+func (mb *Mailbox) MarkDelivered(roomID, member string, itemIDs []string) {
+	if len(itemIDs) == 0 {
+		return
+	}
+
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+
+	box := mb.load(roomID)
+	ids := make(map[string]bool, len(itemIDs))
+	for _, id := range itemIDs {
+		ids[id] = true
+	}
+
+	kept := box.Items[:0]
+	for _, item := range box.Items {
+		if ids[item.ID] {
+			item.Delivered[member] = true
+			delete(item.Pending, member)
+			box.dirty = true
+		}
+		if item.Open || len(item.Pending) > 0 {
+			kept = append(kept, item)
+		}
+	}
+	box.Items = kept
+	mb.save(box)
+}
+
+// prune 清理过期条目与长期不活跃的成员
+func (mb *Mailbox) prune(box *RoomMailbox) {
+	if mb.config.TTL <= 0 {
+		return
+	}
+	deadline := time.Now().Add(-mb.config.TTL)
+
+	kept := box.Items[:0]
+	for _, item := range box.Items {
+		if item.CreatedAt.After(deadline) {
+			kept = append(kept, item)
+		}
+	}
+	if len(kept) != len(box.Items) {
+		box.dirty = true
+	}
+	box.Items = kept
+
+	for member, lastSeen := range box.Members {
+		if lastSeen.Before(deadline) {
+			delete(box.Members, member)
+			box.dirty = true
+		}
+	}
+}
+
+// enforceLimits 按条目数与字节数淘汰最旧的条目
+func (mb *Mailbox) enforceLimits(box *RoomMailbox) {
+	var total int64
+	for _, item := range box.Items {
+		total += item.Size
+	}
+
+	for len(box.Items) > 0 {
+		overCount := mb.config.MaxItems > 0 && len(box.Items) > mb.config.MaxItems
+		overBytes := mb.config.MaxBytes > 0 && total > mb.config.MaxBytes
+		if !overCount && !overBytes {
+			break
+		}
+		total -= box.Items[0].Size
+		box.Items = box.Items[1:]
+		box.dirty = true
+	}
+}
+
+// janitor 定期清理所有房间的过期条目
+func (mb *Mailbox) janitor() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-mb.stopCh:
+			return
+		case <-ticker.C:
+			rooms, err := mb.store.Rooms()
+			if err != nil {
+				slog.Error("列出信箱房间失败", "error", err)
+				continue
+			}
+			mb.mu.Lock()
+			for _, roomID := range rooms {
+				mb.save(mb.load(roomID))
+			}
+			mb.mu.Unlock()
+		}
+	}
+}
+
+// ==========================================
+// 内存存储
+// ==========================================
+
+// MemoryMailboxStore 内存信箱存储，重启后丢失
+type MemoryMailboxStore struct {
+	boxes map[string]*RoomMailbox
+	mu    sync.Mutex
+}
+
+// NewMemoryMailboxStore 创建内存信箱存储
+func NewMemoryMailboxStore() *MemoryMailboxStore {
+	return &MemoryMailboxStore{
+		boxes: make(map[string]*RoomMailbox),
+	}
+}
+
+// Load 读取房间信箱
+func (m *MemoryMailboxStore) Load(roomID string) (*RoomMailbox, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.boxes[roomID], nil
+}
+
+// LoadFrames 内存存储中的条目始终带有分片，不会调用
+func (m *MemoryMailboxStore) LoadFrames(roomID, itemID string) ([][]byte, error) {
+	return nil, fmt.Errorf("信箱条目 %s 不存在", itemID)
+}
+
+// Save 保存房间信箱
+func (m *MemoryMailboxStore) Save(box *RoomMailbox) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.boxes[box.RoomID] = box
+	return nil
+}
+
+// Delete 删除房间信箱
+func (m *MemoryMailboxStore) Delete(roomID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.boxes, roomID)
+	return nil
+}
+
+// Rooms 列出所有存有信箱的房间
+func (m *MemoryMailboxStore) Rooms() ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rooms := make([]string, 0, len(m.boxes))
+	for roomID := range m.boxes {
+		rooms = append(rooms, roomID)
+	}
+	return rooms, nil
+}
+
+// ==========================================
+// 磁盘存储
+// ==========================================
+
+// DiskMailboxStore 磁盘信箱存储：每个房间一个 gob 索引文件（成员与条目元数据），
+// 条目的分片保存在房间目录下的单独文件中，只在条目存入时写一次
+type DiskMailboxStore struct {
+	dir string
+}
+
+// NewDiskMailboxStore 创建磁盘信箱存储
+func NewDiskMailboxStore(dir string) (*DiskMailboxStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("创建信箱目录失败: %w", err)
+	}
+	return &DiskMailboxStore{dir: dir}, nil
+}
+
+// hashName 对 ID 取哈希作为文件名，避免路径穿越
+func hashName(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(sum[:16])
+}
+
+// path 房间索引文件路径
+func (d *DiskMailboxStore) path(roomID string) string {
+	return filepath.Join(d.dir, hashName(roomID)+".mbox")
+}
+
+// itemDir 房间条目分片目录
+func (d *DiskMailboxStore) itemDir(roomID string) string {
+	return filepath.Join(d.dir, hashName(roomID))
+}
+
+// itemPath 条目分片文件路径
+func (d *DiskMailboxStore) itemPath(roomID, itemID string) string {
+	return filepath.Join(d.itemDir(roomID), hashName(itemID)+".item")
+}
+
+// Load 读取房间索引
+func (d *DiskMailboxStore) Load(roomID string) (*RoomMailbox, error) {
+	return d.readFile(d.path(roomID))
+}
+
+// readFile 解码索引文件
+func (d *DiskMailboxStore) readFile(path string) (*RoomMailbox, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var box RoomMailbox
+	if err := gob.NewDecoder(f).Decode(&box); err != nil {
+		return nil, err
+	}
+	return &box, nil
+}
+
+// LoadFrames 读取条目的分片
+func (d *DiskMailboxStore) LoadFrames(roomID, itemID string) ([][]byte, error) {
+	f, err := os.Open(d.itemPath(roomID, itemID))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var frames [][]byte
+	if err := gob.NewDecoder(f).Decode(&frames); err != nil {
+		return nil, err
+	}
+	return frames, nil
+}
+
+// Save 保存房间索引：新条目的分片先写入单独的文件，索引中不含分片；
+// 索引写入后删除已移除条目的分片文件
+func (d *DiskMailboxStore) Save(box *RoomMailbox) error {
+	index := *box
+	index.Items = make([]*MailboxItem, 0, len(box.Items))
+	keep := make(map[string]bool, len(box.Items))
+	for _, item := range box.Items {
+		name := d.itemPath(box.RoomID, item.ID)
+		keep[filepath.Base(name)] = true
+		if item.Frames != nil {
+			if err := d.writeItem(name, item.Frames); err != nil {
+				return err
+			}
+		}
+		meta := *item
+		meta.Frames = nil
+		index.Items = append(index.Items, &meta)
+	}
+
+	if err := d.writeAtomic(d.path(box.RoomID), &index); err != nil {
+		return err
+	}
+
+	entries, err := os.ReadDir(d.itemDir(box.RoomID))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	for _, entry := range entries {
+		if !keep[entry.Name()] {
+			os.Remove(filepath.Join(d.itemDir(box.RoomID), entry.Name()))
+		}
+	}
+	return nil
+}
+
+// writeItem 写入条目分片，文件已存在时跳过（条目内容不会变化）
+func (d *DiskMailboxStore) writeItem(path string, frames [][]byte) error {
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	return d.writeAtomic(path, frames)
+}
+
+// writeAtomic 编码后先写临时文件再重命名
+func (d *DiskMailboxStore) writeAtomic(path string, v any) error {
+	tmp, err := os.CreateTemp(d.dir, "*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := gob.NewEncoder(tmp).Encode(v); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Delete 删除房间索引与条目分片
+func (d *DiskMailboxStore) Delete(roomID string) error {
+	err := os.Remove(d.path(roomID))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return os.RemoveAll(d.itemDir(roomID))
+}
+
+// Rooms 列出所有存有信箱的房间
+func (d *DiskMailboxStore) Rooms() ([]string, error) {
+	entries, err := os.ReadDir(d.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var rooms []string
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".mbox") {
+			continue
+		}
+		box, err := d.readFile(filepath.Join(d.dir, entry.Name()))
+		if err != nil || box == nil {
+			continue
+		}
+		rooms = append(rooms, box.RoomID)
+	}
+	return rooms, nil
+}
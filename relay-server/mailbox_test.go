@@ -0,0 +1,296 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestMailbox 创建信箱，测试结束时停止清理协程
+func newTestMailbox(t *testing.T, config MailboxConfig, store MailboxStore) *Mailbox {
+	t.Helper()
+	mb := NewMailbox(config, store)
+	t.Cleanup(mb.Close)
+	return mb
+}
+
+// testItem 单帧条目
+func testItem(id, sender string, size int) *MailboxItem {
+	return &MailboxItem{
+		ID:     id,
+		Sender: sender,
+		Type:   frameTypeText,
+		Frames: [][]byte{make([]byte, size)},
+		Size:   int64(size),
+	}
+}
+
+// itemIDs 条目 ID 列表
+func itemIDs(items []*MailboxItem) []string {
+	ids := make([]string, 0, len(items))
+	for _, item := range items {
+		ids = append(ids, item.ID)
+	}
+	return ids
+}
+
+// storedIDs 房间信箱中当前缓存的条目 ID
+func storedIDs(mb *Mailbox, roomID string) []string {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+	return itemIDs(mb.load(roomID).Items)
+}
+
+func TestMailboxPendingAndMarkDelivered(t *testing.T) {
+	mb := newTestMailbox(t, MailboxConfig{MaxItems: 10, MaxBytes: 1 << 20, TTL: time.Hour}, NewMemoryMailboxStore())
+
+	// alice、bob、carol 都曾加入房间；bob 在线并收到了条目，carol 离线
+	mb.Pending("room", "alice", "conn-a")
+	mb.Pending("room", "bob", "conn-b")
+	mb.Pending("room", "carol", "conn-c")
+	mb.Leave("room", "conn-c")
+	mb.Put("room", testItem("item-1", "alice", 10), map[string]string{"conn-b": "bob"})
+
+	if got := itemIDs(mb.Pending("room", "bob", "conn-b")); len(got) != 0 {
+		t.Fatalf("bob 待投递 = %v，广播时已收到的条目不应再补发", got)
+	}
+	if got := itemIDs(mb.Pending("room", "alice", "conn-a")); len(got) != 0 {
+		t.Fatalf("alice 待投递 = %v，不应补发自己发送的条目", got)
+	}
+	got := mb.Pending("room", "carol", "conn-c2")
+	if ids := itemIDs(got); len(ids) != 1 || ids[0] != "item-1" {
+		t.Fatalf("carol 待投递 = %v，期望 [item-1]", ids)
+	}
+
+	// 投递给最后一个待投递成员后移除条目
+	mb.MarkDelivered("room", "carol", []string{"item-1"})
+	if ids := storedIDs(mb, "room"); len(ids) != 0 {
+		t.Fatalf("信箱条目 = %v，所有成员都已收到后应移除", ids)
+	}
+	if got := mb.Pending("room", "carol", "conn-c2"); len(got) != 0 {
+		t.Fatalf("carol 再次领取到 %v", itemIDs(got))
+	}
+}
+
+func TestMailboxOpenItemClaimedOncePerMember(t *testing.T) {
+	mb := newTestMailbox(t, MailboxConfig{MaxItems: 10, MaxBytes: 1 << 20, TTL: time.Hour}, NewMemoryMailboxStore())
+
+	// 房间里只有发送者：之后加入的每个成员各领取一次
+	mb.Put("room", testItem("item-1", "alice", 10), nil)
+	for _, member := range []string{"bob", "carol"} {
+		items := mb.Pending("room", member, "conn-"+member)
+		if ids := itemIDs(items); len(ids) != 1 {
+			t.Fatalf("%s 待投递 = %v，期望领取开放条目", member, ids)
+		}
+		mb.MarkDelivered("room", member, itemIDs(items))
+		if got := mb.Pending("room", member, "conn-"+member); len(got) != 0 {
+			t.Fatalf("%s 重复领取 %v", member, itemIDs(got))
+		}
+	}
+	if ids := storedIDs(mb, "room"); len(ids) != 1 {
+		t.Fatalf("信箱条目 = %v，开放条目应保留给之后加入的成员", ids)
+	}
+}
+
+func TestMailboxRecipientIdentifiedAfterBroadcast(t *testing.T) {
+	mb := newTestMailbox(t, MailboxConfig{MaxItems: 10, MaxBytes: 1 << 20, TTL: time.Hour}, NewMemoryMailboxStore())
+
+	// bob 曾经加入房间；重新连接后尚未发送首帧时实时收到了两个条目
+	mb.Pending("room", "alice", "conn-a")
+	mb.Pending("room", "bob", "conn-b1")
+	mb.Leave("room", "conn-b1")
+	mb.Put("room", testItem("item-1", "alice", 10), map[string]string{"conn-b2": ""})
+	mb.Put("room", testItem("item-2", "alice", 10), nil)
+
+	// 识别后只补发没有实时收到的条目
+	if ids := itemIDs(mb.Pending("room", "bob", "conn-b2")); len(ids) != 1 || ids[0] != "item-2" {
+		t.Fatalf("bob 待投递 = %v，期望只有 [item-2]", ids)
+	}
+	if ids := storedIDs(mb, "room"); len(ids) != 1 || ids[0] != "item-2" {
+		t.Fatalf("信箱条目 = %v，已实时收到的条目应移除", ids)
+	}
+
+	// 未识别就断开的连接不再占用条目
+	mb.Put("room", testItem("item-3", "alice", 10), map[string]string{"conn-x": ""})
+	mb.Leave("room", "conn-x")
+	mb.mu.Lock()
+	box := mb.load("room")
+	mb.mu.Unlock()
+	for _, item := range box.Items {
+		if item.Unidentified["conn-x"] {
+			t.Fatalf("条目 %s 仍记录着已断开的连接", item.ID)
+		}
+	}
+}
+
+func TestMailboxLeaveKeepsMemberDelivery(t *testing.T) {
+	mb := newTestMailbox(t, MailboxConfig{MaxItems: 10, MaxBytes: 1 << 20, TTL: time.Hour}, NewMemoryMailboxStore())
+
+	// bob 实时收到条目后立即断开，断开可能先于条目存入信箱
+	mb.Pending("room", "alice", "conn-a")
+	mb.Pending("room", "bob", "conn-b1")
+	mb.Pending("room", "carol", "conn-c")
+	mb.Leave("room", "conn-c")
+	mb.Leave("room", "conn-b1")
+	mb.Put("room", testItem("item-1", "alice", 10), map[string]string{"conn-b1": "bob"})
+	mb.Leave("room", "conn-b1")
+
+	if got := mb.Pending("room", "bob", "conn-b2"); len(got) != 0 {
+		t.Fatalf("bob 重连后又收到 %v，断开不应撤销投递记录", itemIDs(got))
+	}
+	if ids := itemIDs(mb.Pending("room", "carol", "conn-c2")); len(ids) != 1 || ids[0] != "item-1" {
+		t.Fatalf("carol 待投递 = %v，期望 [item-1]", ids)
+	}
+}
+
+// countingStore 记录 Save 次数的信箱存储
+type countingStore struct {
+	MailboxStore
+	saves int
+}
+
+func (c *countingStore) Save(box *RoomMailbox) error {
+	c.saves++
+	return c.MailboxStore.Save(box)
+}
+
+func TestMailboxSavesOnlyOnChange(t *testing.T) {
+	store := &countingStore{MailboxStore: NewMemoryMailboxStore()}
+	mb := newTestMailbox(t, MailboxConfig{MaxItems: 10, MaxBytes: 1 << 20, TTL: time.Hour}, store)
+
+	mb.Pending("room", "bob", "conn-b")
+	mb.Leave("room", "conn-b")
+	mb.Put("room", testItem("item-1", "alice", 10), nil)
+	saves := store.saves
+
+	// 没有可投递条目的重连、断开与清理都不改变信箱
+	mb.Pending("room", "alice", "conn-a2")
+	mb.Leave("room", "conn-a2")
+	mb.MarkDelivered("room", "alice", nil)
+	mb.mu.Lock()
+	mb.save(mb.load("room"))
+	mb.mu.Unlock()
+	if store.saves != saves {
+		t.Fatalf("信箱没有变化却保存了 %d 次", store.saves-saves)
+	}
+
+	mb.MarkDelivered("room", "bob", []string{"item-1"})
+	if store.saves != saves+1 {
+		t.Fatalf("投递记录变化后保存了 %d 次，期望 1 次", store.saves-saves)
+	}
+}
+
+func TestMailboxExpiresItemsAndMembers(t *testing.T) {
+	mb := newTestMailbox(t, MailboxConfig{MaxItems: 10, MaxBytes: 1 << 20, TTL: 50 * time.Millisecond}, NewMemoryMailboxStore())
+
+	mb.Pending("room", "bob", "conn-b")
+	mb.Leave("room", "conn-b")
+	mb.Put("room", testItem("item-1", "alice", 10), nil)
+	if ids := storedIDs(mb, "room"); len(ids) != 1 {
+		t.Fatalf("信箱条目 = %v，期望缓存给离线的 bob", ids)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if got := mb.Pending("room", "bob", "conn-b2"); len(got) != 0 {
+		t.Fatalf("过期后仍补发 %v", itemIDs(got))
+	}
+	mb.mu.Lock()
+	box := mb.load("room")
+	mb.mu.Unlock()
+	if _, ok := box.Members["alice"]; ok {
+		t.Fatalf("长期不活跃的成员未被清理: %v", box.Members)
+	}
+}
+
+func TestMailboxEnforcesLimits(t *testing.T) {
+	t.Run("条目数", func(t *testing.T) {
+		mb := newTestMailbox(t, MailboxConfig{MaxItems: 2, MaxBytes: 1 << 20, TTL: time.Hour}, NewMemoryMailboxStore())
+		for _, id := range []string{"item-1", "item-2", "item-3"} {
+			mb.Put("room", testItem(id, "alice", 10), nil)
+		}
+		if ids := storedIDs(mb, "room"); strings.Join(ids, ",") != "item-2,item-3" {
+			t.Fatalf("信箱条目 = %v，期望淘汰最旧的条目", ids)
+		}
+	})
+	t.Run("字节数", func(t *testing.T) {
+		mb := newTestMailbox(t, MailboxConfig{MaxItems: 10, MaxBytes: 250, TTL: time.Hour}, NewMemoryMailboxStore())
+		for _, id := range []string{"item-1", "item-2", "item-3"} {
+			mb.Put("room", testItem(id, "alice", 100), nil)
+		}
+		if ids := storedIDs(mb, "room"); strings.Join(ids, ",") != "item-2,item-3" {
+			t.Fatalf("信箱条目 = %v，期望淘汰最旧的条目", ids)
+		}
+	})
+}
+
+func TestDiskMailboxStoreSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	config := MailboxConfig{MaxItems: 10, MaxBytes: 1 << 20, TTL: time.Hour}
+	newStore := func() *DiskMailboxStore {
+		store, err := NewDiskMailboxStore(dir)
+		if err != nil {
+			t.Fatalf("NewDiskMailboxStore: %v", err)
+		}
+		return store
+	}
+
+	room := "../room/含路径的房间"
+	mb := newTestMailbox(t, config, newStore())
+	mb.Pending(room, "bob", "conn-b")
+	mb.Leave(room, "conn-b")
+	mb.Put(room, testItem("item-1", "alice", 10), nil)
+
+	// 文件名取房间 ID 的哈希，不包含房间 ID 本身；分片单独保存，索引中不含分片
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("读取信箱目录失败: %v", err)
+	}
+	var index string
+	for _, entry := range entries {
+		if strings.Contains(entry.Name(), "room") {
+			t.Fatalf("文件名包含房间 ID: %s", entry.Name())
+		}
+		if strings.HasSuffix(entry.Name(), ".mbox") {
+			index = filepath.Join(dir, entry.Name())
+		}
+	}
+	if len(entries) != 2 || index == "" {
+		t.Fatalf("信箱目录 = %v，期望一个 .mbox 索引和一个分片目录", entries)
+	}
+	indexInfo, err := os.Stat(index)
+	if err != nil {
+		t.Fatalf("读取索引失败: %v", err)
+	}
+
+	// 重连时没有投递变化，不重写索引
+	mb.Pending(room, "alice", "conn-a")
+	if info, _ := os.Stat(index); !info.ModTime().Equal(indexInfo.ModTime()) {
+		t.Fatalf("领取离线条目时重写了索引")
+	}
+
+	// 重启后从磁盘读回
+	store := newStore()
+	if rooms, err := store.Rooms(); err != nil || len(rooms) != 1 || rooms[0] != room {
+		t.Fatalf("Rooms() = %v, %v", rooms, err)
+	}
+	restarted := newTestMailbox(t, config, store)
+	items := restarted.Pending(room, "bob", "conn-b2")
+	if len(items) != 1 || items[0].ID != "item-1" || len(items[0].Frames[0]) != 10 {
+		t.Fatalf("重启后 bob 待投递 = %v", itemIDs(items))
+	}
+
+	// 信箱清空后删除文件
+	restarted.MarkDelivered(room, "bob", itemIDs(items))
+	restarted.Leave(room, "conn-b2")
+	restarted.mu.Lock()
+	box := restarted.load(room)
+	box.Members = nil
+	box.dirty = true
+	restarted.save(box)
+	restarted.mu.Unlock()
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Fatalf("信箱清空后目录仍有文件: %v", entries)
+	}
+}
@@ -1,20 +1,43 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
-	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"reflect"
+	"strconv"
 	"syscall"
+	"time"
 )
 
 var (
+	configPath = flag.String("config", "", "配置文件路径（YAML），收到 SIGHUP 时重新加载")
+
 	host = flag.String("host", "0.0.0.0", "监听地址")
 	port = flag.Int("port", 8080, "监听端口")
+
+	mailboxMode     = flag.String("mailbox", "off", "离线信箱模式: off | memory | disk")
+	mailboxDir      = flag.String("mailbox-dir", "mailbox", "离线信箱目录（mailbox=disk 时使用）")
+	mailboxMaxItems = flag.Int("mailbox-max-items", 20, "每个房间最多缓存的离线条目数")
+	mailboxMaxBytes = flag.Int64("mailbox-max-bytes", 32*1024*1024, "每个房间离线条目总字节数上限")
+	mailboxTTL      = flag.Duration("mailbox-ttl", 24*time.Hour, "离线条目保留时长")
+
+	drainTimeout   = flag.Duration("drain-timeout", 30*time.Second, "关闭时等待进行中传输完成的最长时间")
+	reconnectAfter = flag.Duration("reconnect-after", 5*time.Second, "关闭时建议客户端等待多久后重连")
+
+	backplaneURL = flag.String("backplane", "", "多实例背板地址，如 redis://:password@127.0.0.1:6379/0?prefix=nextpaste（留空为单实例）")
+	logLevelFlag = flag.String("log-level", "info", "日志级别: debug | info | warn | error")
 )
 
+// httpShutdownTimeout 排空 WebSocket 连接后，等待 HTTP 服务器处理完进行中请求的期限
+const httpShutdownTimeout = 5 * time.Second
+
 func main() {
 	// 解析命令行参数
 	flag.Usage = func() {
@@ -25,45 +48,224 @@ func main() {
 		flag.PrintDefaults()
 		fmt.Fprintf(os.Stderr, "\n连接方式:\n")
 		fmt.Fprintf(os.Stderr, "  ws://<host>:<port>/ws/<roomID>\n")
+		fmt.Fprintf(os.Stderr, "\n配置优先级: 默认值 < 配置文件 < 环境变量 (%s*) < 命令行参数\n", envPrefix)
 		fmt.Fprintf(os.Stderr, "\n示例:\n")
 		fmt.Fprintf(os.Stderr, "  %s --host 0.0.0.0 --port 8080\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s --config /etc/nextpaste-relay.yaml\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s --backplane redis://127.0.0.1:6379\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s --mailbox disk --mailbox-dir ./mailbox --mailbox-ttl 12h\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "  客户端连接: ws://localhost:8080/ws/my-room-123\n\n")
 	}
 	flag.Parse()
 
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "配置错误: %v\n", err)
+		os.Exit(1)
+	}
+	setupLogger(cfg)
+
 	// 创建中继服务器
-	server := NewRelayServer()
+	server := NewRelayServer(cfg)
+
+	// 离线信箱
+	mailbox, err := newMailbox(cfg.Mailbox)
+	if err != nil {
+		slog.Error("离线信箱初始化失败", "error", err)
+		os.Exit(1)
+	}
+	if mailbox != nil {
+		server.SetMailbox(mailbox)
+		defer mailbox.Close()
+	}
+
+	// 多实例背板
+	if cfg.Backplane != "" {
+		backplane, err := NewRedisBackplane(cfg.Backplane)
+		if err != nil {
+			slog.Error("背板连接失败", "error", err)
+			os.Exit(1)
+		}
+		server.SetBackplane(backplane)
+		defer backplane.Close()
+		slog.Info("多实例背板已连接", "addr", backplane.addr)
+	}
 
 	// 设置路由
-	// 设置路由
-	http.HandleFunc("/ws/", server.HandleWebSocket)
-	http.HandleFunc("/v2/ws/", server.HandleWebSocketV2)
-	http.HandleFunc("/", handleRoot)
-	http.HandleFunc("/health", handleHealth)
-
-	// 启动服务器
-	addr := fmt.Sprintf("%s:%d", *host, *port)
-	log.Printf("🚀 NextPaste 中继服务器启动")
-	log.Printf("📡 监听地址: %s", addr)
-	log.Printf("🔗 V1 连接 (旧版): ws://%s/ws/<roomID>", addr)
-	log.Printf("🔗 V2 连接 (推荐): ws://%s/v2/ws/<roomID>", addr)
-	log.Printf("💡 提示: 使用 Ctrl+C 停止服务器\n")
-
-	// 启动 HTTP 服务器
-	go func() {
-		if err := http.ListenAndServe(addr, nil); err != nil {
-			log.Fatalf("❌ 服务器启动失败: %v", err)
+	mux := newMux(server)
+
+	// 启动 HTTP 服务器（每个监听地址一个）
+	scheme := "ws"
+	if cfg.TLSEnabled() {
+		scheme = "wss"
+	}
+	var httpServers []*http.Server
+	for _, addr := range cfg.Listen {
+		httpServer := &http.Server{
+			Addr:    addr,
+			Handler: mux,
 		}
-	}()
+		httpServers = append(httpServers, httpServer)
 
-	// 等待中断信号
+		go func(httpServer *http.Server) {
+			var err error
+			if cfg.TLSEnabled() {
+				err = httpServer.ListenAndServeTLS(cfg.TLS.CertFile, cfg.TLS.KeyFile)
+			} else {
+				err = httpServer.ListenAndServe()
+			}
+			if err != nil && !errors.Is(err, http.ErrServerClosed) {
+				slog.Error("服务器启动失败", "addr", httpServer.Addr, "error", err)
+				os.Exit(1)
+			}
+		}(httpServer)
+
+		slog.Info("NextPaste 中继服务器启动",
+			"addr", addr,
+			"v1", fmt.Sprintf("%s://%s/ws/<roomID>", scheme, addr),
+			"v2", fmt.Sprintf("%s://%s/v2/ws/<roomID>", scheme, addr))
+	}
+
+	// 等待信号：SIGHUP 重新加载配置，SIGINT/SIGTERM 关闭
 	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
-	<-sigChan
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	for sig := range sigChan {
+		if sig != syscall.SIGHUP {
+			break
+		}
+		reloadConfig(server, mailbox)
+	}
+
+	cfg = server.cfg()
+	slog.Info("正在关闭服务器", "drainTimeout", cfg.Shutdown.DrainTimeout.String())
+
+	// 先排空 WebSocket 连接（被劫持的连接不受 http.Server 管理），再关闭 HTTP 服务器；
+	// 两个阶段各自计时，排空用尽期限时 HTTP 服务器仍有时间处理进行中的请求
+	drainCtx, cancelDrain := context.WithTimeout(context.Background(), cfg.Shutdown.DrainTimeout)
+	server.Shutdown(drainCtx, cfg.Shutdown.ReconnectAfter)
+	cancelDrain()
+
+	httpCtx, cancelHTTP := context.WithTimeout(context.Background(), httpShutdownTimeout)
+	defer cancelHTTP()
+	for _, httpServer := range httpServers {
+		if err := httpServer.Shutdown(httpCtx); err != nil {
+			slog.Warn("HTTP 服务器关闭超时", "addr", httpServer.Addr, "error", err)
+		}
+	}
+	slog.Info("服务器已关闭")
+}
+
+// loadConfig 加载配置文件与环境变量，并应用显式指定的命令行参数
+func loadConfig() (*Config, error) {
+	cfg, err := LoadConfig(*configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	setFlags := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { setFlags[f.Name] = true })
+
+	if setFlags["host"] || setFlags["port"] {
+		cfg.Listen = []string{net.JoinHostPort(*host, strconv.Itoa(*port))}
+	}
+	if setFlags["mailbox"] {
+		cfg.Mailbox.Mode = *mailboxMode
+	}
+	if setFlags["mailbox-dir"] {
+		cfg.Mailbox.Dir = *mailboxDir
+	}
+	if setFlags["mailbox-max-items"] {
+		cfg.Mailbox.MaxItems = *mailboxMaxItems
+	}
+	if setFlags["mailbox-max-bytes"] {
+		cfg.Mailbox.MaxBytes = *mailboxMaxBytes
+	}
+	if setFlags["mailbox-ttl"] {
+		cfg.Mailbox.TTL = *mailboxTTL
+	}
+	if setFlags["drain-timeout"] {
+		cfg.Shutdown.DrainTimeout = *drainTimeout
+	}
+	if setFlags["reconnect-after"] {
+		cfg.Shutdown.ReconnectAfter = *reconnectAfter
+	}
+	if setFlags["backplane"] {
+		cfg.Backplane = *backplaneURL
+	}
+	if setFlags["log-level"] {
+		cfg.Log.Level = *logLevelFlag
+	}
 
-	log.Println("\n👋 正在关闭服务器...")
-	server.Shutdown()
-	log.Println("✅ 服务器已关闭")
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// reloadConfig 处理 SIGHUP：重新加载配置并应用可热更新的部分
+func reloadConfig(server *RelayServer, mailbox *Mailbox) {
+	cfg, err := loadConfig()
+	if err != nil {
+		slog.Error("重新加载配置失败，继续使用旧配置", "error", err)
+		return
+	}
+
+	old := server.cfg()
+	if !reflect.DeepEqual(old.Listen, cfg.Listen) || old.TLS != cfg.TLS ||
+		old.Backplane != cfg.Backplane || old.Mailbox.Mode != cfg.Mailbox.Mode ||
+		old.Mailbox.Dir != cfg.Mailbox.Dir || old.Log.Format != cfg.Log.Format {
+		slog.Warn("监听地址、TLS、背板、信箱模式与日志格式的修改需要重启后生效")
+	}
+
+	level, _ := parseLogLevel(cfg.Log.Level)
+	logLevel.Set(level)
+	if mailbox != nil {
+		mailbox.SetConfig(mailboxConfig(cfg.Mailbox))
+	}
+	server.ApplyConfig(cfg)
+	slog.Info("配置已重新加载", "level", cfg.Log.Level)
+}
+
+// mailboxConfig 信箱配置转换为信箱限制
+func mailboxConfig(settings MailboxSettings) MailboxConfig {
+	return MailboxConfig{
+		MaxItems: settings.MaxItems,
+		MaxBytes: settings.MaxBytes,
+		TTL:      settings.TTL,
+	}
+}
+
+// newMailbox 根据配置创建离线信箱，未开启时返回 nil
+func newMailbox(settings MailboxSettings) (*Mailbox, error) {
+	config := mailboxConfig(settings)
+
+	switch settings.Mode {
+	case "", "off":
+		return nil, nil
+	case "memory":
+		slog.Info("离线信箱已开启", "store", "memory", "maxItems", config.MaxItems, "maxBytes", config.MaxBytes, "ttl", config.TTL.String())
+		return NewMailbox(config, NewMemoryMailboxStore()), nil
+	case "disk":
+		store, err := NewDiskMailboxStore(settings.Dir)
+		if err != nil {
+			return nil, err
+		}
+		slog.Info("离线信箱已开启", "store", "disk", "dir", settings.Dir, "maxItems", config.MaxItems, "maxBytes", config.MaxBytes, "ttl", config.TTL.String())
+		return NewMailbox(config, store), nil
+	default:
+		return nil, fmt.Errorf("未知的信箱模式: %s", settings.Mode)
+	}
+}
+
+// newMux 中继服务器的路由
+func newMux(server *RelayServer) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws/", server.HandleWebSocket)
+	mux.HandleFunc("/v2/ws/", server.HandleWebSocketV2)
+	mux.HandleFunc("/v2/rooms/", server.HandleRoomMembers)
+	mux.HandleFunc("/", handleRoot)
+	mux.HandleFunc("/health", server.HandleHealth)
+	return mux
 }
 
 // handleRoot 处理根路径
@@ -122,9 +324,3 @@ func handleRoot(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	w.Write([]byte(html))
 }
-
-// handleHealth 健康检查
-func handleHealth(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	w.Write([]byte(`{"status":"ok","service":"nextpaste-relay"}`))
-}
@@ -1,22 +1,21 @@
 package main
 
 import (
-	"log"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 )
 
-var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool {
-		return true // 允许所有来源
-	},
-}
-
 // Message WebSocket 消息
 type Message struct {
 	Type int
@@ -31,6 +30,51 @@ type Client struct {
 	Send     chan Message
 	ConnTime time.Time
 	IsV2     bool // 标记是否为 V2 客户端
+
+	// SenderUUID 客户端首个 V2 帧中的发送者 UUID（十六进制），用于离线信箱识别成员
+	SenderUUID string
+	// DeviceName / Platform 客户端握手帧中声明的设备信息，用于房间成员列表
+	DeviceName string
+	Platform   string
+	// pendingItem 正在接收的分片条目（仅开启离线信箱时使用）
+	pendingItem *MailboxItem
+	pendingMsg  uint32
+	// pendingRecipients 收到了 pendingItem 全部已转发分片的连接 ID -> 成员 UUID（尚未识别时为空）
+	pendingRecipients map[string]string
+	// unpublished 未能发布到背板的分片条目 MsgID，其余分片不再发布
+	unpublished     uint32
+	skipUnpublished bool
+
+	// sendMu 保护向 Send 写入；补发离线条目时整体持有，条目的分片不会与广播交错
+	sendMu sync.Mutex
+
+	// inFlight 客户端正在发送分片条目（已收到首帧、尚未收到尾帧）
+	inFlight atomic.Bool
+	// closing 关闭请求（Close 帧内容），由 writePump 发送
+	closing   chan []byte
+	closeOnce sync.Once
+	// done readPump 退出时关闭
+	done chan struct{}
+}
+
+// trySend 把消息放入发送队列，队列已满时返回 false
+func (c *Client) trySend(msg Message) bool {
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+
+	select {
+	case c.Send <- msg:
+		return true
+	default:
+		return false
+	}
+}
+
+// requestClose 请求 writePump 发送完队列中的消息后发送 Close 帧
+func (c *Client) requestClose(code int, reason string) {
+	c.closeOnce.Do(func() {
+		c.closing <- websocket.FormatCloseMessage(code, reason)
+	})
 }
 
 // Room 表示一个房间
@@ -38,6 +82,9 @@ type Room struct {
 	ID      string
 	Clients map[string]*Client
 	mu      sync.RWMutex
+
+	unsubscribe func() // 取消背板订阅
+	closed      bool   // 已从服务器移除，之后完成的订阅立即取消
 }
 
 // RelayServer 中继服务器
@@ -45,14 +92,94 @@ type RelayServer struct {
 	roomsV1 map[string]*Room
 	roomsV2 map[string]*Room
 	mu      sync.RWMutex
+	mailbox *Mailbox // 离线信箱，nil 表示未开启
+
+	instanceID string    // 实例 ID，用于在背板中识别自己发布的消息
+	backplane  Backplane // 多实例背板，nil 表示单实例运行
+
+	draining       atomic.Bool   // 正在优雅关闭，拒绝新的连接
+	reconnectAfter time.Duration // 关闭时建议客户端的重连等待时间
+
+	config   atomic.Pointer[Config] // 当前配置，SIGHUP 时整体替换
+	upgrader websocket.Upgrader
 }
 
-// NewRelayServer 创建中继服务器
-func NewRelayServer() *RelayServer {
-	return &RelayServer{
-		roomsV1: make(map[string]*Room),
-		roomsV2: make(map[string]*Room),
+// reconnectHintPrefix Close 帧 reason 中的重连提示前缀，如 "reconnect-after=5"（秒）
+const reconnectHintPrefix = "reconnect-after="
+
+// reconnectHint 生成 Close 帧中的重连提示
+func reconnectHint(d time.Duration) string {
+	return fmt.Sprintf("%s%d", reconnectHintPrefix, int(d.Round(time.Second)/time.Second))
+}
+
+// NewRelayServer 创建中继服务器，cfg 为 nil 时使用默认配置
+func NewRelayServer(cfg *Config) *RelayServer {
+	if cfg == nil {
+		cfg = DefaultConfig()
+		cfg.Validate()
+	}
+
+	s := &RelayServer{
+		roomsV1:    make(map[string]*Room),
+		roomsV2:    make(map[string]*Room),
+		instanceID: uuid.New().String(),
 	}
+	s.upgrader = websocket.Upgrader{
+		// 来源已在 serveWS 中校验，这里再次检查以防遗漏
+		CheckOrigin: func(r *http.Request) bool {
+			return s.cfg().originAllowed(r)
+		},
+	}
+	s.config.Store(cfg)
+	return s
+}
+
+// ApplyConfig 应用新配置（用于热重载），已建立的连接不受影响
+func (s *RelayServer) ApplyConfig(cfg *Config) {
+	s.config.Store(cfg)
+}
+
+// cfg 获取当前配置
+func (s *RelayServer) cfg() *Config {
+	return s.config.Load()
+}
+
+// checkCapacity 检查房间数与房间人数限制
+func (s *RelayServer) checkCapacity(roomID string, isV2 bool) error {
+	limits := s.cfg().Limits
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rooms := s.roomsV1
+	if isV2 {
+		rooms = s.roomsV2
+	}
+	room, exists := rooms[roomID]
+	if !exists {
+		if limits.MaxRooms > 0 && len(s.roomsV1)+len(s.roomsV2) >= limits.MaxRooms {
+			return fmt.Errorf("too many rooms")
+		}
+		return nil
+	}
+	if limits.MaxClientsPerRoom > 0 && room.getClientCount() >= limits.MaxClientsPerRoom {
+		return fmt.Errorf("room is full")
+	}
+	return nil
+}
+
+// SetBackplane 设置多实例背板，需在接受连接前调用
+func (s *RelayServer) SetBackplane(bp Backplane) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.backplane = bp
+}
+
+// SetMailbox 开启离线信箱（仅对 V2 房间生效）
+func (s *RelayServer) SetMailbox(mb *Mailbox) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.mailbox = mb
 }
 
 // HandleWebSocket 处理 WebSocket 连接 (V1: /ws/{roomID})
@@ -82,6 +209,67 @@ func (s *RelayServer) HandleWebSocketV2(w http.ResponseWriter, r *http.Request)
 	s.serveWS(w, r, parts[2], true)
 }
 
+// HandleHealth 健康检查 (GET /health)，features 列出客户端可以依赖的能力
+func (s *RelayServer) HandleHealth(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"status":   "ok",
+		"service":  "nextpaste-relay",
+		"features": s.features(),
+	})
+}
+
+// features 服务器支持的能力
+// 成员列表只包含本实例的连接，配置了背板（多实例部署）时不完整，不作为能力公布
+func (s *RelayServer) features() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	features := []string{"v1", "v2"}
+	if s.backplane == nil {
+		features = append(features, "room-members")
+	}
+	return features
+}
+
+// HandleRoomMembers 查询 V2 房间的在线成员 (GET /v2/rooms/{roomID}/members)
+// 只包含连接到本实例的成员，配置了背板时响应中 partial 为 true；需要与 WebSocket 连接相同的令牌
+func (s *RelayServer) HandleRoomMembers(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) != 4 || parts[0] != "v2" || parts[1] != "rooms" || parts[3] != "members" || parts[2] == "" {
+		http.Error(w, "Invalid path format. Use: /v2/rooms/{roomID}/members", http.StatusBadRequest)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.cfg().authorized(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	roomID := parts[2]
+	s.mu.RLock()
+	room := s.roomsV2[roomID]
+	partial := s.backplane != nil
+	s.mu.RUnlock()
+
+	members := []RoomMember{}
+	if room != nil {
+		members = room.members()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(map[string]any{
+		"room":    roomID,
+		"count":   len(members),
+		"members": members,
+		"partial": partial, // 多实例部署，其他实例上的成员不在列表中
+	})
+}
+
 // serveWS 通用 WebSocket 处理逻辑
 func (s *RelayServer) serveWS(w http.ResponseWriter, r *http.Request, roomID string, isV2 bool) {
 	if roomID == "" {
@@ -89,12 +277,43 @@ func (s *RelayServer) serveWS(w http.ResponseWriter, r *http.Request, roomID str
 		return
 	}
 
+	cfg := s.cfg()
+	remoteIP := cfg.clientIP(r)
+
+	// 正在关闭：拒绝新连接，并提示客户端稍后重连
+	if s.draining.Load() {
+		w.Header().Set("Retry-After", fmt.Sprintf("%d", int(s.reconnectAfter/time.Second)))
+		http.Error(w, "Server is shutting down", http.StatusServiceUnavailable)
+		return
+	}
+
+	if !cfg.originAllowed(r) {
+		slog.Warn("拒绝来源不被允许的连接", "room", roomID, "remote", remoteIP, "origin", r.Header.Get("Origin"))
+		http.Error(w, "Origin not allowed", http.StatusForbidden)
+		return
+	}
+
+	if !cfg.authorized(r) {
+		slog.Warn("拒绝未授权的连接", "room", roomID, "remote", remoteIP)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := s.checkCapacity(roomID, isV2); err != nil {
+		slog.Warn("拒绝连接：超出容量限制", "room", roomID, "remote", remoteIP, "reason", err.Error())
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
 	// 升级到 WebSocket
-	conn, err := upgrader.Upgrade(w, r, nil)
+	conn, err := s.upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		log.Printf("❌ WebSocket 升级失败: %v", err)
+		slog.Error("WebSocket 升级失败", "room", roomID, "remote", remoteIP, "error", err)
 		return
 	}
+	if cfg.Limits.MaxMessageSize > 0 {
+		conn.SetReadLimit(cfg.Limits.MaxMessageSize)
+	}
 
 	// 创建客户端
 	client := &Client{
@@ -104,24 +323,26 @@ func (s *RelayServer) serveWS(w http.ResponseWriter, r *http.Request, roomID str
 		Send:     make(chan Message, 256),
 		ConnTime: time.Now(),
 		IsV2:     isV2,
+		closing:  make(chan []byte, 1),
+		done:     make(chan struct{}),
 	}
 
-	// 获取或创建房间
-	room := s.getOrCreateRoom(roomID, isV2)
-
-	// 添加客户端到房间
-	room.addClient(client)
+	// 加入房间，新建的房间在 s.mu 之外订阅背板（涉及网络 I/O）
+	room, created := s.joinRoom(roomID, isV2, client)
+	if created {
+		s.subscribeRoom(room, isV2)
+	}
 
-	log.Printf("✅ 新客户端连接 [房间: %s] [客户端: %s] [来自: %s]", roomID, client.ID[:8], r.RemoteAddr)
-	log.Printf("📊 房间 [%s] 当前客户端数: %d", roomID, room.getClientCount())
+	slog.Info("新客户端连接", "room", roomID, "client", shortID(client.ID), "remote", remoteIP, "v2", isV2, "clients", room.getClientCount())
 
 	// 启动读写协程
 	go s.readPump(client, room)
 	go s.writePump(client, room)
 }
 
-// getOrCreateRoom 获取或创建房间
-func (s *RelayServer) getOrCreateRoom(roomID string, isV2 bool) *Room {
+// joinRoom 把客户端加入房间，房间不存在时创建（created 为 true）
+// 创建与加入在同一次加锁中完成，新房间不会在加入前被当作空房间删除
+func (s *RelayServer) joinRoom(roomID string, isV2 bool, client *Client) (room *Room, created bool) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -139,14 +360,93 @@ func (s *RelayServer) getOrCreateRoom(roomID string, isV2 bool) *Room {
 			Clients: make(map[string]*Client),
 		}
 		targetMap[roomID] = room
-		vStr := "V1"
-		if isV2 {
-			vStr = "V2"
+		created = true
+		slog.Info("创建新房间", "room", roomID, "v2", isV2)
+	}
+	room.addClient(client)
+
+	return room, created
+}
+
+// subscribeRoom 订阅房间的背板消息，把其他实例发布的消息转发给本地客户端
+// 调用方不能持有 s.mu：订阅可能需要访问 Redis
+func (s *RelayServer) subscribeRoom(room *Room, isV2 bool) {
+	s.mu.RLock()
+	backplane := s.backplane
+	s.mu.RUnlock()
+
+	if backplane == nil {
+		return
+	}
+
+	unsubscribe, err := backplane.Subscribe(roomKey(room.ID, isV2), func(env Envelope) {
+		if env.Origin == s.instanceID {
+			return
+		}
+		room.broadcast(Message{Type: env.Type, Data: env.Data}, "")
+	})
+	if err != nil {
+		slog.Error("订阅背板房间失败", "room", room.ID, "error", err)
+		return
+	}
+
+	room.mu.Lock()
+	closed := room.closed
+	if !closed {
+		room.unsubscribe = unsubscribe
+	}
+	room.mu.Unlock()
+
+	// 订阅期间房间已被删除
+	if closed {
+		unsubscribe()
+	}
+}
+
+// close 标记房间已移除，返回需要调用的取消订阅函数（可能为 nil）
+func (r *Room) close() func() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closed = true
+	unsubscribe := r.unsubscribe
+	r.unsubscribe = nil
+	return unsubscribe
+}
+
+// publish 把本地客户端的消息发布到背板
+// header 为 V2 帧头（其他消息为 nil）：分片条目以整个条目为单位发布，
+// 某个分片发布失败后同一条目的其余分片不再发布
+func (s *RelayServer) publish(client *Client, msg Message, header *frameHeader) {
+	s.mu.RLock()
+	backplane := s.backplane
+	s.mu.RUnlock()
+
+	if backplane == nil {
+		return
+	}
+
+	env := Envelope{
+		Origin:   s.instanceID,
+		Room:     roomKey(client.RoomID, client.IsV2),
+		ClientID: client.ID,
+		Type:     msg.Type,
+		Data:     msg.Data,
+	}
+	content := header != nil && header.isContent()
+	if content && header.Seq > 0 {
+		if client.skipUnpublished && client.unpublished == header.MsgID {
+			return
 		}
-		log.Printf("🏠 创建新房间 (%s): %s", vStr, roomID)
+		env.Continued = true
 	}
 
-	return room
+	if err := backplane.Publish(env); err != nil {
+		if content && !header.isLast() {
+			client.unpublished = header.MsgID
+			client.skipUnpublished = true
+		}
+		slog.Error("发布到背板失败", "room", client.RoomID, "client", shortID(client.ID), "error", err)
+	}
 }
 
 // addClient 添加客户端到房间
@@ -170,29 +470,69 @@ func (r *Room) getClientCount() int {
 	return len(r.Clients)
 }
 
-// broadcast 广播消息给房间内所有客户端（除了发送者）
-func (r *Room) broadcast(msg Message, excludeID string) {
+// broadcast 广播消息给房间内所有客户端（除了发送者），
+// 返回实际放入发送队列的客户端 ID -> 成员 UUID（尚未发送首帧时为空）
+func (r *Room) broadcast(msg Message, excludeID string) map[string]string {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
+	sent := make(map[string]string, len(r.Clients))
 	for id, client := range r.Clients {
-		if id != excludeID {
-			select {
-			case client.Send <- msg:
-			default:
-				log.Printf("⚠️  客户端 %s 发送队列已满", id[:8])
-			}
+		if id == excludeID {
+			continue
+		}
+		if client.trySend(msg) {
+			sent[id] = client.SenderUUID
+		} else {
+			slog.Warn("客户端发送队列已满", "room", r.ID, "client", shortID(id))
 		}
 	}
+	return sent
+}
+
+// RoomMember 房间成员信息（成员列表接口返回）
+type RoomMember struct {
+	ID          string `json:"id"`               // 连接 ID（缩写）
+	Sender      string `json:"sender,omitempty"` // 发送者 UUID，尚未发送帧时为空
+	Name        string `json:"name,omitempty"`
+	OS          string `json:"os,omitempty"`
+	ConnectedAt int64  `json:"connectedAt"` // 连接时间（毫秒时间戳）
+}
+
+// members 获取房间内的在线成员，按连接时间排序
+func (r *Room) members() []RoomMember {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	members := make([]RoomMember, 0, len(r.Clients))
+	for id, client := range r.Clients {
+		members = append(members, RoomMember{
+			ID:          shortID(id),
+			Sender:      client.SenderUUID,
+			Name:        client.DeviceName,
+			OS:          client.Platform,
+			ConnectedAt: client.ConnTime.UnixMilli(),
+		})
+	}
+	sort.Slice(members, func(i, j int) bool {
+		return members[i].ConnectedAt < members[j].ConnectedAt
+	})
+	return members
 }
 
 // readPump 读取客户端消息
 func (s *RelayServer) readPump(client *Client, room *Room) {
 	defer func() {
+		close(client.done)
 		room.removeClient(client)
 		client.Conn.Close()
-		log.Printf("👋 客户端断开 [房间: %s] [客户端: %s]", client.RoomID, client.ID[:8])
-		log.Printf("📊 房间 [%s] 当前客户端数: %d", client.RoomID, room.getClientCount())
+		s.mu.RLock()
+		mailbox := s.mailbox
+		s.mu.RUnlock()
+		if mailbox != nil && client.IsV2 {
+			mailbox.Leave(client.RoomID, client.ID)
+		}
+		slog.Info("客户端断开", "room", client.RoomID, "client", shortID(client.ID), "clients", room.getClientCount())
 
 		// 如果房间为空，删除房间
 		if room.getClientCount() == 0 {
@@ -210,15 +550,140 @@ func (s *RelayServer) readPump(client *Client, room *Room) {
 		msgType, message, err := client.Conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				log.Printf("❌ 客户端异常断开 [房间: %s] [客户端: %s]: %v", client.RoomID, client.ID[:8], err)
+				slog.Warn("客户端异常断开", "room", client.RoomID, "client", shortID(client.ID), "error", err)
 			}
 			break
 		}
 
 		// 转发消息给房间内其他客户端
-		// log.Printf("📨 转发消息 [房间: %s] [来自: %s] [类型: %d] [大小: %d 字节]", client.RoomID, client.ID[:8], msgType, len(message))
-		room.broadcast(Message{Type: msgType, Data: message}, client.ID)
+		slog.Debug("转发消息", "room", client.RoomID, "client", shortID(client.ID), "type", msgType, "size", len(message))
+		msg := Message{Type: msgType, Data: message}
+		sent := room.broadcast(msg, client.ID)
+
+		var header *frameHeader
+		if client.IsV2 && msgType == websocket.BinaryMessage {
+			if h, ok := parseFrameHeader(message); ok {
+				header = &h
+			}
+		}
+		s.publish(client, msg, header)
+
+		if header != nil {
+			if header.isContent() {
+				client.inFlight.Store(!header.isLast())
+			}
+			s.trackFrame(client, room, *header, message, sent)
+		}
+	}
+}
+
+// trackFrame 跟踪 V2 帧：识别成员身份，并为离线信箱收集完整条目
+// sent 为该帧实际转发到的本地连接及其成员，条目的接收者是收到了全部分片的连接
+func (s *RelayServer) trackFrame(client *Client, room *Room, header frameHeader, data []byte, sent map[string]string) {
+	s.mu.RLock()
+	mailbox := s.mailbox
+	s.mu.RUnlock()
+
+	// 首个帧确定成员身份，补发离线条目
+	if client.SenderUUID == "" {
+		room.mu.Lock()
+		client.SenderUUID = header.Sender
+		room.mu.Unlock()
+
+		if mailbox != nil {
+			s.deliverMailbox(mailbox, client)
+		}
+	}
+
+	if header.Type == frameTypeHandshake {
+		if info, ok := parseHandshake(data); ok {
+			room.mu.Lock()
+			client.DeviceName = info.Name
+			client.Platform = info.OS
+			room.mu.Unlock()
+		}
+	}
+
+	if mailbox == nil || !header.isContent() {
+		return
+	}
+
+	if header.Seq == 0 {
+		client.pendingItem = &MailboxItem{
+			ID:     fmt.Sprintf("%s-%d", header.Sender, header.MsgID),
+			Sender: header.Sender,
+			Type:   header.Type,
+		}
+		client.pendingMsg = header.MsgID
+		client.pendingRecipients = sent
+	} else if client.pendingItem == nil || client.pendingMsg != header.MsgID {
+		return
+	} else {
+		// 任一分片未能放入发送队列的连接没有收到完整条目；期间识别的成员以最新的为准
+		for id := range client.pendingRecipients {
+			member, ok := sent[id]
+			if !ok {
+				delete(client.pendingRecipients, id)
+			} else if member != "" {
+				client.pendingRecipients[id] = member
+			}
+		}
+	}
+
+	item := client.pendingItem
+	item.Frames = append(item.Frames, data)
+	item.Size += int64(len(data))
+
+	// 超过单房间容量的条目直接放弃
+	if maxBytes := mailbox.MaxBytes(); maxBytes > 0 && item.Size > maxBytes {
+		client.pendingItem = nil
+		client.pendingRecipients = nil
+		return
+	}
+
+	if header.isLast() {
+		recipients := client.pendingRecipients
+		client.pendingItem = nil
+		client.pendingRecipients = nil
+		mailbox.Put(client.RoomID, item, recipients)
+	}
+}
+
+// deliverMailbox 向刚加入的成员补发离线条目
+// 补发期间持有 client.sendMu：容量检查与发送之间不会插入广播，条目的分片连续发出
+func (s *RelayServer) deliverMailbox(mailbox *Mailbox, client *Client) {
+	items := mailbox.Pending(client.RoomID, client.SenderUUID, client.ID)
+	if len(items) == 0 {
+		return
 	}
+
+	client.sendMu.Lock()
+	delivered := make([]string, 0, len(items))
+	for _, item := range items {
+		// 发送队列放不下整个条目时停止，剩余条目下次重连再投递
+		if cap(client.Send)-len(client.Send) < len(item.Frames) {
+			break
+		}
+		complete := true
+		for _, frame := range item.Frames {
+			select {
+			case client.Send <- Message{Type: websocket.BinaryMessage, Data: frame}:
+			default:
+				complete = false
+			}
+			if !complete {
+				break
+			}
+		}
+		if !complete {
+			break
+		}
+		delivered = append(delivered, item.ID)
+	}
+	client.sendMu.Unlock()
+
+	mailbox.MarkDelivered(client.RoomID, client.SenderUUID, delivered)
+	slog.Info("补发离线条目", "room", client.RoomID, "client", shortID(client.ID), "delivered", len(delivered), "pending", len(items))
 }
 
 // writePump 向客户端发送消息
@@ -247,15 +712,40 @@ func (s *RelayServer) writePump(client *Client, _ *Room) {
 			if err := client.Conn.WriteMessage(websocket.PingMessage, nil); err != nil {
 				return
 			}
+
+		case closeMsg := <-client.closing:
+			// 先把队列中已有的消息发完，再发送 Close 帧
+			for {
+				select {
+				case msg := <-client.Send:
+					client.Conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+					if err := client.Conn.WriteMessage(msg.Type, msg.Data); err != nil {
+						return
+					}
+					continue
+				default:
+				}
+				break
+			}
+			client.Conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			client.Conn.WriteMessage(websocket.CloseMessage, closeMsg)
+
+			// 等待客户端回应 Close 帧
+			select {
+			case <-client.done:
+			case <-time.After(time.Second):
+			}
+			return
+
+		case <-client.done:
+			return
 		}
 	}
 }
 
-// removeRoom 删除空房间
+// removeRoom 删除空房间，在 s.mu 之外取消背板订阅
 func (s *RelayServer) removeRoom(roomID string, isV2 bool) {
 	s.mu.Lock()
-	defer s.mu.Unlock()
-
 	var targetMap map[string]*Room
 	if isV2 {
 		targetMap = s.roomsV2
@@ -263,34 +753,55 @@ func (s *RelayServer) removeRoom(roomID string, isV2 bool) {
 		targetMap = s.roomsV1
 	}
 
-	if room, exists := targetMap[roomID]; exists {
-		if room.getClientCount() == 0 {
-			delete(targetMap, roomID)
-			vStr := "V1"
-			if isV2 {
-				vStr = "V2"
-			}
-			log.Printf("🗑️  删除空房间 (%s): %s", vStr, roomID)
-		}
+	var unsubscribe func()
+	room, exists := targetMap[roomID]
+	removed := exists && room.getClientCount() == 0
+	if removed {
+		delete(targetMap, roomID)
+		unsubscribe = room.close()
 	}
-}
+	s.mu.Unlock()
 
-// Shutdown 关闭服务器
-func (s *RelayServer) Shutdown() {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	if unsubscribe != nil {
+		unsubscribe()
+	}
+	if removed {
+		slog.Info("删除空房间", "room", roomID, "v2", isV2)
+	}
+}
 
-	log.Printf("🔄 正在关闭所有连接...")
+// Shutdown 优雅关闭服务器
+// 1. 拒绝新的连接
+// 2. 等待进行中的分片传输完成（最长到 ctx 截止）
+// 3. 向所有客户端发送 "going away" Close 帧，附带重连提示
+// 4. 等待客户端断开，超时后强制关闭剩余连接
+func (s *RelayServer) Shutdown(ctx context.Context, reconnectAfter time.Duration) {
+	s.reconnectAfter = reconnectAfter
+	s.draining.Store(true)
+
+	slog.Info("正在等待进行中的传输完成", "inFlight", s.countInFlight())
+	s.waitUntil(ctx, func() bool { return s.countInFlight() == 0 })
+
+	slog.Info("正在关闭所有连接", "clients", s.countClients())
+	reason := reconnectHint(reconnectAfter)
+	s.forEachClient(func(client *Client) {
+		client.requestClose(websocket.CloseGoingAway, reason)
+	})
+	s.waitUntil(ctx, func() bool { return s.countClients() == 0 })
 
+	s.mu.Lock()
+	var unsubscribes []func()
 	closeRooms := func(rooms map[string]*Room) {
 		for roomID, room := range rooms {
 			room.mu.Lock()
 			for _, client := range room.Clients {
-				close(client.Send)
 				client.Conn.Close()
 			}
 			room.mu.Unlock()
-			log.Printf("✅ 房间 [%s] 已关闭", roomID)
+			if unsubscribe := room.close(); unsubscribe != nil {
+				unsubscribes = append(unsubscribes, unsubscribe)
+			}
+			slog.Info("房间已关闭", "room", roomID)
 		}
 	}
 
@@ -299,7 +810,65 @@ func (s *RelayServer) Shutdown() {
 
 	s.roomsV1 = make(map[string]*Room)
 	s.roomsV2 = make(map[string]*Room)
-	log.Printf("✅ 所有连接已关闭")
+	s.mu.Unlock()
+
+	for _, unsubscribe := range unsubscribes {
+		unsubscribe()
+	}
+	slog.Info("所有连接已关闭")
+}
+
+// waitUntil 轮询等待条件满足或 ctx 结束
+func (s *RelayServer) waitUntil(ctx context.Context, cond func() bool) {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for !cond() {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// forEachClient 遍历所有房间的客户端
+func (s *RelayServer) forEachClient(fn func(client *Client)) {
+	s.mu.RLock()
+	rooms := make([]*Room, 0, len(s.roomsV1)+len(s.roomsV2))
+	for _, room := range s.roomsV1 {
+		rooms = append(rooms, room)
+	}
+	for _, room := range s.roomsV2 {
+		rooms = append(rooms, room)
+	}
+	s.mu.RUnlock()
+
+	for _, room := range rooms {
+		room.mu.RLock()
+		for _, client := range room.Clients {
+			fn(client)
+		}
+		room.mu.RUnlock()
+	}
+}
+
+// countClients 统计所有在线客户端数量
+func (s *RelayServer) countClients() int {
+	count := 0
+	s.forEachClient(func(*Client) { count++ })
+	return count
+}
+
+// countInFlight 统计正在发送分片条目的客户端数量
+func (s *RelayServer) countInFlight() int {
+	count := 0
+	s.forEachClient(func(client *Client) {
+		if client.inFlight.Load() {
+			count++
+		}
+	})
+	return count
 }
 
 // GetStats 获取服务器统计信息
@@ -0,0 +1,455 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+// ==========================================
+// 端到端测试
+// ==========================================
+//
+// 中继通过 httptest 在回环地址上运行，测试客户端直接收发 V1.1 二进制帧，
+// 检查房间隔离、分片顺序、成员列表、离线信箱与优雅关闭。
+
+// timeout 等待消息的期限
+const timeout = 5 * time.Second
+
+func TestMain(m *testing.M) {
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	os.Exit(m.Run())
+}
+
+// newTestRelay 以默认配置启动中继，mailbox 为 nil 时不开启离线信箱
+func newTestRelay(t *testing.T, mailbox *Mailbox) (*RelayServer, *httptest.Server) {
+	t.Helper()
+	relay := NewRelayServer(nil)
+	if mailbox != nil {
+		relay.SetMailbox(mailbox)
+		t.Cleanup(mailbox.Close)
+	}
+	ts := httptest.NewServer(newMux(relay))
+	t.Cleanup(ts.Close)
+	return relay, ts
+}
+
+// testFrame 构造 V1.1 二进制帧
+func testFrame(msgType, flags uint8, msgID, seq uint32, sender [16]byte, payload []byte) []byte {
+	frame := make([]byte, frameHeaderSize, frameHeaderSize+len(payload))
+	binary.BigEndian.PutUint16(frame[0:2], frameMagic)
+	frame[2] = 1<<4 | msgType
+	frame[3] = flags
+	binary.BigEndian.PutUint32(frame[5:9], msgID)
+	binary.BigEndian.PutUint32(frame[9:13], seq)
+	copy(frame[13:29], sender[:])
+	binary.BigEndian.PutUint32(frame[29:33], uint32(len(payload)))
+	return append(frame, payload...)
+}
+
+// peer 测试客户端
+type peer struct {
+	t      *testing.T
+	conn   *websocket.Conn
+	sender [16]byte
+	recv   chan Message
+	err    error // 连接结束的原因，recv 关闭后可读取
+}
+
+// dial 连接到中继的指定路径，sender 为空时分配新的发送者 UUID
+func dial(t *testing.T, ts *httptest.Server, path string, sender [16]byte) *peer {
+	t.Helper()
+	url := "ws" + strings.TrimPrefix(ts.URL, "http") + path
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("连接 %s 失败: %v", path, err)
+	}
+	if sender == ([16]byte{}) {
+		sender = [16]byte(uuid.New())
+	}
+	p := &peer{t: t, conn: conn, sender: sender, recv: make(chan Message, 64)}
+	go func() {
+		defer close(p.recv)
+		for {
+			msgType, data, err := conn.ReadMessage()
+			if err != nil {
+				p.err = err
+				return
+			}
+			p.recv <- Message{Type: msgType, Data: data}
+		}
+	}()
+	t.Cleanup(func() { conn.Close() })
+	return p
+}
+
+// send 发送一条消息
+func (p *peer) send(msgType int, data []byte) {
+	p.t.Helper()
+	if err := p.conn.WriteMessage(msgType, data); err != nil {
+		p.t.Fatalf("发送失败: %v", err)
+	}
+}
+
+// handshake 发送握手帧
+func (p *peer) handshake(name string) {
+	p.t.Helper()
+	payload, _ := json.Marshal(handshakeInfo{Name: name, OS: "test"})
+	p.send(websocket.BinaryMessage, testFrame(frameTypeHandshake, 0, 1, 0, p.sender, payload))
+}
+
+// leave 正常关闭连接，等待中继确认
+func (p *peer) leave() {
+	p.t.Helper()
+	p.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	p.closed()
+}
+
+// next 等待下一条消息
+func (p *peer) next() Message {
+	p.t.Helper()
+	select {
+	case msg, ok := <-p.recv:
+		if !ok {
+			p.t.Fatalf("等待消息时连接已结束: %v", p.err)
+		}
+		return msg
+	case <-time.After(timeout):
+		p.t.Fatalf("等待消息超时")
+	}
+	return Message{}
+}
+
+// expect 等待下一条消息并检查内容
+func (p *peer) expect(msgType int, data []byte) {
+	p.t.Helper()
+	msg := p.next()
+	if msg.Type != msgType || !bytes.Equal(msg.Data, data) {
+		p.t.Fatalf("收到 (%d, %q)，期望 (%d, %q)", msg.Type, abbrev(msg.Data), msgType, abbrev(data))
+	}
+}
+
+// expectNone 在 d 时间内没有收到消息
+func (p *peer) expectNone(d time.Duration) {
+	p.t.Helper()
+	select {
+	case msg, ok := <-p.recv:
+		if !ok {
+			p.t.Fatalf("连接意外结束: %v", p.err)
+		}
+		p.t.Fatalf("收到意外的消息 (%d, %q)", msg.Type, abbrev(msg.Data))
+	case <-time.After(d):
+	}
+}
+
+// closed 等待连接结束，返回结束原因
+func (p *peer) closed() error {
+	p.t.Helper()
+	deadline := time.After(timeout)
+	for {
+		select {
+		case _, ok := <-p.recv:
+			if !ok {
+				return p.err
+			}
+		case <-deadline:
+			p.t.Fatalf("等待连接结束超时")
+		}
+	}
+}
+
+// abbrev 截短过长的消息内容，用于失败信息
+func abbrev(data []byte) []byte {
+	if len(data) > 48 {
+		return data[:48]
+	}
+	return data
+}
+
+// roomMembers 查询 V2 房间成员
+func roomMembers(t *testing.T, ts *httptest.Server, room string) []RoomMember {
+	t.Helper()
+	resp, err := http.Get(ts.URL + "/v2/rooms/" + room + "/members")
+	if err != nil {
+		t.Fatalf("查询成员失败: %v", err)
+	}
+	defer resp.Body.Close()
+	var body struct {
+		Count   int          `json:"count"`
+		Members []RoomMember `json:"members"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("解析成员列表失败: %v", err)
+	}
+	if body.Count != len(body.Members) {
+		t.Fatalf("count = %d，成员 %d 个", body.Count, len(body.Members))
+	}
+	return body.Members
+}
+
+// eventually 轮询等待条件成立
+func eventually(t *testing.T, cond func() bool, message string) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("超时: %s", message)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRoomIsolationAndNoEcho(t *testing.T) {
+	_, ts := newTestRelay(t, nil)
+	alice := dial(t, ts, "/ws/room-1", [16]byte{})
+	bob := dial(t, ts, "/ws/room-1", [16]byte{})
+	other := dial(t, ts, "/ws/room-2", [16]byte{})
+	v2 := dial(t, ts, "/v2/ws/room-1", [16]byte{}) // 同名的 V2 房间与 V1 房间互相独立
+
+	alice.send(websocket.TextMessage, []byte("hello room-1"))
+	bob.expect(websocket.TextMessage, []byte("hello room-1"))
+
+	other.send(websocket.TextMessage, []byte("hello room-2"))
+	alice.expectNone(200 * time.Millisecond)
+	bob.expectNone(0)
+	other.expectNone(0)
+	v2.expectNone(0)
+}
+
+func TestChunkedItemRelayedInOrder(t *testing.T) {
+	_, ts := newTestRelay(t, nil)
+	alice := dial(t, ts, "/v2/ws/room", [16]byte{})
+	bob := dial(t, ts, "/v2/ws/room", [16]byte{})
+
+	var frames [][]byte
+	for seq := uint32(0); seq < 20; seq++ {
+		flags := frameFlagMF
+		if seq == 0 {
+			flags |= frameFlagHasMeta
+		}
+		if seq == 19 {
+			flags = 0
+		}
+		chunk := bytes.Repeat([]byte{byte(seq)}, 64*1024)
+		frames = append(frames, testFrame(frameTypeImage, flags, 7, seq, alice.sender, chunk))
+	}
+	for _, frame := range frames {
+		alice.send(websocket.BinaryMessage, frame)
+	}
+	for seq, frame := range frames {
+		msg := bob.next()
+		if !bytes.Equal(msg.Data, frame) {
+			header, _ := parseFrameHeader(msg.Data)
+			t.Fatalf("第 %d 帧不符：收到 seq=%d", seq, header.Seq)
+		}
+	}
+	alice.expectNone(100 * time.Millisecond)
+}
+
+func TestRoomMembers(t *testing.T) {
+	_, ts := newTestRelay(t, nil)
+	alice := dial(t, ts, "/v2/ws/room", [16]byte{})
+	bob := dial(t, ts, "/v2/ws/room", [16]byte{})
+	alice.handshake("alice")
+	bob.handshake("bob")
+
+	eventually(t, func() bool {
+		members := roomMembers(t, ts, "room")
+		return len(members) == 2 && members[0].Name != "" && members[1].Name != ""
+	}, "等待两个成员完成握手")
+	names := map[string]string{}
+	for _, m := range roomMembers(t, ts, "room") {
+		names[m.Name] = m.Sender
+	}
+	if names["alice"] != hex.EncodeToString(alice.sender[:]) || names["bob"] != hex.EncodeToString(bob.sender[:]) {
+		t.Fatalf("成员列表 = %v", names)
+	}
+
+	bob.leave()
+	eventually(t, func() bool { return len(roomMembers(t, ts, "room")) == 1 }, "等待 bob 离开")
+	if members := roomMembers(t, ts, "room"); members[0].Name != "alice" {
+		t.Fatalf("剩余成员 = %+v", members)
+	}
+	if members := roomMembers(t, ts, "empty"); len(members) != 0 {
+		t.Fatalf("不存在的房间成员 = %+v", members)
+	}
+}
+
+func TestRoomMembersPartialWithBackplane(t *testing.T) {
+	health := func(ts *httptest.Server) []string {
+		t.Helper()
+		var body struct {
+			Features []string `json:"features"`
+		}
+		resp, err := http.Get(ts.URL + "/health")
+		if err != nil {
+			t.Fatalf("健康检查失败: %v", err)
+		}
+		defer resp.Body.Close()
+		json.NewDecoder(resp.Body).Decode(&body)
+		return body.Features
+	}
+	partial := func(ts *httptest.Server) bool {
+		t.Helper()
+		var body struct {
+			Partial bool `json:"partial"`
+		}
+		resp, err := http.Get(ts.URL + "/v2/rooms/room/members")
+		if err != nil {
+			t.Fatalf("查询成员失败: %v", err)
+		}
+		defer resp.Body.Close()
+		json.NewDecoder(resp.Body).Decode(&body)
+		return body.Partial
+	}
+
+	// 单实例：成员列表完整，公布 room-members 能力
+	_, single := newTestRelay(t, nil)
+	if features := health(single); !slices.Contains(features, "room-members") || partial(single) {
+		t.Fatalf("单实例 features = %v，partial = %v", features, partial(single))
+	}
+
+	// 配置了背板：成员列表只含本实例，不公布该能力
+	relay := NewRelayServer(nil)
+	relay.SetBackplane(NewMemoryBackplane())
+	multi := httptest.NewServer(newMux(relay))
+	t.Cleanup(multi.Close)
+	if features := health(multi); slices.Contains(features, "room-members") || !partial(multi) {
+		t.Fatalf("多实例 features = %v，partial = %v", features, partial(multi))
+	}
+}
+
+func TestMailboxDeliversOnReconnect(t *testing.T) {
+	mailbox := NewMailbox(MailboxConfig{MaxItems: 10, MaxBytes: 1 << 20, TTL: time.Hour}, NewMemoryMailboxStore())
+	_, ts := newTestRelay(t, mailbox)
+
+	alice := dial(t, ts, "/v2/ws/room", [16]byte{})
+	bob := dial(t, ts, "/v2/ws/room", [16]byte{})
+	alice.handshake("alice")
+	bob.handshake("bob")
+	eventually(t, func() bool {
+		members := roomMembers(t, ts, "room")
+		return len(members) == 2 && members[0].Sender != "" && members[1].Sender != ""
+	}, "等待两个成员完成握手")
+
+	bob.leave()
+	eventually(t, func() bool { return len(roomMembers(t, ts, "room")) == 1 }, "等待 bob 离开")
+
+	// bob 离线期间的两个条目（一个分片条目）存入信箱
+	text := testFrame(frameTypeText, 0, 2, 0, alice.sender, []byte("离线期间的文本"))
+	imageStart := testFrame(frameTypeImage, frameFlagMF|frameFlagHasMeta, 3, 0, alice.sender, []byte("start"))
+	imageEnd := testFrame(frameTypeImage, 0, 3, 1, alice.sender, []byte("end"))
+	for _, frame := range [][]byte{text, imageStart, imageEnd} {
+		alice.send(websocket.BinaryMessage, frame)
+	}
+
+	eventually(t, func() bool {
+		mailbox.mu.Lock()
+		defer mailbox.mu.Unlock()
+		return len(mailbox.load("room").Items) == 2
+	}, "等待条目存入信箱")
+
+	// 同一发送者 UUID 重新连接，握手后按顺序补发
+	bob = dial(t, ts, "/v2/ws/room", bob.sender)
+	bob.handshake("bob")
+	bob.expect(websocket.BinaryMessage, text)
+	bob.expect(websocket.BinaryMessage, imageStart)
+	bob.expect(websocket.BinaryMessage, imageEnd)
+
+	// 每个条目只投递一次
+	bob.leave()
+	bob = dial(t, ts, "/v2/ws/room", bob.sender)
+	bob.handshake("bob")
+	bob.expectNone(200 * time.Millisecond)
+}
+
+func TestMailboxSkipsItemsReceivedBeforeFirstFrame(t *testing.T) {
+	mailbox := NewMailbox(MailboxConfig{MaxItems: 10, MaxBytes: 1 << 20, TTL: time.Hour}, NewMemoryMailboxStore())
+	_, ts := newTestRelay(t, mailbox)
+
+	alice := dial(t, ts, "/v2/ws/room", [16]byte{})
+	bob := dial(t, ts, "/v2/ws/room", [16]byte{})
+	alice.handshake("alice")
+	bob.handshake("bob")
+	eventually(t, func() bool {
+		members := roomMembers(t, ts, "room")
+		return len(members) == 2 && members[0].Sender != "" && members[1].Sender != ""
+	}, "等待两个成员完成握手")
+	bob.leave()
+	eventually(t, func() bool { return len(roomMembers(t, ts, "room")) == 1 }, "等待 bob 离开")
+
+	// bob 重新连接、尚未发送首帧时实时收到条目
+	bob = dial(t, ts, "/v2/ws/room", bob.sender)
+	eventually(t, func() bool { return len(roomMembers(t, ts, "room")) == 2 }, "等待 bob 重新连接")
+	text := testFrame(frameTypeText, 0, 2, 0, alice.sender, []byte("bob 识别前的文本"))
+	alice.send(websocket.BinaryMessage, text)
+	bob.expect(websocket.BinaryMessage, text)
+
+	// 识别后不再补发同一条目
+	bob.handshake("bob")
+	bob.expectNone(200 * time.Millisecond)
+	eventually(t, func() bool {
+		mailbox.mu.Lock()
+		defer mailbox.mu.Unlock()
+		return len(mailbox.load("room").Items) == 0
+	}, "等待信箱移除已实时收到的条目")
+}
+
+func TestShutdownDrainsTransfersAndHintsReconnect(t *testing.T) {
+	relay, ts := newTestRelay(t, nil)
+	alice := dial(t, ts, "/v2/ws/room", [16]byte{})
+	bob := dial(t, ts, "/v2/ws/room", [16]byte{})
+
+	start := testFrame(frameTypeImage, frameFlagMF|frameFlagHasMeta, 1, 0, alice.sender, []byte("start"))
+	end := testFrame(frameTypeImage, 0, 1, 1, alice.sender, []byte("end"))
+	alice.send(websocket.BinaryMessage, start)
+	bob.expect(websocket.BinaryMessage, start)
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		relay.Shutdown(ctx, 5*time.Second)
+		close(done)
+	}()
+
+	// 关闭期间拒绝新连接，并提示重连时间
+	eventually(t, relay.draining.Load, "等待开始关闭")
+	url := "ws" + strings.TrimPrefix(ts.URL, "http") + "/v2/ws/room"
+	_, resp, err := websocket.DefaultDialer.Dial(url, nil)
+	if err == nil || resp == nil || resp.StatusCode != http.StatusServiceUnavailable || resp.Header.Get("Retry-After") != "5" {
+		t.Fatalf("关闭期间的新连接应返回 503 与 Retry-After: 5，实际 err=%v resp=%v", err, resp)
+	}
+
+	// 进行中的分片传输完成后才断开
+	bob.expectNone(200 * time.Millisecond)
+	alice.send(websocket.BinaryMessage, end)
+	bob.expect(websocket.BinaryMessage, end)
+
+	for _, p := range []*peer{alice, bob} {
+		var closeErr *websocket.CloseError
+		if err := p.closed(); !errors.As(err, &closeErr) || closeErr.Code != websocket.CloseGoingAway || closeErr.Text != "reconnect-after=5" {
+			t.Fatalf("关闭原因 = %v，期望 1001 reconnect-after=5", err)
+		}
+	}
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		t.Fatal("Shutdown 未返回")
+	}
+}
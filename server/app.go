@@ -2,44 +2,91 @@ package main
 
 import (
 	"context"
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"slices"
+	"strings"
 	"sync"
+	"time"
 
 	"server/internal/clipboard"
+	"server/internal/device"
+	"server/internal/hub"
+	"server/internal/identity"
+	"server/internal/logging"
+	"server/internal/protocol"
+	"server/internal/relay"
+	"server/internal/settings"
 	ws "server/internal/websocket"
 
+	"github.com/google/uuid"
 	"github.com/wailsapp/wails/v2/pkg/runtime"
 )
 
-// LogEntry 日志条目
-type LogEntry struct {
-	Level     string `json:"level"`
-	Message   string `json:"message"`
-	Timestamp int64  `json:"timestamp"`
-}
-
 // App struct（V1.1 二进制协议版本）
 type App struct {
 	ctx          context.Context
+	settings     *settings.Store
+	settingsErr  error // 加载设置失败的原因，启动后写入日志
+	identity     *identity.Identity
+	identityErr  error               // 加载设备身份失败的原因（本次运行使用临时身份）
+	device       protocol.DeviceInfo // 检测到的本机设备信息（设备名称为主机名）
 	wsServer     *ws.Server
-	wsClient     *ws.WSClient
+	connMgr      *hub.ConnectionManager // 本机服务器与所有出站连接
+	primaryID    string                 // 客户端模式下界面操作的主连接
+	relay        *relaySession          // 主连接为中继房间时的房间信息
+	connMu       sync.Mutex
 	clipboardMon *clipboard.Monitor
-	logs         []LogEntry
-	logsMu       sync.RWMutex
-	maxLogs      int
-	mode         string // "server" 或 "client"
+	monitorMu    sync.Mutex
+	logger       *logging.Logger
+	transfers    *ws.TransferTracker // 本机服务器与出站连接的分片传输进度
+	mode         string              // "server" 或 "client"（界面模式，服务器与出站连接可同时运行）
+	startedAt    time.Time
 }
 
 // NewApp creates a new App application struct
 func NewApp() *App {
-	return &App{
-		wsServer:     ws.NewServer(),
-		wsClient:     ws.NewWSClient("NextPaste Desktop", "Windows"),
+	// 设置文件不可用时只在内存中保存设置
+	path, pathErr := settings.DefaultPath()
+	store := settings.NewStore(path)
+	loadErr := store.Load()
+
+	// 设备身份需在创建服务器与客户端（协议管理器）之前确定
+	id, idErr := loadIdentity()
+	protocol.SetDeviceUUID(id.UUID)
+
+	detected := device.Detect("", appVersion)
+	logger := logging.New(store.Get().Limits.MaxLogs)
+
+	transfers := ws.NewTransferTracker()
+	wsServer := ws.NewServer()
+	wsServer.SetProtocolLogCallback(logger.Callback(logging.ComponentProtocol))
+	wsServer.SetTransferTracker(transfers)
+	a := &App{
+		settings:     store,
+		settingsErr:  errors.Join(pathErr, loadErr),
+		identity:     id,
+		identityErr:  idErr,
+		device:       detected,
+		wsServer:     wsServer,
+		connMgr:      hub.NewConnectionManager(wsServer, detected),
 		clipboardMon: clipboard.NewMonitor(),
-		logs:         make([]LogEntry, 0),
-		maxLogs:      500,
-		mode:         "server", // 默认为服务器模式
+		logger:       logger,
+		transfers:    transfers,
+		startedAt:    time.Now(),
 	}
+	logger.SetSink(a.onLogAppended)
+	a.connMgr.SetLogCallback(logger.Callback(logging.ComponentClient))
+	a.connMgr.SetProtocolLogCallback(logger.Callback(logging.ComponentProtocol))
+	a.connMgr.SetTransferTracker(transfers)
+	transfers.SetCallback(a.onTransferProgress)
+	a.connMgr.SetPeerErrorCallback(a.onPeerError)
+	a.connMgr.SetLocalCallback(a.onClipboardReceivedBinary)
+	a.connMgr.SetActivityCallback(func() { a.refreshMonitor() })
+	a.connMgr.SetStateCallback(a.onConnectionState)
+	a.applySettings(store.Get())
+	return a
 }
 
 // ============================================
@@ -65,12 +112,23 @@ func (a *App) Quit() {
 // so we can call the runtime methods
 func (a *App) startup(ctx context.Context) {
 	a.ctx = ctx
+
+	if a.settingsErr != nil {
+		a.log(logging.ComponentApp, "WARNING", fmt.Sprintf("加载设置失败，使用默认设置: %v", a.settingsErr))
+	}
+	if a.identityErr != nil {
+		a.log(logging.ComponentApp, "WARNING", fmt.Sprintf("加载设备身份失败，本次运行使用临时身份: %v", a.identityErr))
+	}
+	if a.settings.Get().AutoStart {
+		go a.resumeSync()
+	}
 }
 
 // shutdown is called when the app is closing
 func (a *App) shutdown(ctx context.Context) {
 	a.StopServer()
-	a.DisconnectClient()
+	a.connMgr.RemoveAllClients()
+	a.logger.Close()
 }
 
 // StartServer 启动 WebSocket 服务器
@@ -79,77 +137,256 @@ func (a *App) StartServer(address string, port int) error {
 		return fmt.Errorf("服务器已在运行中")
 	}
 
-	// 设置剪贴板数据接收回调（V1.1 二进制协议）
-	a.wsServer.SetClipboardCallback(a.onClipboardReceivedBinary)
-
-	// 启动 WebSocket 服务器
-	err := a.wsServer.Start(address, port, a.onLog)
+	// 启动 WebSocket 服务器（收到的数据由连接管理器处理）
+	err := a.wsServer.Start(address, port, a.logger.Callback(logging.ComponentServer))
 	if err != nil {
 		return err
 	}
 
 	// 启动剪贴板监听
-	err = a.clipboardMon.Start(a.onClipboardChange)
-	if err != nil {
+	if err := a.refreshMonitor(); err != nil {
 		a.wsServer.Stop()
 		return err
 	}
 
+	a.mode = settings.ModeServer
+	a.saveSettings(func(s *settings.Settings) {
+		s.Mode = settings.ModeServer
+		s.Server.Address = address
+		s.Server.Port = port
+	})
 	return nil
 }
 
 // StopServer 停止 WebSocket 服务器
 func (a *App) StopServer() error {
-	if a.mode == "server" {
-		a.clipboardMon.Stop()
-	}
-	return a.wsServer.Stop()
+	err := a.wsServer.Stop()
+	a.refreshMonitor()
+	return err
 }
 
-// ConnectClient 连接到远程 WebSocket 服务器（客户端模式）
+// ConnectClient 连接到远程 WebSocket 服务器（客户端模式的主连接）
 func (a *App) ConnectClient(url string) error {
-	if a.wsClient.IsConnected() {
-		return fmt.Errorf("客户端已连接")
+	a.connMu.Lock()
+	err := a.connectPrimary(url)
+	a.connMu.Unlock()
+	if err != nil {
+		return err
 	}
 
-	a.mode = "client"
-
-	// 设置剪贴板数据接收回调（V1.1 二进制协议）
-	a.wsClient.SetClipboardCallback(a.onClipboardReceivedBinary)
+	a.saveSettings(func(s *settings.Settings) {
+		s.Mode = settings.ModeClient
+		s.Client.URL = url
+		s.Client.UseRelay = false
+	})
+	return nil
+}
 
-	// 设置连接成功回调 - 只有连接成功后才启动剪贴板监听
-	a.wsClient.SetOnConnected(func() {
-		a.onLog("INFO", "WebSocket 连接成功，启动剪贴板监听...")
-		err := a.clipboardMon.Start(a.onClipboardChangeClient)
-		if err != nil {
-			a.onLog("ERROR", fmt.Sprintf("启动剪贴板监听失败: %v", err))
-		} else {
-			a.onLog("SUCCESS", "剪贴板监听已启动")
+// connectPrimary 建立主连接（调用方需持有 a.connMu）
+func (a *App) connectPrimary(url string) error {
+	if a.primaryID != "" {
+		if client := a.connMgr.Client(a.primaryID); client != nil && client.IsActive() {
+			return fmt.Errorf("客户端已连接")
 		}
-	})
+		a.connMgr.RemoveClient(a.primaryID)
+		a.primaryID = ""
+	}
+
+	a.mode = settings.ModeClient
+	a.relay = nil
 
-	// 连接到服务器（异步，会自动重连）
-	err := a.wsClient.Connect(url, a.onLog)
+	// 连接到服务器（异步，会自动重连；连接成功后才启动剪贴板监听）
+	id, err := a.connMgr.AddClient(url)
 	if err != nil {
 		return err
 	}
-
+	a.primaryID = id
 	return nil
 }
 
-// DisconnectClient 断开客户端连接
+// DisconnectClient 断开客户端主连接
 func (a *App) DisconnectClient() error {
-	a.clipboardMon.Stop()
-	return a.wsClient.Disconnect()
+	a.connMu.Lock()
+	defer a.connMu.Unlock()
+
+	if a.primaryID == "" {
+		return nil
+	}
+	err := a.connMgr.RemoveClient(a.primaryID)
+	a.primaryID = ""
+	a.relay = nil
+	return err
+}
+
+// AddConnection 新增一个出站连接（可与本机服务器、其他连接同时运行），返回连接 ID
+func (a *App) AddConnection(url string) (string, error) {
+	return a.connMgr.AddClient(url)
+}
+
+// RemoveConnection 断开并移除出站连接
+func (a *App) RemoveConnection(id string) error {
+	a.connMu.Lock()
+	if id == a.primaryID {
+		a.primaryID = ""
+		a.relay = nil
+	}
+	a.connMu.Unlock()
+	return a.connMgr.RemoveClient(id)
 }
 
-// GetClientStatus 获取客户端状态
+// GetClientStatus 获取客户端状态（主连接状态 + 所有出站连接）
 func (a *App) GetClientStatus() map[string]any {
+	a.connMu.Lock()
+	primaryID := a.primaryID
+	a.connMu.Unlock()
+
+	status := map[string]any{
+		"isConnected": false,
+		"state":       ws.StateDisconnected,
+		"latencyMs":   int64(0),
+		"primaryId":   primaryID,
+		"connections": a.connMgr.ClientStatuses(),
+	}
+	if client := a.connMgr.Client(primaryID); client != nil {
+		status["isConnected"] = client.IsConnected()
+		status["state"] = client.State()
+		status["latencyMs"] = client.Latency().Milliseconds()
+	}
+	return status
+}
+
+// ============================================
+// 中继房间
+// ============================================
+
+// relaySession 通过中继服务器加入的房间
+type relaySession struct {
+	baseURL         string
+	roomID          string
+	token           string
+	supportsMembers bool // 中继服务器是否提供房间成员接口
+}
+
+// GenerateRoomID 生成随机房间 ID
+func (a *App) GenerateRoomID() (string, error) {
+	return relay.GenerateRoomID()
+}
+
+// CheckRelay 检查中继服务器是否可用，返回其支持的能力
+func (a *App) CheckRelay(baseURL string) (*relay.Health, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return relay.CheckHealth(ctx, baseURL)
+}
+
+// ConnectRelay 校验中继服务器后加入房间（作为客户端模式的主连接），返回房间信息
+func (a *App) ConnectRelay(baseURL, roomID, token string) (map[string]any, error) {
+	health, err := a.CheckRelay(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	url, err := relay.RoomURL(baseURL, roomID, token)
+	if err != nil {
+		return nil, err
+	}
+
+	a.connMu.Lock()
+	if err := a.connectPrimary(url); err != nil {
+		a.connMu.Unlock()
+		return nil, err
+	}
+	a.relay = &relaySession{
+		baseURL:         baseURL,
+		roomID:          roomID,
+		token:           token,
+		supportsMembers: health.Supports(relay.FeatureRoomMembers),
+	}
+	a.connMu.Unlock()
+
+	a.saveSettings(func(s *settings.Settings) {
+		s.Mode = settings.ModeClient
+		s.Client.UseRelay = true
+		s.Client.Relay = settings.RelaySettings{BaseURL: baseURL, RoomID: roomID, Token: token}
+	})
+	a.log(logging.ComponentRelay, "INFO", fmt.Sprintf("加入中继房间: %s", roomID))
+	return a.GetRelayInfo(), nil
+}
+
+// GetRelayInfo 获取当前中继房间信息（分享链接即二维码内容）
+func (a *App) GetRelayInfo() map[string]any {
+	a.connMu.Lock()
+	session := a.relay
+	a.connMu.Unlock()
+
+	if session == nil {
+		return map[string]any{"active": false}
+	}
+	shareLink, _ := relay.ShareLink(session.baseURL, session.roomID)
 	return map[string]any{
-		"isConnected": a.wsClient.IsConnected(),
+		"active":          true,
+		"baseUrl":         session.baseURL,
+		"roomId":          session.roomID,
+		"shareLink":       shareLink,
+		"supportsMembers": session.supportsMembers,
+	}
+}
+
+// GetRelayMembers 获取当前中继房间的在线成员
+func (a *App) GetRelayMembers() ([]relay.Member, error) {
+	a.connMu.Lock()
+	session := a.relay
+	a.connMu.Unlock()
+
+	if session == nil {
+		return nil, fmt.Errorf("未加入中继房间")
+	}
+	if !session.supportsMembers {
+		return nil, fmt.Errorf("中继服务器不支持查询房间成员")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return relay.FetchMembers(ctx, session.baseURL, session.roomID, session.token)
+}
+
+// onConnectionState 出站连接状态变化，推送给前端（连接中、已连接、等待重试、已放弃）
+func (a *App) onConnectionState(id string, event ws.ConnectionStateEvent) {
+	if a.ctx == nil {
+		return
+	}
+	runtime.EventsEmit(a.ctx, "connection:state", event)
+
+	a.connMu.Lock()
+	primary := id == a.primaryID
+	a.connMu.Unlock()
+	if primary {
+		runtime.EventsEmit(a.ctx, "client:state", event)
 	}
 }
 
+// refreshMonitor 按需启停剪贴板监听：
+// 本机服务器在运行，或有出站连接成功连接过（重连期间继续监听，变化进入离线队列）时监听
+func (a *App) refreshMonitor() error {
+	a.monitorMu.Lock()
+	defer a.monitorMu.Unlock()
+
+	want := a.wsServer.IsRunning() || a.connMgr.HasEstablishedClients()
+	running := a.clipboardMon.IsRunning()
+
+	switch {
+	case want && !running:
+		if err := a.clipboardMon.Start(a.onClipboardChange); err != nil {
+			a.log(logging.ComponentMonitor, "ERROR", fmt.Sprintf("启动剪贴板监听失败: %v", err))
+			return err
+		}
+		a.log(logging.ComponentMonitor, "SUCCESS", "剪贴板监听已启动")
+	case !want && running:
+		a.clipboardMon.Stop()
+		a.log(logging.ComponentMonitor, "INFO", "剪贴板监听已停止")
+	}
+	return nil
+}
+
 // GetServerStatus 获取服务器状态
 func (a *App) GetServerStatus() map[string]any {
 	return map[string]any{
@@ -158,6 +395,54 @@ func (a *App) GetServerStatus() map[string]any {
 	}
 }
 
+// GetClients 获取连接到本机服务器的客户端（含握手中的设备详情）
+func (a *App) GetClients() []map[string]interface{} {
+	return a.wsServer.GetClients()
+}
+
+// GetStatistics 获取同步统计：全局合计、本机服务器（含各客户端）与各出站连接
+func (a *App) GetStatistics() map[string]any {
+	stats := a.connMgr.Statistics()
+	return map[string]any{
+		"uptimeSec":   int64(time.Since(a.startedAt) / time.Second),
+		"global":      stats.Global,
+		"server":      stats.Server,
+		"connections": stats.Connections,
+	}
+}
+
+// ResetStatistics 清零所有同步统计
+func (a *App) ResetStatistics() {
+	a.connMgr.ResetStatistics()
+	a.log(logging.ComponentApp, "INFO", "同步统计已清零")
+}
+
+// GetActiveTransfers 获取进行中的分片传输（发送与接收）
+func (a *App) GetActiveTransfers() []ws.TransferProgress {
+	return a.transfers.Active()
+}
+
+// CancelTransfer 取消进行中的分片传输
+func (a *App) CancelTransfer(id string) error {
+	return a.transfers.Cancel(id)
+}
+
+// onTransferProgress 传输进度推送给前端（已节流）
+func (a *App) onTransferProgress(progress ws.TransferProgress) {
+	if a.ctx == nil {
+		return
+	}
+	runtime.EventsEmit(a.ctx, "transfer:progress", progress)
+}
+
+// onPeerError 对端拒绝了本机发出的消息，推送给界面提示用户
+func (a *App) onPeerError(e ws.PeerError) {
+	if a.ctx == nil {
+		return
+	}
+	runtime.EventsEmit(a.ctx, "sync:error", e)
+}
+
 // GetMode 获取当前模式
 func (a *App) GetMode() string {
 	return a.mode
@@ -168,81 +453,334 @@ func (a *App) GetLocalIPs() ([]string, error) {
 	return a.wsServer.GetLocalIPs()
 }
 
-// GetLogs 获取日志列表
-func (a *App) GetLogs() []LogEntry {
-	a.logsMu.RLock()
-	defer a.logsMu.RUnlock()
+// GetAllowedOrigins 获取允许连接本机服务器的浏览器来源
+func (a *App) GetAllowedOrigins() []string {
+	return a.wsServer.AllowedOrigins()
+}
 
-	// 返回副本
-	logs := make([]LogEntry, len(a.logs))
-	copy(logs, a.logs)
-	return logs
+// SetAllowedOrigins 设置并保存允许连接本机服务器的浏览器来源（默认拒绝所有浏览器来源）
+func (a *App) SetAllowedOrigins(origins []string) error {
+	if origins == nil {
+		origins = []string{}
+	}
+	if err := a.settings.Modify(func(s *settings.Settings) {
+		s.Server.AllowedOrigins = origins
+	}); err != nil {
+		return err
+	}
+	a.wsServer.SetAllowedOrigins(origins)
+	return nil
 }
 
-// ClearLogs 清空日志
-func (a *App) ClearLogs() {
-	a.logsMu.Lock()
-	defer a.logsMu.Unlock()
-	a.logs = make([]LogEntry, 0)
-	runtime.EventsEmit(a.ctx, "logs:updated", a.logs)
+// ============================================
+// 已连接设备管理
+// ============================================
+
+// KickClient 断开连接到本机服务器的客户端，对方收到后不再自动重连
+func (a *App) KickClient(id string) error {
+	return a.wsServer.KickClient(id, "")
 }
 
-// onLog 日志回调
-func (a *App) onLog(level, message string) {
-	a.logsMu.Lock()
-	defer a.logsMu.Unlock()
+// BlockDevice 屏蔽设备（按设备 UUID）：立即断开并在之后的握手中拒绝，屏蔽列表随设置保存
+func (a *App) BlockDevice(deviceID string) error {
+	id, err := canonicalDeviceID(deviceID)
+	if err != nil {
+		return err
+	}
+	if err := a.settings.Modify(func(s *settings.Settings) {
+		if !slices.Contains(s.Server.BlockedDevices, id) {
+			s.Server.BlockedDevices = append(s.Server.BlockedDevices, id)
+		}
+	}); err != nil {
+		return err
+	}
+	a.log(logging.ComponentServer, "INFO", fmt.Sprintf("已屏蔽设备: %s", id))
+	return a.wsServer.SetBlockedDevices(a.settings.Get().Server.BlockedDevices)
+}
 
-	entry := LogEntry{
-		Level:     level,
-		Message:   message,
-		Timestamp: 0,
+// UnblockDevice 取消屏蔽设备
+func (a *App) UnblockDevice(deviceID string) error {
+	id, err := canonicalDeviceID(deviceID)
+	if err != nil {
+		return err
+	}
+	if err := a.settings.Modify(func(s *settings.Settings) {
+		s.Server.BlockedDevices = slices.DeleteFunc(s.Server.BlockedDevices, func(blocked string) bool {
+			return blocked == id
+		})
+	}); err != nil {
+		return err
 	}
+	a.log(logging.ComponentServer, "INFO", fmt.Sprintf("已取消屏蔽设备: %s", id))
+	return a.wsServer.SetBlockedDevices(a.settings.Get().Server.BlockedDevices)
+}
+
+// GetBlockedDevices 获取已屏蔽的设备 UUID
+func (a *App) GetBlockedDevices() []string {
+	return a.settings.Get().Server.BlockedDevices
+}
 
-	a.logs = append([]LogEntry{entry}, a.logs...)
-	if len(a.logs) > a.maxLogs {
-		a.logs = a.logs[:a.maxLogs]
+// SetDeviceAlias 设置设备别名（仅在本机显示），alias 为空时删除别名
+func (a *App) SetDeviceAlias(deviceID, alias string) error {
+	id, err := canonicalDeviceID(deviceID)
+	if err != nil {
+		return err
 	}
+	alias = strings.TrimSpace(alias)
+	if err := a.settings.Modify(func(s *settings.Settings) {
+		if alias == "" {
+			delete(s.Server.DeviceAliases, id)
+		} else {
+			s.Server.DeviceAliases[id] = alias
+		}
+	}); err != nil {
+		return err
+	}
+	return a.wsServer.SetDeviceAliases(a.settings.Get().Server.DeviceAliases)
+}
 
-	// 发送事件到前端
-	runtime.EventsEmit(a.ctx, "logs:updated", a.logs)
+// canonicalDeviceID 把设备 UUID（标准格式或握手中的十六进制）转换为设置中保存的标准格式
+func canonicalDeviceID(deviceID string) (string, error) {
+	u, err := uuid.Parse(strings.TrimSpace(deviceID))
+	if err != nil {
+		return "", fmt.Errorf("设备 UUID 无效: %s", deviceID)
+	}
+	return u.String(), nil
 }
 
-// onClipboardChange 剪贴板变化回调（服务器模式，V1.1 二进制协议）
-func (a *App) onClipboardChange(data clipboard.ClipboardData) {
-	switch data.Type {
-	case "text":
-		a.onLog("INFO", fmt.Sprintf("检测到剪贴板文本变化: %d 字符", len(data.Content)))
-	case "image":
-		sizeMB := float64(len(data.Content)) / 1024 / 1024
-		a.onLog("INFO", fmt.Sprintf("检测到剪贴板图片变化: %.2f MB", sizeMB))
+// ============================================
+// 设备身份
+// ============================================
+
+// loadIdentity 加载持久化的设备身份，失败时生成本次运行使用的临时身份
+func loadIdentity() (*identity.Identity, error) {
+	path, err := identity.DefaultPath()
+	if err == nil {
+		var id *identity.Identity
+		if id, _, err = identity.LoadOrCreate(path); err == nil {
+			return id, nil
+		}
+	}
+
+	id, genErr := identity.Generate()
+	if genErr != nil {
+		// 随机数源不可用时无法继续运行
+		panic(genErr)
+	}
+	return id, err
+}
+
+// GetDeviceIdentity 获取本机设备身份（UUID 与公钥指纹）与设备信息
+func (a *App) GetDeviceIdentity() map[string]any {
+	name := a.settings.Get().Device.Name
+	if name == "" {
+		name = a.device.Name
+	}
+	return map[string]any{
+		"uuid":        a.identity.UUIDString(),
+		"fingerprint": a.identity.Fingerprint(),
+		"publicKey":   base64.StdEncoding.EncodeToString(a.identity.PublicKey()),
+		"persistent":  a.identityErr == nil,
+		"deviceName":  name,
+		"hostname":    a.device.Name,
+		"platform":    a.device.OS,
+		"arch":        a.device.Arch,
+		"osVersion":   a.device.OSVersion,
+		"appVersion":  a.device.AppVersion,
+		"deviceClass": a.device.DeviceClass,
+	}
+}
+
+// ============================================
+// 设置
+// ============================================
+
+// GetSettings 获取应用设置
+func (a *App) GetSettings() settings.Settings {
+	return a.settings.Get()
+}
+
+// UpdateSettings 校验并保存应用设置，立即生效（连接参数对之后的连接生效）
+func (a *App) UpdateSettings(s settings.Settings) error {
+	if err := a.settings.Update(s); err != nil {
+		return err
+	}
+	a.applySettings(a.settings.Get())
+	a.log(logging.ComponentApp, "INFO", "设置已保存")
+	return nil
+}
+
+// ImportLegacySettings 导入旧版本前端保存的设置（JSON），由设置迁移转换为当前版本
+func (a *App) ImportLegacySettings(data string) error {
+	if err := a.settings.Import([]byte(data)); err != nil {
+		return err
+	}
+	a.applySettings(a.settings.Get())
+	a.log(logging.ComponentApp, "INFO", "已导入旧版本设置")
+	return nil
+}
+
+// applySettings 把设置应用到各模块
+func (a *App) applySettings(s settings.Settings) {
+	info := a.device
+	if s.Device.Name != "" {
+		info.Name = s.Device.Name
+	}
+	protocol.SetFrameChecksum(s.FrameChecksum)
+	limits := ws.Limits{
+		MaxFrameSize:    int64(s.Limits.MaxFrameSizeMB) << 20,
+		MaxItemSize:     int64(s.Limits.MaxItemSizeMB) << 20,
+		MaxBufferedSize: int64(s.Limits.MaxBufferedMB) << 20,
+		SpillThreshold:  int64(s.Limits.SpillThresholdMB) << 20,
+		MaxSpilledSize:  int64(s.Limits.MaxSpilledMB) << 20,
+	}
+	a.connMgr.SetDevice(info)
+	a.wsServer.SetDevice(info)
+	a.connMgr.SetClientOptions(hub.ClientOptions{
+		ReconnectPolicy: ws.ReconnectPolicy{
+			InitialDelay: s.Reconnect.InitialDelay(),
+			MaxDelay:     s.Reconnect.MaxDelay(),
+			Multiplier:   s.Reconnect.Multiplier,
+			Jitter:       s.Reconnect.Jitter,
+			MaxAttempts:  s.Reconnect.MaxAttempts,
+		},
+		OfflineQueueSize:  s.Limits.OfflineQueueSize,
+		HeartbeatInterval: s.Heartbeat.Interval(),
+		HeartbeatTimeout:  s.Heartbeat.Timeout(),
+		Limits:            limits,
+	})
+	a.wsServer.SetAllowedOrigins(s.Server.AllowedOrigins)
+	a.wsServer.SetHandshakeTimeout(time.Duration(s.Server.HandshakeTimeoutSec) * time.Second)
+	a.wsServer.SetLimits(limits)
+	if err := a.wsServer.SetSlowConsumerPolicy(s.Server.SlowConsumer); err != nil {
+		a.log(logging.ComponentApp, "WARNING", fmt.Sprintf("应用慢速客户端策略失败: %v", err))
+	}
+	if err := a.wsServer.SetBlockedDevices(s.Server.BlockedDevices); err != nil {
+		a.log(logging.ComponentApp, "WARNING", fmt.Sprintf("应用设备屏蔽列表失败: %v", err))
+	}
+	if err := a.wsServer.SetDeviceAliases(s.Server.DeviceAliases); err != nil {
+		a.log(logging.ComponentApp, "WARNING", fmt.Sprintf("应用设备别名失败: %v", err))
+	}
+
+	a.logger.SetCapacity(s.Limits.MaxLogs)
+	a.logger.SetLevel(s.Logging.Level)
+	if s.Logging.File {
+		path, err := logging.DefaultPath()
+		if err == nil {
+			err = a.logger.EnableFile(path, s.Logging.MaxFileBytes(), s.Logging.MaxFiles)
+		}
+		if err != nil {
+			a.log(logging.ComponentApp, "WARNING", fmt.Sprintf("开启日志文件失败: %v", err))
+		}
+	} else {
+		a.logger.DisableFile()
+	}
+
+	a.connMu.Lock()
+	if a.primaryID == "" && !a.wsServer.IsRunning() {
+		a.mode = s.Mode
+	}
+	a.connMu.Unlock()
+}
+
+// saveSettings 修改并保存部分设置，失败时只记录日志
+func (a *App) saveSettings(fn func(*settings.Settings)) {
+	if err := a.settings.Modify(fn); err != nil {
+		a.log(logging.ComponentApp, "WARNING", fmt.Sprintf("保存设置失败: %v", err))
+	}
+}
+
+// resumeSync 按上次的模式自动恢复同步（设置中开启 autoStart 时启动后调用）
+func (a *App) resumeSync() {
+	s := a.settings.Get()
+
+	var err error
+	switch {
+	case s.Mode == settings.ModeServer:
+		err = a.StartServer(s.Server.Address, s.Server.Port)
+	case s.Client.UseRelay:
+		_, err = a.ConnectRelay(s.Client.Relay.BaseURL, s.Client.Relay.RoomID, s.Client.Relay.Token)
+	case s.Client.URL != "":
+		err = a.ConnectClient(s.Client.URL)
 	default:
 		return
 	}
 
-	// 广播给所有客户端（V1.1 二进制协议）
-	err := a.wsServer.BroadcastClipboardBinary(data.Type, data.Content)
 	if err != nil {
-		a.onLog("ERROR", fmt.Sprintf("广播剪贴板数据失败: %v", err))
+		a.log(logging.ComponentApp, "ERROR", fmt.Sprintf("自动恢复同步失败: %v", err))
+		return
 	}
+	a.log(logging.ComponentApp, "SUCCESS", "已自动恢复上次的同步")
 }
 
-// onClipboardChangeClient 剪贴板变化回调（客户端模式，V1.1 二进制协议）
-func (a *App) onClipboardChangeClient(data clipboard.ClipboardData) {
+// ============================================
+// 日志
+// ============================================
+
+// GetLogs 获取内存中的日志，按时间从旧到新
+func (a *App) GetLogs() []logging.Entry {
+	return a.logger.Entries()
+}
+
+// ClearLogs 清空内存中的日志（日志文件不受影响）
+func (a *App) ClearLogs() {
+	a.logger.Clear()
+	if a.ctx != nil {
+		runtime.EventsEmit(a.ctx, "logs:cleared")
+	}
+}
+
+// ExportLogs 导出内存中的日志为文本文件，path 为空时弹出保存对话框
+// 返回实际保存的路径，用户取消对话框时返回空字符串
+func (a *App) ExportLogs(path string) (string, error) {
+	if path == "" {
+		var err error
+		path, err = runtime.SaveFileDialog(a.ctx, runtime.SaveDialogOptions{
+			Title:           "导出日志",
+			DefaultFilename: fmt.Sprintf("nextpaste-%s.log", time.Now().Format("20060102-150405")),
+			Filters: []runtime.FileFilter{
+				{DisplayName: "日志文件 (*.log;*.txt)", Pattern: "*.log;*.txt"},
+			},
+		})
+		if err != nil || path == "" {
+			return "", err
+		}
+	}
+
+	if err := a.logger.Export(path); err != nil {
+		return "", err
+	}
+	a.log(logging.ComponentApp, "SUCCESS", fmt.Sprintf("日志已导出: %s", path))
+	return path, nil
+}
+
+// log 记录带组件标签的日志
+func (a *App) log(component, level, message string) {
+	a.logger.Log(component, level, message)
+}
+
+// onLogAppended 新日志推送给前端（启动前的日志由前端通过 GetLogs 获取）
+func (a *App) onLogAppended(entry logging.Entry) {
+	if a.ctx == nil {
+		return
+	}
+	runtime.EventsEmit(a.ctx, "logs:appended", entry)
+}
+
+// onClipboardChange 剪贴板变化回调（V1.1 二进制协议）
+func (a *App) onClipboardChange(data clipboard.ClipboardData) {
 	switch data.Type {
 	case "text":
-		a.onLog("INFO", fmt.Sprintf("检测到剪贴板文本变化: %d 字符", len(data.Content)))
+		a.log(logging.ComponentMonitor, "INFO", fmt.Sprintf("检测到剪贴板文本变化: %d 字符", len(data.Content)))
 	case "image":
 		sizeMB := float64(len(data.Content)) / 1024 / 1024
-		a.onLog("INFO", fmt.Sprintf("检测到剪贴板图片变化: %.2f MB", sizeMB))
+		a.log(logging.ComponentMonitor, "INFO", fmt.Sprintf("检测到剪贴板图片变化: %.2f MB", sizeMB))
 	default:
 		return
 	}
 
-	// 发送给服务器（V1.1 二进制协议）
-	err := a.wsClient.SendClipboardBinary(data.Type, data.Content)
-	if err != nil {
-		a.onLog("ERROR", fmt.Sprintf("发送剪贴板数据失败: %v", err))
-	}
+	// 发布给本机服务器的客户端与所有出站连接
+	a.connMgr.PublishLocal(data.Type, data.Content)
 }
 
 // onClipboardReceivedBinary 接收到远程剪贴板数据回调（V1.1 二进制协议）
@@ -264,15 +802,15 @@ func (a *App) onClipboardReceivedBinary(dataType string, content []byte) {
 
 	err := a.clipboardMon.SetClipboard(data)
 	if err != nil {
-		a.onLog("ERROR", fmt.Sprintf("写入剪贴板失败: %v", err))
+		a.log(logging.ComponentMonitor, "ERROR", fmt.Sprintf("写入剪贴板失败: %v", err))
 		return
 	}
 
 	switch dataType {
 	case "text":
-		a.onLog("SUCCESS", fmt.Sprintf("已接收并写入文本数据: %d 字符", len(content)))
+		a.log(logging.ComponentMonitor, "SUCCESS", fmt.Sprintf("已接收并写入文本数据: %d 字符", len(content)))
 	case "image":
 		sizeMB := float64(len(content)) / 1024 / 1024
-		a.onLog("SUCCESS", fmt.Sprintf("已接收并写入图片数据: %.2f MB", sizeMB))
+		a.log(logging.ComponentMonitor, "SUCCESS", fmt.Sprintf("已接收并写入图片数据: %.2f MB", sizeMB))
 	}
 }
@@ -1,7 +1,9 @@
 export interface LogEntry {
+  id: number
   level: string
+  component: string // app、server、client、monitor、protocol、relay
   message: string
-  timestamp: number
+  timestamp: number // 毫秒时间戳
 }
 
 export interface ServerStatus {
@@ -9,8 +11,131 @@ export interface ServerStatus {
   clientCount: number
 }
 
+export interface ConnectedClient {
+  id: string
+  deviceId?: string
+  alias?: string // 服务器端设置的别名
+  deviceName: string
+  platform: string
+  arch?: string
+  osVersion?: string
+  appVersion?: string
+  deviceClass?: string
+  connTime: string
+}
+
 export interface ServerConfig {
   address: string
   port: number
 }
 
+
+export type ClientConnectionState = 'disconnected' | 'connecting' | 'connected' | 'backing-off' | 'failed'
+
+export interface ClientStateEvent {
+  state: ClientConnectionState
+  url: string
+  attempt: number
+  nextAttemptAt?: number
+  error?: string
+}
+
+export interface RelayForm {
+  baseUrl: string
+  roomId: string
+  token: string
+}
+
+export interface RelayInfo {
+  active: boolean
+  baseUrl?: string
+  roomId?: string
+  shareLink?: string
+  supportsMembers?: boolean
+}
+
+export interface RelayMember {
+  id: string
+  sender?: string
+  name?: string
+  os?: string
+  connectedAt: number
+}
+
+export type TransferDirection = 'send' | 'receive'
+
+export type TransferState = 'active' | 'completed' | 'cancelled' | 'failed'
+
+export interface TransferProgress {
+  id: string
+  direction: TransferDirection
+  peer: string
+  dataType: string
+  mime: string
+  bytesDone: number
+  total: number
+  bytesPerSec: number
+  etaMs: number // -1 表示无法估计
+  startedAt: number
+  state: TransferState
+}
+
+// 对端回复的错误消息（拒绝了本机发出的数据）
+export interface PeerError {
+  peer: string
+  code: string // too_large / buffer_full / unsupported_type / bad_meta / not_handshaken / bad_handshake
+  msgId: number
+  reason: string
+  timestamp: number
+}
+
+export interface TrafficStats {
+  textItems: number
+  textBytes: number
+  imageItems: number
+  imageBytes: number
+}
+
+export interface StatsSnapshot {
+  sent: TrafficStats
+  received: TrafficStats
+  dropped: number
+  parseErrors: number
+  corrupt: number // 帧校验或内容哈希不匹配而丢弃的条目
+  coalesced: number // latest 策略下被更新条目替换而未发送的条目
+  slowDisconnect: number // 因接收过慢被断开的次数
+  lastActivity: number // 毫秒时间戳，0 表示没有
+  avgLatencyMs: number
+  latencySamples: number
+  since: number
+}
+
+export interface ClientStatistics {
+  id: string
+  deviceName: string
+  connectedSec: number
+  stats: StatsSnapshot
+}
+
+export interface ServerStatistics {
+  running: boolean
+  uptimeSec: number
+  totals: StatsSnapshot
+  clients: ClientStatistics[]
+}
+
+export interface ConnectionStatistics {
+  id: string
+  url: string
+  state: ClientConnectionState
+  connectedSec: number
+  latencyMs: number
+  stats: StatsSnapshot
+}
+
+export interface SyncStatistics {
+  uptimeSec: number
+  global: StatsSnapshot
+  server: ServerStatistics
+  connections: ConnectionStatistics[]
+}
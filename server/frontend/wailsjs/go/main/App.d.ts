@@ -1,29 +1,80 @@
 // Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
 // This file is automatically generated. DO NOT EDIT
-import {main} from '../models';
+import {logging} from '../models';
+import {relay} from '../models';
+import {settings} from '../models';
+import {websocket} from '../models';
+
+export function AddConnection(arg1:string):Promise<string>;
+
+export function BlockDevice(arg1:string):Promise<void>;
+
+export function CancelTransfer(arg1:string):Promise<void>;
+
+export function CheckRelay(arg1:string):Promise<relay.Health>;
 
 export function ClearLogs():Promise<void>;
 
 export function ConnectClient(arg1:string):Promise<void>;
 
+export function ConnectRelay(arg1:string,arg2:string,arg3:string):Promise<Record<string, any>>;
+
 export function DisconnectClient():Promise<void>;
 
+export function ExportLogs(arg1:string):Promise<string>;
+
+export function GenerateRoomID():Promise<string>;
+
+export function GetActiveTransfers():Promise<Array<websocket.TransferProgress>>;
+
+export function GetAllowedOrigins():Promise<Array<string>>;
+
+export function GetBlockedDevices():Promise<Array<string>>;
+
 export function GetClientStatus():Promise<Record<string, any>>;
 
+export function GetClients():Promise<Array<Record<string, any>>>;
+
+export function GetDeviceIdentity():Promise<Record<string, any>>;
+
 export function GetLocalIPs():Promise<Array<string>>;
 
-export function GetLogs():Promise<Array<main.LogEntry>>;
+export function GetLogs():Promise<Array<logging.Entry>>;
 
 export function GetMode():Promise<string>;
 
+export function GetRelayInfo():Promise<Record<string, any>>;
+
+export function GetRelayMembers():Promise<Array<relay.Member>>;
+
 export function GetServerStatus():Promise<Record<string, any>>;
 
+export function GetSettings():Promise<settings.Settings>;
+
+export function GetStatistics():Promise<Record<string, any>>;
+
 export function HideWindow():Promise<void>;
 
+export function ImportLegacySettings(arg1:string):Promise<void>;
+
+export function KickClient(arg1:string):Promise<void>;
+
 export function Quit():Promise<void>;
 
+export function RemoveConnection(arg1:string):Promise<void>;
+
+export function ResetStatistics():Promise<void>;
+
+export function SetAllowedOrigins(arg1:Array<string>):Promise<void>;
+
+export function SetDeviceAlias(arg1:string,arg2:string):Promise<void>;
+
 export function ShowWindow():Promise<void>;
 
 export function StartServer(arg1:string,arg2:number):Promise<void>;
 
 export function StopServer():Promise<void>;
+
+export function UnblockDevice(arg1:string):Promise<void>;
+
+export function UpdateSettings(arg1:settings.Settings):Promise<void>;
@@ -2,6 +2,22 @@
 // Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
 // This file is automatically generated. DO NOT EDIT
 
+export function AddConnection(arg1) {
+  return window['go']['main']['App']['AddConnection'](arg1);
+}
+
+export function BlockDevice(arg1) {
+  return window['go']['main']['App']['BlockDevice'](arg1);
+}
+
+export function CancelTransfer(arg1) {
+  return window['go']['main']['App']['CancelTransfer'](arg1);
+}
+
+export function CheckRelay(arg1) {
+  return window['go']['main']['App']['CheckRelay'](arg1);
+}
+
 export function ClearLogs() {
   return window['go']['main']['App']['ClearLogs']();
 }
@@ -10,14 +26,46 @@ export function ConnectClient(arg1) {
   return window['go']['main']['App']['ConnectClient'](arg1);
 }
 
+export function ConnectRelay(arg1, arg2, arg3) {
+  return window['go']['main']['App']['ConnectRelay'](arg1, arg2, arg3);
+}
+
 export function DisconnectClient() {
   return window['go']['main']['App']['DisconnectClient']();
 }
 
+export function ExportLogs(arg1) {
+  return window['go']['main']['App']['ExportLogs'](arg1);
+}
+
+export function GenerateRoomID() {
+  return window['go']['main']['App']['GenerateRoomID']();
+}
+
+export function GetActiveTransfers() {
+  return window['go']['main']['App']['GetActiveTransfers']();
+}
+
+export function GetAllowedOrigins() {
+  return window['go']['main']['App']['GetAllowedOrigins']();
+}
+
+export function GetBlockedDevices() {
+  return window['go']['main']['App']['GetBlockedDevices']();
+}
+
 export function GetClientStatus() {
   return window['go']['main']['App']['GetClientStatus']();
 }
 
+export function GetClients() {
+  return window['go']['main']['App']['GetClients']();
+}
+
+export function GetDeviceIdentity() {
+  return window['go']['main']['App']['GetDeviceIdentity']();
+}
+
 export function GetLocalIPs() {
   return window['go']['main']['App']['GetLocalIPs']();
 }
@@ -30,18 +78,58 @@ export function GetMode() {
   return window['go']['main']['App']['GetMode']();
 }
 
+export function GetRelayInfo() {
+  return window['go']['main']['App']['GetRelayInfo']();
+}
+
+export function GetRelayMembers() {
+  return window['go']['main']['App']['GetRelayMembers']();
+}
+
 export function GetServerStatus() {
   return window['go']['main']['App']['GetServerStatus']();
 }
 
+export function GetSettings() {
+  return window['go']['main']['App']['GetSettings']();
+}
+
+export function GetStatistics() {
+  return window['go']['main']['App']['GetStatistics']();
+}
+
 export function HideWindow() {
   return window['go']['main']['App']['HideWindow']();
 }
 
+export function ImportLegacySettings(arg1) {
+  return window['go']['main']['App']['ImportLegacySettings'](arg1);
+}
+
+export function KickClient(arg1) {
+  return window['go']['main']['App']['KickClient'](arg1);
+}
+
 export function Quit() {
   return window['go']['main']['App']['Quit']();
 }
 
+export function RemoveConnection(arg1) {
+  return window['go']['main']['App']['RemoveConnection'](arg1);
+}
+
+export function ResetStatistics() {
+  return window['go']['main']['App']['ResetStatistics']();
+}
+
+export function SetAllowedOrigins(arg1) {
+  return window['go']['main']['App']['SetAllowedOrigins'](arg1);
+}
+
+export function SetDeviceAlias(arg1, arg2) {
+  return window['go']['main']['App']['SetDeviceAlias'](arg1, arg2);
+}
+
 export function ShowWindow() {
   return window['go']['main']['App']['ShowWindow']();
 }
@@ -53,3 +141,11 @@ export function StartServer(arg1, arg2) {
 export function StopServer() {
   return window['go']['main']['App']['StopServer']();
 }
+
+export function UnblockDevice(arg1) {
+  return window['go']['main']['App']['UnblockDevice'](arg1);
+}
+
+export function UpdateSettings(arg1) {
+  return window['go']['main']['App']['UpdateSettings'](arg1);
+}
@@ -1,17 +1,21 @@
-export namespace main {
+export namespace logging {
 	
-	export class LogEntry {
+	export class Entry {
+	    id: number;
 	    level: string;
+	    component: string;
 	    message: string;
 	    timestamp: number;
 	
 	    static createFrom(source: any = {}) {
-	        return new LogEntry(source);
+	        return new Entry(source);
 	    }
 	
 	    constructor(source: any = {}) {
 	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
 	        this.level = source["level"];
+	        this.component = source["component"];
 	        this.message = source["message"];
 	        this.timestamp = source["timestamp"];
 	    }
@@ -19,3 +23,298 @@ export namespace main {
 
 }
 
+export namespace relay {
+	
+	export class Health {
+	    status: string;
+	    service: string;
+	    features?: string[];
+	
+	    static createFrom(source: any = {}) {
+	        return new Health(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.status = source["status"];
+	        this.service = source["service"];
+	        this.features = source["features"];
+	    }
+	}
+	export class Member {
+	    id: string;
+	    sender?: string;
+	    name?: string;
+	    os?: string;
+	    connectedAt: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new Member(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.sender = source["sender"];
+	        this.name = source["name"];
+	        this.os = source["os"];
+	        this.connectedAt = source["connectedAt"];
+	    }
+	}
+
+}
+
+export namespace settings {
+	
+	export class DeviceSettings {
+	    name: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new DeviceSettings(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.name = source["name"];
+	    }
+	}
+	export class HeartbeatSettings {
+	    intervalSec: number;
+	    timeoutSec: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new HeartbeatSettings(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.intervalSec = source["intervalSec"];
+	        this.timeoutSec = source["timeoutSec"];
+	    }
+	}
+	export class LimitSettings {
+	    maxLogs: number;
+	    offlineQueueSize: number;
+	    maxFrameSizeMb: number;
+	    maxItemSizeMb: number;
+	    maxBufferedMb: number;
+	    spillThresholdMb: number;
+	    maxSpilledMb: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new LimitSettings(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.maxLogs = source["maxLogs"];
+	        this.offlineQueueSize = source["offlineQueueSize"];
+	        this.maxFrameSizeMb = source["maxFrameSizeMb"];
+	        this.maxItemSizeMb = source["maxItemSizeMb"];
+	        this.maxBufferedMb = source["maxBufferedMb"];
+	        this.spillThresholdMb = source["spillThresholdMb"];
+	        this.maxSpilledMb = source["maxSpilledMb"];
+	    }
+	}
+	export class LoggingSettings {
+	    level: string;
+	    file: boolean;
+	    maxFileSizeMb: number;
+	    maxFiles: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new LoggingSettings(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.level = source["level"];
+	        this.file = source["file"];
+	        this.maxFileSizeMb = source["maxFileSizeMb"];
+	        this.maxFiles = source["maxFiles"];
+	    }
+	}
+	export class ReconnectSettings {
+	    initialDelayMs: number;
+	    maxDelayMs: number;
+	    multiplier: number;
+	    jitter: number;
+	    maxAttempts: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new ReconnectSettings(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.initialDelayMs = source["initialDelayMs"];
+	        this.maxDelayMs = source["maxDelayMs"];
+	        this.multiplier = source["multiplier"];
+	        this.jitter = source["jitter"];
+	        this.maxAttempts = source["maxAttempts"];
+	    }
+	}
+	export class RelaySettings {
+	    baseUrl: string;
+	    roomId: string;
+	    token: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new RelaySettings(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.baseUrl = source["baseUrl"];
+	        this.roomId = source["roomId"];
+	        this.token = source["token"];
+	    }
+	}
+	export class ClientSettings {
+	    url: string;
+	    useRelay: boolean;
+	    relay: RelaySettings;
+	
+	    static createFrom(source: any = {}) {
+	        return new ClientSettings(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.url = source["url"];
+	        this.useRelay = source["useRelay"];
+	        this.relay = this.convertValues(source["relay"], RelaySettings);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class ServerSettings {
+	    address: string;
+	    port: number;
+	    allowedOrigins: string[];
+	    blockedDevices: string[];
+	    deviceAliases: Record<string, string>;
+	    handshakeTimeoutSec: number;
+	    slowConsumer: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new ServerSettings(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.address = source["address"];
+	        this.port = source["port"];
+	        this.allowedOrigins = source["allowedOrigins"];
+	        this.blockedDevices = source["blockedDevices"];
+	        this.deviceAliases = source["deviceAliases"];
+	        this.handshakeTimeoutSec = source["handshakeTimeoutSec"];
+	        this.slowConsumer = source["slowConsumer"];
+	    }
+	}
+	export class Settings {
+	    version: number;
+	    mode: string;
+	    autoStart: boolean;
+	    frameChecksum: boolean;
+	    device: DeviceSettings;
+	    server: ServerSettings;
+	    client: ClientSettings;
+	    limits: LimitSettings;
+	    reconnect: ReconnectSettings;
+	    heartbeat: HeartbeatSettings;
+	    logging: LoggingSettings;
+	
+	    static createFrom(source: any = {}) {
+	        return new Settings(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.version = source["version"];
+	        this.mode = source["mode"];
+	        this.autoStart = source["autoStart"];
+	        this.frameChecksum = source["frameChecksum"];
+	        this.device = this.convertValues(source["device"], DeviceSettings);
+	        this.server = this.convertValues(source["server"], ServerSettings);
+	        this.client = this.convertValues(source["client"], ClientSettings);
+	        this.limits = this.convertValues(source["limits"], LimitSettings);
+	        this.reconnect = this.convertValues(source["reconnect"], ReconnectSettings);
+	        this.heartbeat = this.convertValues(source["heartbeat"], HeartbeatSettings);
+	        this.logging = this.convertValues(source["logging"], LoggingSettings);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+
+}
+
+
+export namespace websocket {
+	
+	export class TransferProgress {
+	    id: string;
+	    direction: string;
+	    peer: string;
+	    dataType: string;
+	    mime: string;
+	    bytesDone: number;
+	    total: number;
+	    bytesPerSec: number;
+	    etaMs: number;
+	    startedAt: number;
+	    state: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new TransferProgress(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.direction = source["direction"];
+	        this.peer = source["peer"];
+	        this.dataType = source["dataType"];
+	        this.mime = source["mime"];
+	        this.bytesDone = source["bytesDone"];
+	        this.total = source["total"];
+	        this.bytesPerSec = source["bytesPerSec"];
+	        this.etaMs = source["etaMs"];
+	        this.startedAt = source["startedAt"];
+	        this.state = source["state"];
+	    }
+	}
+
+}
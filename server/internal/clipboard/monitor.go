@@ -25,6 +25,8 @@ type Monitor struct {
 	ctx      context.Context
 	cancel   context.CancelFunc
 	wg       sync.WaitGroup
+	// lifecycleMu 串行化 Start/Stop，两者可能在不同协程中被调用（如断线回调与用户操作）
+	lifecycleMu sync.Mutex
 
 	lastTextHash string
 	lastImgHash  string
@@ -38,6 +40,9 @@ func NewMonitor() *Monitor {
 
 // Start 初始化并启动剪贴板监听任务
 func (m *Monitor) Start(callback ChangeCallback) error {
+	m.lifecycleMu.Lock()
+	defer m.lifecycleMu.Unlock()
+
 	if m.cancel != nil {
 		return fmt.Errorf("monitor already started")
 	}
@@ -65,6 +70,9 @@ func (m *Monitor) Start(callback ChangeCallback) error {
 
 // Stop 停止监听并释放相关资源
 func (m *Monitor) Stop() {
+	m.lifecycleMu.Lock()
+	defer m.lifecycleMu.Unlock()
+
 	if m.cancel != nil {
 		m.cancel()
 		m.wg.Wait()
@@ -72,6 +80,13 @@ func (m *Monitor) Stop() {
 	}
 }
 
+// IsRunning 监听是否在运行
+func (m *Monitor) IsRunning() bool {
+	m.lifecycleMu.Lock()
+	defer m.lifecycleMu.Unlock()
+	return m.cancel != nil
+}
+
 // SetClipboard 更新系统剪贴板内容并同步更新内部哈希值（V1.1 二进制版本）
 // content: 原始二进制数据（对于图片，是 PNG 格式的二进制数据）
 func (m *Monitor) SetClipboard(data ClipboardData) error {
@@ -0,0 +1,74 @@
+package device
+
+import (
+	"os"
+	"runtime"
+	"strings"
+
+	"server/internal/protocol"
+)
+
+// ==========================================
+// 本机设备信息检测
+// ==========================================
+
+// 设备类型
+const (
+	ClassDesktop = "desktop"
+	ClassLaptop  = "laptop"
+	ClassServer  = "server"
+)
+
+// fallbackName 无法获取主机名时使用的设备名称
+const fallbackName = "NextPaste Desktop"
+
+// Detect 检测本机设备信息，name 非空时代替主机名作为设备名称
+func Detect(name, appVersion string) protocol.DeviceInfo {
+	if name == "" {
+		name = Hostname()
+	}
+	return protocol.DeviceInfo{
+		Name:        name,
+		OS:          osName(),
+		Arch:        runtime.GOARCH,
+		OSVersion:   osVersion(),
+		AppVersion:  appVersion,
+		DeviceClass: deviceClass(),
+	}
+}
+
+// Hostname 本机主机名（去掉 macOS 的 .local 等域名后缀）
+func Hostname() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		return fallbackName
+	}
+	if i := strings.IndexByte(host, '.'); i > 0 {
+		host = host[:i]
+	}
+	return host
+}
+
+// osName 操作系统名称（与鸿蒙端等其他客户端的命名保持一致）
+func osName() string {
+	switch runtime.GOOS {
+	case "windows":
+		return "Windows"
+	case "darwin":
+		return "macOS"
+	case "linux":
+		return "Linux"
+	case "freebsd":
+		return "FreeBSD"
+	default:
+		return runtime.GOOS
+	}
+}
+
+// deviceClass 设备类型：有电池的视为笔记本，其余为台式机
+func deviceClass() string {
+	if hasBattery() {
+		return ClassLaptop
+	}
+	return ClassDesktop
+}
@@ -0,0 +1,28 @@
+package device
+
+import (
+	"os/exec"
+	"strings"
+	"syscall"
+)
+
+// osVersion 读取 macOS 版本号，如 "macOS 14.5"
+func osVersion() string {
+	if version, err := syscall.Sysctl("kern.osproductversion"); err == nil && version != "" {
+		return "macOS " + version
+	}
+	return "macOS"
+}
+
+// hasBattery 通过型号判断是否为笔记本（MacBook）
+func hasBattery() bool {
+	model, err := syscall.Sysctl("hw.model")
+	if err != nil {
+		out, err := exec.Command("sysctl", "-n", "hw.model").Output()
+		if err != nil {
+			return false
+		}
+		model = string(out)
+	}
+	return strings.Contains(model, "MacBook")
+}
@@ -0,0 +1,33 @@
+package device
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// osVersion 读取 /etc/os-release 中的发行版名称，如 "Ubuntu 24.04 LTS"
+func osVersion() string {
+	for _, path := range []string{"/etc/os-release", "/usr/lib/os-release"} {
+		f, err := os.Open(path)
+		if err != nil {
+			continue
+		}
+		defer f.Close()
+
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			if value, ok := strings.CutPrefix(scanner.Text(), "PRETTY_NAME="); ok {
+				return strings.Trim(value, `"'`)
+			}
+		}
+	}
+	return "Linux"
+}
+
+// hasBattery 是否存在电池（/sys/class/power_supply/BAT*）
+func hasBattery() bool {
+	matches, _ := filepath.Glob("/sys/class/power_supply/BAT*")
+	return len(matches) > 0
+}
@@ -0,0 +1,13 @@
+//go:build !linux && !darwin && !windows
+
+package device
+
+// osVersion 其他平台只返回系统名称
+func osVersion() string {
+	return osName()
+}
+
+// hasBattery 其他平台不检测电池
+func hasBattery() bool {
+	return false
+}
@@ -0,0 +1,62 @@
+package device
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	ntdll    = syscall.NewLazyDLL("ntdll.dll")
+	kernel32 = syscall.NewLazyDLL("kernel32.dll")
+
+	procRtlGetVersion        = ntdll.NewProc("RtlGetVersion")
+	procGetSystemPowerStatus = kernel32.NewProc("GetSystemPowerStatus")
+)
+
+// osVersionInfo RTL_OSVERSIONINFOW
+type osVersionInfo struct {
+	size         uint32
+	majorVersion uint32
+	minorVersion uint32
+	buildNumber  uint32
+	platformID   uint32
+	csdVersion   [128]uint16
+}
+
+// systemPowerStatus SYSTEM_POWER_STATUS
+type systemPowerStatus struct {
+	acLineStatus        byte
+	batteryFlag         byte
+	batteryLifePercent  byte
+	systemStatusFlag    byte
+	batteryLifeTime     uint32
+	batteryFullLifeTime uint32
+}
+
+// osVersion 读取 Windows 版本号，如 "Windows 11 (10.0.22631)"
+// RtlGetVersion 不受应用兼容性清单影响，能拿到真实版本
+func osVersion() string {
+	var info osVersionInfo
+	info.size = uint32(unsafe.Sizeof(info))
+	if status, _, _ := procRtlGetVersion.Call(uintptr(unsafe.Pointer(&info))); status != 0 {
+		return "Windows"
+	}
+
+	name := fmt.Sprintf("Windows %d", info.majorVersion)
+	// Windows 11 的主版本号仍为 10，以内部版本号 22000 区分
+	if info.majorVersion == 10 && info.buildNumber >= 22000 {
+		name = "Windows 11"
+	}
+	return fmt.Sprintf("%s (%d.%d.%d)", name, info.majorVersion, info.minorVersion, info.buildNumber)
+}
+
+// hasBattery 是否存在系统电池
+func hasBattery() bool {
+	var status systemPowerStatus
+	if ok, _, _ := procGetSystemPowerStatus.Call(uintptr(unsafe.Pointer(&status))); ok == 0 {
+		return false
+	}
+	// BatteryFlag 128 表示没有系统电池，255 表示状态未知
+	return status.batteryFlag != 128 && status.batteryFlag != 255
+}
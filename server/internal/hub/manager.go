@@ -0,0 +1,541 @@
+package hub
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"server/internal/protocol"
+	ws "server/internal/websocket"
+
+	"github.com/google/uuid"
+)
+
+// ==========================================
+// 连接管理器
+// ==========================================
+//
+// 本机服务器与多个出站客户端连接（如局域网服务器、中继房间）可以同时运行。
+// 任一连接收到的条目写入本机剪贴板，并转发给其他所有连接；转发时保持
+// 原始发送者 UUID 与消息 ID，经由其他路径绕回的同一条目按来源去重丢弃。
+
+// 条目来源标识：本机服务器、本机剪贴板，其余为出站连接 ID
+const (
+	sourceServer = "server"
+	sourceLocal  = "local"
+)
+
+// forwardQueueSize 每个出站连接待转发队列可容纳的条目数
+const forwardQueueSize = 32
+
+// LocalCallback 收到远程条目、需要写入本机剪贴板时的回调
+type LocalCallback func(dataType string, content []byte)
+
+// StateCallback 出站连接状态变化回调
+type StateCallback func(id string, event ws.ConnectionStateEvent)
+
+// Connection 一个出站客户端连接
+type Connection struct {
+	ID        string
+	URL       string
+	client    *ws.WSClient
+	createdAt time.Time
+	// established 本轮连接循环中成功连接过（重连等待期间仍为 true）
+	established bool
+
+	// 待转发队列：由 sendLoop 逐条发送，慢速连接不会阻塞来源连接的读协程
+	queue    chan forwardItem
+	queueMu  sync.Mutex // 保证队列已满时淘汰与写入之间不被其他转发插入
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// forwardItem 待转发给出站连接的条目
+type forwardItem struct {
+	dataType string
+	content  []byte
+	origin   protocol.Origin
+}
+
+// enqueue 非阻塞地放入待转发条目，队列已满时丢弃最旧的条目，返回丢弃的条数
+func (c *Connection) enqueue(item forwardItem) int {
+	c.queueMu.Lock()
+	defer c.queueMu.Unlock()
+
+	dropped := 0
+	for {
+		select {
+		case c.queue <- item:
+			return dropped
+		default:
+		}
+		select {
+		case <-c.queue:
+			dropped++
+		default:
+		}
+	}
+}
+
+// close 停止连接的转发协程，队列中尚未发送的条目被丢弃
+func (c *Connection) close() {
+	c.stopOnce.Do(func() { close(c.stop) })
+}
+
+// ConnectionStatus 出站连接状态
+type ConnectionStatus struct {
+	ID          string             `json:"id"`
+	URL         string             `json:"url"`
+	State       ws.ConnectionState `json:"state"`
+	IsConnected bool               `json:"isConnected"`
+	LatencyMs   int64              `json:"latencyMs"`
+}
+
+// ConnectionStatistics 出站连接的同步统计
+type ConnectionStatistics struct {
+	ID           string             `json:"id"`
+	URL          string             `json:"url"`
+	State        ws.ConnectionState `json:"state"`
+	ConnectedSec int64              `json:"connectedSec"` // 本次连接成功以来的时间，未连接时为 0
+	LatencyMs    int64              `json:"latencyMs"`
+	Stats        ws.StatsSnapshot   `json:"stats"`
+}
+
+// Statistics 全局与各连接的同步统计
+type Statistics struct {
+	Global      ws.StatsSnapshot       `json:"global"` // 本机服务器与所有出站连接（含已移除的）合计
+	Server      ws.ServerStatistics    `json:"server"`
+	Connections []ConnectionStatistics `json:"connections"`
+}
+
+// ClientOptions 新建出站连接时应用的客户端参数
+type ClientOptions struct {
+	ReconnectPolicy   ws.ReconnectPolicy
+	OfflineQueueSize  int
+	HeartbeatInterval time.Duration
+	HeartbeatTimeout  time.Duration
+	Limits            ws.Limits // 接收限制，零值时使用默认限制
+}
+
+// ConnectionManager 管理本机服务器与所有出站连接，负责条目转发与去重
+type ConnectionManager struct {
+	server     *ws.Server
+	clients    map[string]*Connection
+	seen       *protocol.SeenCache
+	stats      *ws.Stats // 全局统计，本机服务器与各出站连接的统计累加于此
+	device     protocol.DeviceInfo
+	options    *ClientOptions // 为空时使用客户端默认参数
+	logCb      ws.LogCallback
+	protoLogCb ws.LogCallback // 出站连接的协议层日志
+	transfers  *ws.TransferTracker
+	peerErrCb  ws.PeerErrorCallback
+	localCb    LocalCallback
+	stateCb    StateCallback
+	activityCb func() // 是否需要监听本机剪贴板可能发生变化时回调
+	mu         sync.RWMutex
+}
+
+// NewConnectionManager 创建连接管理器，并接管服务器的剪贴板回调
+func NewConnectionManager(server *ws.Server, device protocol.DeviceInfo) *ConnectionManager {
+	m := &ConnectionManager{
+		server:  server,
+		clients: make(map[string]*Connection),
+		seen:    protocol.NewSeenCache(10*time.Minute, 4096),
+		stats:   ws.NewStats(),
+		device:  device,
+	}
+	server.Stats().SetParent(m.stats)
+	server.SetClipboardCallback(func(dataType string, content []byte, origin protocol.Origin) {
+		m.handleIncoming(sourceServer, dataType, content, origin)
+	})
+	return m
+}
+
+// SetLogCallback 设置日志回调
+func (m *ConnectionManager) SetLogCallback(cb ws.LogCallback) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.logCb = cb
+}
+
+// SetProtocolLogCallback 设置出站连接的协议层日志回调，对之后新建的连接生效
+func (m *ConnectionManager) SetProtocolLogCallback(cb ws.LogCallback) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.protoLogCb = cb
+}
+
+// SetTransferTracker 设置出站连接的分片传输进度记录器，对之后新建的连接生效
+func (m *ConnectionManager) SetTransferTracker(t *ws.TransferTracker) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.transfers = t
+}
+
+// SetPeerErrorCallback 设置收到对端错误消息的回调（本机服务器与之后新建的出站连接）
+func (m *ConnectionManager) SetPeerErrorCallback(cb ws.PeerErrorCallback) {
+	m.mu.Lock()
+	m.peerErrCb = cb
+	m.mu.Unlock()
+	m.server.SetPeerErrorCallback(cb)
+}
+
+// SetLocalCallback 设置写入本机剪贴板的回调
+func (m *ConnectionManager) SetLocalCallback(cb LocalCallback) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.localCb = cb
+}
+
+// SetStateCallback 设置出站连接状态变化回调
+func (m *ConnectionManager) SetStateCallback(cb StateCallback) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.stateCb = cb
+}
+
+// SetActivityCallback 设置活动状态变化回调（出站连接建立、断开或放弃重连时调用）
+func (m *ConnectionManager) SetActivityCallback(cb func()) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.activityCb = cb
+}
+
+// SetDevice 设置握手时发送的设备信息，对之后新建的连接生效
+func (m *ConnectionManager) SetDevice(device protocol.DeviceInfo) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.device = device
+}
+
+// SetClientOptions 设置出站连接参数，对之后新建或重新连接的连接生效
+func (m *ConnectionManager) SetClientOptions(opts ClientOptions) {
+	m.mu.Lock()
+	m.options = &opts
+	clients := make([]*ws.WSClient, 0, len(m.clients))
+	for _, conn := range m.clients {
+		clients = append(clients, conn.client)
+	}
+	m.mu.Unlock()
+
+	for _, client := range clients {
+		applyClientOptions(client, opts)
+	}
+}
+
+// applyClientOptions 把参数应用到客户端
+func applyClientOptions(client *ws.WSClient, opts ClientOptions) {
+	client.SetReconnectPolicy(opts.ReconnectPolicy)
+	client.SetOfflineQueueSize(opts.OfflineQueueSize)
+	client.SetHeartbeat(opts.HeartbeatInterval, opts.HeartbeatTimeout)
+	if opts.Limits != (ws.Limits{}) {
+		client.SetLimits(opts.Limits)
+	}
+}
+
+// Server 本机服务器
+func (m *ConnectionManager) Server() *ws.Server {
+	return m.server
+}
+
+// AddClient 新建一个出站连接并开始连接（异步，会自动重连），返回连接 ID
+func (m *ConnectionManager) AddClient(url string) (string, error) {
+	m.mu.Lock()
+	for _, conn := range m.clients {
+		if conn.URL == url {
+			m.mu.Unlock()
+			return "", fmt.Errorf("已存在到 %s 的连接", url)
+		}
+	}
+
+	// 出站连接与本机服务器使用同一设备身份，经其他路径绕回的本机条目按回环丢弃
+	id := uuid.New().String()[:8]
+	conn := &Connection{
+		ID:        id,
+		URL:       url,
+		client:    ws.NewWSClientWithUUID(m.device, m.server.DeviceUUID()),
+		createdAt: time.Now(),
+		queue:     make(chan forwardItem, forwardQueueSize),
+		stop:      make(chan struct{}),
+	}
+	m.clients[id] = conn
+	logCb := m.logCb
+	protoLogCb := m.protoLogCb
+	transfers := m.transfers
+	peerErrCb := m.peerErrCb
+	options := m.options
+	m.mu.Unlock()
+
+	client := conn.client
+	if options != nil {
+		applyClientOptions(client, *options)
+	}
+	if protoLogCb != nil {
+		client.SetProtocolLogCallback(m.prefixedLog(id, protoLogCb))
+	}
+	client.SetTransferTracker(transfers)
+	client.SetPeerErrorCallback(peerErrCb)
+	client.Stats().SetParent(m.stats)
+	client.SetClipboardCallback(func(dataType string, content []byte, origin protocol.Origin) {
+		m.handleIncoming(id, dataType, content, origin)
+	})
+	client.SetOnConnected(func() {
+		m.setEstablished(id, true)
+	})
+	client.SetOnDisconnected(func() {
+		m.notifyActivity()
+	})
+	client.SetStateCallback(func(event ws.ConnectionStateEvent) {
+		event.ID = id
+		if event.State == ws.StateFailed {
+			m.setEstablished(id, false)
+		}
+		m.mu.RLock()
+		cb := m.stateCb
+		m.mu.RUnlock()
+		if cb != nil {
+			cb(id, event)
+		}
+	})
+
+	if err := client.Connect(url, m.prefixedLog(id, logCb)); err != nil {
+		m.mu.Lock()
+		delete(m.clients, id)
+		m.mu.Unlock()
+		conn.close()
+		return "", err
+	}
+	go m.sendLoop(conn)
+	return id, nil
+}
+
+// RemoveClient 断开并移除出站连接
+func (m *ConnectionManager) RemoveClient(id string) error {
+	m.mu.Lock()
+	conn, ok := m.clients[id]
+	if ok {
+		delete(m.clients, id)
+	}
+	m.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("连接不存在: %s", id)
+	}
+
+	conn.close()
+	err := conn.client.Disconnect()
+	m.notifyActivity()
+	return err
+}
+
+// RemoveAllClients 断开并移除所有出站连接
+func (m *ConnectionManager) RemoveAllClients() {
+	m.mu.Lock()
+	conns := make([]*Connection, 0, len(m.clients))
+	for _, conn := range m.clients {
+		conns = append(conns, conn)
+	}
+	m.clients = make(map[string]*Connection)
+	m.mu.Unlock()
+
+	for _, conn := range conns {
+		conn.close()
+		conn.client.Disconnect()
+	}
+	m.notifyActivity()
+}
+
+// Client 获取出站连接的客户端
+func (m *ConnectionManager) Client(id string) *ws.WSClient {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if conn, ok := m.clients[id]; ok {
+		return conn.client
+	}
+	return nil
+}
+
+// sortedConnections 按创建时间排序的出站连接
+func (m *ConnectionManager) sortedConnections() []*Connection {
+	m.mu.RLock()
+	conns := make([]*Connection, 0, len(m.clients))
+	for _, conn := range m.clients {
+		conns = append(conns, conn)
+	}
+	m.mu.RUnlock()
+
+	sort.Slice(conns, func(i, j int) bool {
+		return conns[i].createdAt.Before(conns[j].createdAt)
+	})
+	return conns
+}
+
+// Statistics 获取全局、本机服务器与各出站连接的同步统计
+func (m *ConnectionManager) Statistics() Statistics {
+	conns := m.sortedConnections()
+	stats := Statistics{
+		Global:      m.stats.Snapshot(),
+		Server:      m.server.Statistics(),
+		Connections: make([]ConnectionStatistics, 0, len(conns)),
+	}
+	for _, conn := range conns {
+		s := ConnectionStatistics{
+			ID:        conn.ID,
+			URL:       conn.URL,
+			State:     conn.client.State(),
+			LatencyMs: conn.client.Latency().Milliseconds(),
+			Stats:     conn.client.Stats().Snapshot(),
+		}
+		if since := conn.client.ConnectedSince(); !since.IsZero() {
+			s.ConnectedSec = int64(time.Since(since) / time.Second)
+		}
+		stats.Connections = append(stats.Connections, s)
+	}
+	return stats
+}
+
+// ResetStatistics 清零全局、本机服务器与各出站连接的同步统计
+func (m *ConnectionManager) ResetStatistics() {
+	m.stats.Reset()
+	m.server.ResetStats()
+	for _, conn := range m.sortedConnections() {
+		conn.client.Stats().Reset()
+	}
+}
+
+// ClientStatuses 所有出站连接的状态，按创建时间排序
+func (m *ConnectionManager) ClientStatuses() []ConnectionStatus {
+	conns := m.sortedConnections()
+	statuses := make([]ConnectionStatus, 0, len(conns))
+	for _, conn := range conns {
+		statuses = append(statuses, ConnectionStatus{
+			ID:          conn.ID,
+			URL:         conn.URL,
+			State:       conn.client.State(),
+			IsConnected: conn.client.IsConnected(),
+			LatencyMs:   conn.client.Latency().Milliseconds(),
+		})
+	}
+	return statuses
+}
+
+// HasEstablishedClients 是否有成功连接过且仍在运行（含重连中）的出站连接
+func (m *ConnectionManager) HasEstablishedClients() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, conn := range m.clients {
+		if conn.established && conn.client.IsActive() {
+			return true
+		}
+	}
+	return false
+}
+
+// PublishLocal 发布本机剪贴板变化到所有连接
+func (m *ConnectionManager) PublishLocal(dataType string, content []byte) {
+	origin := m.server.NewOrigin()
+	m.seen.MarkNew(origin)
+	m.forward(sourceLocal, dataType, content, origin)
+}
+
+// handleIncoming 处理从某个连接收到的条目：去重、写入本机剪贴板、转发给其他连接
+func (m *ConnectionManager) handleIncoming(source, dataType string, content []byte, origin protocol.Origin) {
+	if !m.seen.MarkNew(origin) {
+		// 同一条目已经通过其他连接收到过
+		return
+	}
+
+	m.mu.RLock()
+	localCb := m.localCb
+	m.mu.RUnlock()
+	if localCb != nil {
+		localCb(dataType, content)
+	}
+
+	m.forward(source, dataType, content, origin)
+}
+
+// forward 把条目转发给除来源外的所有连接
+// 本机服务器按客户端入队，出站连接放入各自的待转发队列，都不会阻塞调用方
+func (m *ConnectionManager) forward(source, dataType string, content []byte, origin protocol.Origin) {
+	if source != sourceServer && m.server.IsRunning() {
+		if err := m.server.BroadcastItem(dataType, content, origin); err != nil {
+			m.log("ERROR", fmt.Sprintf("广播剪贴板数据失败: %v", err))
+		}
+	}
+
+	m.mu.RLock()
+	targets := make([]*Connection, 0, len(m.clients))
+	for id, conn := range m.clients {
+		if id != source {
+			targets = append(targets, conn)
+		}
+	}
+	m.mu.RUnlock()
+
+	for _, conn := range targets {
+		if !conn.client.IsActive() {
+			continue
+		}
+		if dropped := conn.enqueue(forwardItem{dataType: dataType, content: content, origin: origin}); dropped > 0 {
+			m.log("WARNING", fmt.Sprintf("[%s] 待转发队列已满，丢弃最旧的 %d 条数据", conn.ID, dropped))
+		}
+	}
+}
+
+// sendLoop 按顺序发送出站连接待转发队列中的条目，连接移除后退出
+func (m *ConnectionManager) sendLoop(conn *Connection) {
+	for {
+		select {
+		case item := <-conn.queue:
+			if !conn.client.IsActive() {
+				continue
+			}
+			if err := conn.client.SendItem(item.dataType, item.content, item.origin); err != nil {
+				m.log("ERROR", fmt.Sprintf("[%s] 发送剪贴板数据失败: %v", conn.ID, err))
+			}
+		case <-conn.stop:
+			return
+		}
+	}
+}
+
+// setEstablished 更新连接的建立状态并通知
+func (m *ConnectionManager) setEstablished(id string, established bool) {
+	m.mu.Lock()
+	if conn, ok := m.clients[id]; ok {
+		conn.established = established
+	}
+	m.mu.Unlock()
+	m.notifyActivity()
+}
+
+// notifyActivity 通知活动状态可能发生变化
+func (m *ConnectionManager) notifyActivity() {
+	m.mu.RLock()
+	cb := m.activityCb
+	m.mu.RUnlock()
+	if cb != nil {
+		cb()
+	}
+}
+
+// prefixedLog 为出站连接的日志加上连接 ID 前缀
+func (m *ConnectionManager) prefixedLog(id string, logCb ws.LogCallback) ws.LogCallback {
+	return func(level, message string) {
+		if logCb != nil {
+			logCb(level, fmt.Sprintf("[%s] %s", id, message))
+		}
+	}
+}
+
+// log 记录日志
+func (m *ConnectionManager) log(level, message string) {
+	m.mu.RLock()
+	logCb := m.logCb
+	m.mu.RUnlock()
+	if logCb != nil {
+		logCb(level, message)
+	}
+}
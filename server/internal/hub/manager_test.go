@@ -0,0 +1,187 @@
+package hub_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"server/internal/hub"
+	"server/internal/protocol"
+	"server/internal/wstest"
+
+	"github.com/gorilla/websocket"
+)
+
+// node 一台桌面设备：本机服务器、连接管理器与本机剪贴板
+type node struct {
+	server  *wstest.Server
+	manager *hub.ConnectionManager
+	local   *wstest.Clipboard
+	name    string
+}
+
+// newNode 以新的设备 UUID 启动一台桌面设备
+func newNode(t *testing.T, name string, log *wstest.Log) *node {
+	t.Helper()
+	server := wstest.NewServer(t, log)
+	n := &node{
+		server:  server,
+		manager: hub.NewConnectionManager(server.Server, protocol.DeviceInfo{Name: name, OS: "test"}),
+		local:   wstest.NewClipboard(),
+		name:    name,
+	}
+	n.manager.SetLogCallback(log.Callback(name))
+	n.manager.SetLocalCallback(n.local.WriteLocal)
+	n.manager.SetClientOptions(hub.ClientOptions{
+		ReconnectPolicy:   wstest.FastReconnect,
+		OfflineQueueSize:  5,
+		HeartbeatInterval: 15 * time.Second,
+		HeartbeatTimeout:  45 * time.Second,
+	})
+	t.Cleanup(n.manager.RemoveAllClients)
+	return n
+}
+
+// connect 建立到另一台设备服务器的出站连接，等待对方完成握手
+func (n *node) connect(t *testing.T, peer *node) {
+	t.Helper()
+	if _, err := n.manager.AddClient(peer.server.URL()); err != nil {
+		t.Fatalf("%s 连接 %s 失败: %v", n.name, peer.name, err)
+	}
+	peer.server.WaitForClient(n.name)
+}
+
+// newMesh 两台互相连接的桌面设备，各有一部手机连接到本机服务器
+func newMesh(t *testing.T) (a, b *node, phoneA, phoneB *wstest.Client) {
+	t.Helper()
+	log := wstest.NewLog(t)
+	a = newNode(t, "desktop-a", log)
+	b = newNode(t, "desktop-b", log)
+	a.connect(t, b)
+	b.connect(t, a)
+	phoneA = wstest.Dial(t, a.server, "phone-a", log)
+	phoneB = wstest.Dial(t, b.server, "phone-b", log)
+	return a, b, phoneA, phoneB
+}
+
+func TestItemFromPhoneReachesWholeMesh(t *testing.T) {
+	t.Parallel()
+	a, b, phoneA, phoneB := newMesh(t)
+
+	text := []byte("手机 A 复制的文本")
+	if err := phoneA.SendClipboardBinary("text", text); err != nil {
+		t.Fatalf("发送失败: %v", err)
+	}
+	a.local.WaitFor(t, "text", text)
+	b.local.WaitFor(t, "text", text)
+	item := phoneB.Clipboard.WaitFor(t, "text", text)
+	if item.Origin.Sender != phoneA.UUID {
+		t.Errorf("转发后发送者 = %x，期望保持手机 A %x", item.Origin.Sender, phoneA.UUID)
+	}
+
+	// 环形连接中绕回的条目按来源去重，每台设备只写入一次，也不回发给来源
+	time.Sleep(200 * time.Millisecond)
+	for _, c := range []struct {
+		name string
+		got  int
+		want int
+	}{
+		{"desktop-a", a.local.Len(), 1},
+		{"desktop-b", b.local.Len(), 1},
+		{"phone-a", phoneA.Clipboard.Len(), 0},
+		{"phone-b", phoneB.Clipboard.Len(), 1},
+	} {
+		if c.got != c.want {
+			t.Errorf("%s 收到 %d 个条目，期望 %d 个", c.name, c.got, c.want)
+		}
+	}
+}
+
+func TestLocalImagePublishedToMesh(t *testing.T) {
+	t.Parallel()
+	a, b, phoneA, phoneB := newMesh(t)
+
+	image := make([]byte, 150*1024)
+	for i := range image {
+		image[i] = byte(i * 7)
+	}
+	a.manager.PublishLocal("image", image)
+
+	phoneA.Clipboard.WaitFor(t, "image", image)
+	item := phoneB.Clipboard.WaitFor(t, "image", image)
+	b.local.WaitFor(t, "image", image)
+	if item.Origin.Sender != a.server.UUID {
+		t.Errorf("发送者 = %x，期望桌面 A 的设备 UUID %x", item.Origin.Sender, a.server.UUID)
+	}
+	a.local.Consistently(t, 0, 200*time.Millisecond)
+	b.local.Consistently(t, 1, 0)
+}
+
+func TestOutboundConnectionRecoversAfterPeerRestart(t *testing.T) {
+	t.Parallel()
+	a, b, _, phoneB := newMesh(t)
+
+	b.server.Restart()
+	b.server.WaitForClient("desktop-a")
+	b.server.WaitForClient("phone-b")
+
+	text := []byte("对端重启后的文本")
+	a.manager.PublishLocal("text", text)
+	b.local.WaitFor(t, "text", text)
+	phoneB.Clipboard.WaitFor(t, "text", text)
+}
+
+// newStalledPeer 收到握手后不再读取任何消息的对端，返回其 WebSocket 地址
+func newStalledPeer(t *testing.T) string {
+	t.Helper()
+	done := make(chan struct{})
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.ReadMessage()
+		<-done
+	}))
+	t.Cleanup(func() {
+		close(done)
+		srv.CloseClientConnections()
+		srv.Close()
+	})
+	return "ws" + strings.TrimPrefix(srv.URL, "http")
+}
+
+func TestStalledConnectionDoesNotBlockForwarding(t *testing.T) {
+	t.Parallel()
+	log := wstest.NewLog(t)
+	a := newNode(t, "desktop-a", log)
+	b := newNode(t, "desktop-b", log)
+	a.connect(t, b)
+	phoneA := wstest.Dial(t, a.server, "phone-a", log)
+
+	id, err := a.manager.AddClient(newStalledPeer(t))
+	if err != nil {
+		t.Fatalf("连接停滞的对端失败: %v", err)
+	}
+	stalled := a.manager.Client(id)
+	wstest.Eventually(t, stalled.IsConnected, "连接停滞的对端")
+
+	// 大图片写满到停滞对端的发送缓冲区，之后的写入会一直阻塞到写超时
+	image := make([]byte, 16<<20)
+	start := time.Now()
+	a.manager.PublishLocal("image", image)
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("PublishLocal 耗时 %v，不应等待慢速连接", elapsed)
+	}
+
+	// 手机的条目由本机服务器的读协程转发，不会排在停滞连接之后
+	text := []byte("停滞连接之后的文本")
+	if err := phoneA.SendClipboardBinary("text", text); err != nil {
+		t.Fatalf("发送失败: %v", err)
+	}
+	b.local.WaitFor(t, "text", text)
+}
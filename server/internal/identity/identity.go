@@ -0,0 +1,186 @@
+package identity
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ==========================================
+// 设备身份
+// ==========================================
+//
+// 每台设备持有一个持久化的 UUID（协议头部中的发送者 ID）和一对 Ed25519 密钥，
+// 保存在用户配置目录中，重启后保持不变。信任列表、按设备的策略和回环检测都依赖
+// 这个身份，因此文件损坏时不会自动覆盖，由调用方决定如何处理。
+
+// fileName 身份文件名
+const fileName = "identity.json"
+
+// fileVersion 身份文件结构版本
+const fileVersion = 1
+
+// Identity 设备身份
+type Identity struct {
+	UUID       [16]byte
+	CreatedAt  time.Time
+	publicKey  ed25519.PublicKey
+	privateKey ed25519.PrivateKey
+}
+
+// identityFile 身份文件内容
+type identityFile struct {
+	Version   int       `json:"version"`
+	UUID      string    `json:"uuid"`
+	Seed      string    `json:"seed"` // Ed25519 私钥种子（base64）
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// DefaultPath 默认身份文件路径（用户配置目录下的 NextPaste/identity.json）
+func DefaultPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("获取用户配置目录失败: %w", err)
+	}
+	return filepath.Join(dir, "NextPaste", fileName), nil
+}
+
+// Generate 生成新的设备身份（不保存）
+func Generate() (*Identity, error) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("生成设备密钥失败: %w", err)
+	}
+	return &Identity{
+		UUID:       uuid.New(),
+		CreatedAt:  time.Now(),
+		publicKey:  publicKey,
+		privateKey: privateKey,
+	}, nil
+}
+
+// LoadOrCreate 加载设备身份，文件不存在时生成并保存，返回是否为新生成的身份
+// 文件存在但无法解析时返回错误，不会覆盖原文件
+func LoadOrCreate(path string) (*Identity, bool, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		id, err := decode(data)
+		if err != nil {
+			return nil, false, fmt.Errorf("身份文件 %s 无效: %w", path, err)
+		}
+		return id, false, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, false, fmt.Errorf("读取身份文件失败: %w", err)
+	}
+
+	id, err := Generate()
+	if err != nil {
+		return nil, false, err
+	}
+	if err := id.save(path); err != nil {
+		return nil, false, err
+	}
+	return id, true, nil
+}
+
+// decode 解析身份文件
+func decode(data []byte) (*Identity, error) {
+	var f identityFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, err
+	}
+	if f.Version > fileVersion {
+		return nil, fmt.Errorf("身份文件版本 %d 高于当前支持的版本 %d", f.Version, fileVersion)
+	}
+
+	u, err := uuid.Parse(f.UUID)
+	if err != nil {
+		return nil, fmt.Errorf("UUID 无效: %w", err)
+	}
+	seed, err := base64.StdEncoding.DecodeString(f.Seed)
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("密钥无效")
+	}
+
+	privateKey := ed25519.NewKeyFromSeed(seed)
+	return &Identity{
+		UUID:       u,
+		CreatedAt:  f.CreatedAt,
+		publicKey:  privateKey.Public().(ed25519.PublicKey),
+		privateKey: privateKey,
+	}, nil
+}
+
+// save 原子写入身份文件，仅当前用户可读写
+func (id *Identity) save(path string) error {
+	data, err := json.MarshalIndent(identityFile{
+		Version:   fileVersion,
+		UUID:      id.UUIDString(),
+		Seed:      base64.StdEncoding.EncodeToString(id.privateKey.Seed()),
+		CreatedAt: id.CreatedAt,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("创建身份目录失败: %w", err)
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("保存身份文件失败: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("保存身份文件失败: %w", err)
+	}
+	return nil
+}
+
+// UUIDString 设备 UUID 的标准字符串形式
+func (id *Identity) UUIDString() string {
+	return uuid.UUID(id.UUID).String()
+}
+
+// PublicKey 设备公钥
+func (id *Identity) PublicKey() ed25519.PublicKey {
+	return id.publicKey
+}
+
+// Fingerprint 公钥指纹（SHA-256 前 8 字节，分组显示），用于人工核对设备
+func (id *Identity) Fingerprint() string {
+	return Fingerprint(id.publicKey)
+}
+
+// Sign 使用设备私钥签名
+func (id *Identity) Sign(message []byte) []byte {
+	return ed25519.Sign(id.privateKey, message)
+}
+
+// Fingerprint 计算公钥指纹
+func Fingerprint(publicKey ed25519.PublicKey) string {
+	sum := sha256.Sum256(publicKey)
+	encoded := hex.EncodeToString(sum[:8])
+	groups := make([]string, 0, 4)
+	for i := 0; i < len(encoded); i += 4 {
+		groups = append(groups, encoded[i:i+4])
+	}
+	return strings.ToUpper(strings.Join(groups, "-"))
+}
+
+// Verify 使用对端公钥校验签名
+func Verify(publicKey ed25519.PublicKey, message, signature []byte) bool {
+	return len(publicKey) == ed25519.PublicKeySize && ed25519.Verify(publicKey, message, signature)
+}
@@ -0,0 +1,80 @@
+package logging
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// rotatingFile 按大小滚动的日志文件：
+// 当前文件为 path，滚动后依次为 path.1（最新）… path.N（最旧）
+type rotatingFile struct {
+	path     string
+	maxBytes int64
+	maxFiles int
+	file     *os.File
+	size     int64
+}
+
+// openRotatingFile 打开（追加）日志文件
+func openRotatingFile(path string, maxBytes int64, maxFiles int) (*rotatingFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, fmt.Errorf("创建日志目录失败: %w", err)
+	}
+	r := &rotatingFile{path: path, maxBytes: maxBytes, maxFiles: maxFiles}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// open 打开当前日志文件
+func (r *rotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("打开日志文件失败: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.file = f
+	r.size = info.Size()
+	return nil
+}
+
+// writeLine 写入一行，超过大小上限时先滚动
+func (r *rotatingFile) writeLine(line string) error {
+	if r.maxBytes > 0 && r.size > 0 && r.size+int64(len(line))+1 > r.maxBytes {
+		if err := r.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := r.file.WriteString(line + "\n")
+	r.size += int64(n)
+	return err
+}
+
+// rotate 滚动日志文件，超出 maxFiles 的最旧文件被删除
+func (r *rotatingFile) rotate() error {
+	r.file.Close()
+
+	if r.maxFiles > 0 {
+		os.Remove(fmt.Sprintf("%s.%d", r.path, r.maxFiles))
+		for i := r.maxFiles - 1; i >= 1; i-- {
+			os.Rename(fmt.Sprintf("%s.%d", r.path, i), fmt.Sprintf("%s.%d", r.path, i+1))
+		}
+		if err := os.Rename(r.path, r.path+".1"); err != nil {
+			return fmt.Errorf("滚动日志文件失败: %w", err)
+		}
+	} else if err := os.Truncate(r.path, 0); err != nil {
+		return fmt.Errorf("滚动日志文件失败: %w", err)
+	}
+	return r.open()
+}
+
+// close 关闭日志文件
+func (r *rotatingFile) close() {
+	r.file.Close()
+}
@@ -0,0 +1,276 @@
+package logging
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ==========================================
+// 日志
+// ==========================================
+//
+// 日志保存在固定容量的环形缓冲区中，新条目通过回调增量推送给界面；
+// 可选同时写入磁盘日志文件（按大小滚动）。每条日志带有组件标签，
+// 便于在界面中按来源筛选。
+
+// 日志级别（与界面显示一致）
+const (
+	LevelDebug   = "DEBUG"
+	LevelInfo    = "INFO"
+	LevelSuccess = "SUCCESS"
+	LevelWarning = "WARNING"
+	LevelError   = "ERROR"
+)
+
+// 组件标签
+const (
+	ComponentApp      = "app"
+	ComponentServer   = "server"
+	ComponentClient   = "client"
+	ComponentMonitor  = "monitor"
+	ComponentProtocol = "protocol"
+	ComponentRelay    = "relay"
+)
+
+// levelRanks 级别高低，用于过滤；SUCCESS 与 INFO 同级
+var levelRanks = map[string]int{
+	LevelDebug:   0,
+	LevelInfo:    1,
+	LevelSuccess: 1,
+	LevelWarning: 2,
+	LevelError:   3,
+}
+
+// ValidLevel 是否为已知的日志级别
+func ValidLevel(level string) bool {
+	_, ok := levelRanks[level]
+	return ok
+}
+
+// DefaultPath 默认日志文件路径（用户配置目录下的 NextPaste/logs/nextpaste.log）
+func DefaultPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("获取用户配置目录失败: %w", err)
+	}
+	return filepath.Join(dir, "NextPaste", "logs", "nextpaste.log"), nil
+}
+
+// Entry 日志条目
+type Entry struct {
+	ID        uint64 `json:"id"`
+	Level     string `json:"level"`
+	Component string `json:"component"`
+	Message   string `json:"message"`
+	Timestamp int64  `json:"timestamp"` // 毫秒时间戳
+}
+
+// String 日志文件与导出使用的文本格式
+func (e Entry) String() string {
+	ts := time.UnixMilli(e.Timestamp).Format("2006-01-02 15:04:05.000")
+	return fmt.Sprintf("%s [%s] [%s] %s", ts, e.Level, e.Component, e.Message)
+}
+
+// Logger 日志记录器
+type Logger struct {
+	ring     []Entry
+	start    int // 最旧条目在 ring 中的位置
+	size     int
+	nextID   uint64
+	minLevel string
+	file     *rotatingFile
+	sink     func(Entry)
+	mu       sync.Mutex
+}
+
+// New 创建日志记录器，capacity 为内存中保留的条目数
+func New(capacity int) *Logger {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &Logger{
+		ring:     make([]Entry, capacity),
+		minLevel: LevelInfo,
+	}
+}
+
+// SetSink 设置新日志回调（用于推送给界面），在日志锁外调用
+func (l *Logger) SetSink(sink func(Entry)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sink = sink
+}
+
+// SetLevel 设置最低记录级别，低于该级别的日志直接丢弃
+func (l *Logger) SetLevel(level string) {
+	if !ValidLevel(level) {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.minLevel = level
+}
+
+// SetCapacity 修改内存中保留的条目数，保留最新的条目
+func (l *Logger) SetCapacity(capacity int) {
+	if capacity < 1 {
+		capacity = 1
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if capacity == len(l.ring) {
+		return
+	}
+
+	entries := l.entriesLocked()
+	if len(entries) > capacity {
+		entries = entries[len(entries)-capacity:]
+	}
+	l.ring = make([]Entry, capacity)
+	copy(l.ring, entries)
+	l.start = 0
+	l.size = len(entries)
+}
+
+// EnableFile 开启日志文件，超过 maxBytes 时滚动，最多保留 maxFiles 个历史文件
+// 已以相同参数开启时不做任何操作
+func (l *Logger) EnableFile(path string, maxBytes int64, maxFiles int) error {
+	l.mu.Lock()
+	if f := l.file; f != nil && f.path == path && f.maxBytes == maxBytes && f.maxFiles == maxFiles {
+		l.mu.Unlock()
+		return nil
+	}
+	l.mu.Unlock()
+
+	f, err := openRotatingFile(path, maxBytes, maxFiles)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	old := l.file
+	l.file = f
+	l.mu.Unlock()
+
+	if old != nil {
+		old.close()
+	}
+	return nil
+}
+
+// DisableFile 关闭日志文件
+func (l *Logger) DisableFile() {
+	l.mu.Lock()
+	old := l.file
+	l.file = nil
+	l.mu.Unlock()
+
+	if old != nil {
+		old.close()
+	}
+}
+
+// Log 记录一条日志
+func (l *Logger) Log(component, level, message string) {
+	rank, ok := levelRanks[level]
+	if !ok {
+		level, rank = LevelInfo, levelRanks[LevelInfo]
+	}
+
+	l.mu.Lock()
+	if rank < levelRanks[l.minLevel] {
+		l.mu.Unlock()
+		return
+	}
+
+	l.nextID++
+	entry := Entry{
+		ID:        l.nextID,
+		Level:     level,
+		Component: component,
+		Message:   message,
+		Timestamp: time.Now().UnixMilli(),
+	}
+	capacity := len(l.ring)
+	l.ring[(l.start+l.size)%capacity] = entry
+	if l.size < capacity {
+		l.size++
+	} else {
+		l.start = (l.start + 1) % capacity
+	}
+
+	if l.file != nil {
+		if err := l.file.writeLine(entry.String()); err != nil {
+			// 磁盘写入失败时停止写文件，避免每条日志都重复报错
+			l.file.close()
+			l.file = nil
+			fmt.Fprintf(os.Stderr, "写入日志文件失败: %v\n", err)
+		}
+	}
+	sink := l.sink
+	l.mu.Unlock()
+
+	if sink != nil {
+		sink(entry)
+	}
+}
+
+// Callback 返回带组件标签的日志回调，签名与各模块的 LogCallback 一致
+func (l *Logger) Callback(component string) func(level, message string) {
+	return func(level, message string) {
+		l.Log(component, level, message)
+	}
+}
+
+// Entries 获取内存中的日志，按时间从旧到新
+func (l *Logger) Entries() []Entry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.entriesLocked()
+}
+
+// entriesLocked 按时间顺序复制环形缓冲区（调用方需持有 l.mu）
+func (l *Logger) entriesLocked() []Entry {
+	entries := make([]Entry, l.size)
+	for i := 0; i < l.size; i++ {
+		entries[i] = l.ring[(l.start+i)%len(l.ring)]
+	}
+	return entries
+}
+
+// Clear 清空内存中的日志（日志文件不受影响）
+func (l *Logger) Clear() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.start = 0
+	l.size = 0
+}
+
+// Export 把内存中的日志导出为文本文件
+func (l *Logger) Export(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("创建导出文件失败: %w", err)
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	for _, entry := range l.Entries() {
+		w.WriteString(strings.ReplaceAll(entry.String(), "\n", " "))
+		w.WriteByte('\n')
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("写入导出文件失败: %w", err)
+	}
+	return f.Close()
+}
+
+// Close 关闭日志文件
+func (l *Logger) Close() {
+	l.DisableFile()
+}
@@ -1,10 +1,18 @@
 package protocol
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
 	"encoding/binary"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"hash/crc32"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/google/uuid"
 )
@@ -21,6 +29,8 @@ const (
 	// HeaderSize 固定头部大小（33字节）
 	// Magic(2) + VerType(1) + Flags(1) + Reserved(1) + MsgID(4) + Seq(4) + SenderID(16) + PayloadLen(4) = 33
 	HeaderSize = 33
+	// ChecksumSize 帧校验尾部大小（CRC32，4字节）
+	ChecksumSize = 4
 )
 
 // MessageType 消息类型定义
@@ -32,6 +42,29 @@ const (
 	TypeText      MessageType = 0x2 // 文本
 	TypeImage     MessageType = 0x3 // 图片
 	TypeFile      MessageType = 0x4 // 文件
+	TypeError     MessageType = 0x5 // 错误：接收方拒绝某条消息时回复发送方
+)
+
+// 错误消息负载为 JSON（见 ErrorPayload），msgId 与 target 为被拒绝消息的消息 ID 与发送者 UUID；
+// 经中继转发时房间内所有成员都会收到，只有 target 与 msgId 对应本机发出的消息时才处理
+// 错误码
+const (
+	ErrorCodeTooLarge        = "too_large"        // 条目超过接收方的大小限制
+	ErrorCodeBufferFull      = "buffer_full"      // 接收方缓冲区已满，可稍后重试
+	ErrorCodeUnsupportedType = "unsupported_type" // 不支持的消息类型
+	ErrorCodeBadMeta         = "bad_meta"         // 元数据无法解析
+	ErrorCodeNotHandshaken   = "not_handshaken"   // 握手完成前发送了内容
+	ErrorCodeBadHandshake    = "bad_handshake"    // 握手消息无效
+	ErrorCodeCorrupt         = "corrupt"          // 帧校验或内容哈希不匹配，可重新发送
+	ErrorCodeCancelled       = "cancelled"        // 发送方中途取消了 msgId 对应的条目，接收方丢弃已收到的分片
+)
+
+// 心跳负载（可选）：[类型(1)][Unix 毫秒时间戳(8, 大端)]
+// 空负载的心跳仍然有效，兼容旧版本
+const (
+	HeartbeatPing        uint8 = 0x01 // 请求对端回复
+	HeartbeatPong        uint8 = 0x02 // 回复，原样带回请求中的时间戳
+	HeartbeatPayloadSize       = 9
 )
 
 // MessageFlags 标志位定义
@@ -41,8 +74,13 @@ const (
 	FlagNone    MessageFlags = 0x00 // 无标志
 	FlagMF      MessageFlags = 0x01 // More Fragments，有后续分片
 	FlagHasMeta MessageFlags = 0x02 // 包含元数据
+	FlagCRC     MessageFlags = 0x04 // 帧末尾附带 CRC32 校验（见 ChecksumSize）
 )
 
+// 帧校验：设置 FlagCRC 时，Payload 之后紧跟 4 字节 CRC32（IEEE，大端序），
+// 覆盖头部与 Payload，不计入 PayloadLen。旧版本接收方按 PayloadLen 截取
+// Payload，会忽略这 4 字节
+
 // ==========================================
 // 错误定义
 // ==========================================
@@ -54,6 +92,8 @@ var (
 	ErrInvalidInput      = errors.New("输入参数无效")
 	ErrMetaParseFailed   = errors.New("元数据解析失败")
 	ErrUnsupportedFormat = errors.New("不支持的消息格式")
+	ErrChecksumMismatch  = errors.New("帧校验失败")
+	ErrHashMismatch      = errors.New("内容哈希不匹配")
 )
 
 // ==========================================
@@ -75,11 +115,62 @@ type BinaryMessage struct {
 	BinaryData []byte
 }
 
+// Origin 剪贴板条目的原始来源：发送者 UUID + 消息 ID
+// 条目经服务器或多个连接转发时保持不变，接收方据此去重、避免转发环路
+type Origin struct {
+	Sender [16]byte
+	MsgID  uint32
+}
+
+// Key 来源的字符串形式，用作去重键
+func (o Origin) Key() string {
+	return fmt.Sprintf("%x:%d", o.Sender[:], o.MsgID)
+}
+
+// IsZero 是否为空来源
+func (o Origin) IsZero() bool {
+	return o == Origin{}
+}
+
 // HandshakeMeta 握手消息元数据
+// name/os/ver 为 V1.1 必需字段；其余为可选的设备详情，旧版本客户端不发送
 type HandshakeMeta struct {
-	Name string `json:"name"`
-	OS   string `json:"os"`
-	Ver  int    `json:"ver"`
+	Name        string `json:"name"`
+	OS          string `json:"os"`
+	Ver         int    `json:"ver"`
+	Arch        string `json:"arch,omitempty"`
+	OSVersion   string `json:"osVersion,omitempty"`
+	AppVersion  string `json:"appVersion,omitempty"`
+	DeviceClass string `json:"class,omitempty"` // desktop / laptop / phone / tablet / server
+}
+
+// ErrorPayload 错误消息负载
+type ErrorPayload struct {
+	Code   string `json:"code"`
+	MsgID  uint32 `json:"msgId"`            // 被拒绝的消息 ID，与具体消息无关时为 0
+	Target string `json:"target,omitempty"` // 被拒绝消息的发送者 UUID（十六进制），旧版本不发送
+	Reason string `json:"reason,omitempty"`
+}
+
+// Origin 被拒绝的消息的来源，错误消息中没有 target 时 ok 为 false
+func (p *ErrorPayload) Origin() (o Origin, ok bool) {
+	o.MsgID = p.MsgID
+	sender, err := hex.DecodeString(p.Target)
+	if err != nil || len(sender) != len(o.Sender) {
+		return o, false
+	}
+	copy(o.Sender[:], sender)
+	return o, true
+}
+
+// DeviceInfo 本机设备信息，握手时发送给对端
+type DeviceInfo struct {
+	Name        string
+	OS          string
+	Arch        string
+	OSVersion   string
+	AppVersion  string
+	DeviceClass string
 }
 
 // TransferMeta 文件/图片传输元数据
@@ -87,7 +178,7 @@ type TransferMeta struct {
 	Name   string `json:"name,omitempty"`
 	Mime   string `json:"mime,omitempty"`
 	Size   int64  `json:"size,omitempty"`
-	Hash   string `json:"hash,omitempty"`
+	Hash   string `json:"hash,omitempty"` // 完整条目的 SHA-256（十六进制），旧版本发送方不填写
 	Width  int    `json:"width,omitempty"`
 	Height int    `json:"height,omitempty"`
 }
@@ -96,22 +187,57 @@ type TransferMeta struct {
 // 二进制协议管理器
 // ==========================================
 
+// 进程内所有协议管理器共享的设备 UUID 与消息 ID 计数器：
+// 本机服务器与各出站连接使用同一个发送者身份，消息 ID 在进程内唯一，
+// 以 (发送者, 消息 ID) 去重时不会误判。计数器从随机值开始，重启后
+// 不会与对端去重缓存中本机上次运行留下的消息 ID 冲突
+var (
+	processUUID   = [16]byte(uuid.New())
+	processUUIDMu sync.RWMutex
+	msgCounter    atomic.Uint32
+	frameChecksum atomic.Bool
+)
+
+func init() {
+	var seed [4]byte
+	rand.Read(seed[:])
+	msgCounter.Store(binary.BigEndian.Uint32(seed[:]))
+}
+
+// SetDeviceUUID 设置本机设备 UUID（持久化的设备身份），需在创建协议管理器之前调用
+func SetDeviceUUID(u [16]byte) {
+	processUUIDMu.Lock()
+	defer processUUIDMu.Unlock()
+	processUUID = u
+}
+
+// DeviceUUID 获取本机设备 UUID
+func DeviceUUID() [16]byte {
+	processUUIDMu.RLock()
+	defer processUUIDMu.RUnlock()
+	return processUUID
+}
+
+// SetFrameChecksum 设置本机发出的帧是否附带 CRC32 校验，对之后封包的所有帧生效
+func SetFrameChecksum(enabled bool) {
+	frameChecksum.Store(enabled)
+}
+
 // BinaryProtocolManager 二进制协议管理器
 type BinaryProtocolManager struct {
 	deviceUUID []byte // 16字节设备UUID
-	msgCounter uint32 // 消息ID计数器
 }
 
-// NewBinaryProtocolManager 创建二进制协议管理器
+// NewBinaryProtocolManager 创建二进制协议管理器，使用本机设备 UUID
 func NewBinaryProtocolManager() *BinaryProtocolManager {
-	// 生成随机UUID作为设备标识
-	uuidBytes := make([]byte, 16)
-	u := uuid.New()
-	copy(uuidBytes, u[:])
+	return NewBinaryProtocolManagerWithUUID(DeviceUUID())
+}
 
+// NewBinaryProtocolManagerWithUUID 创建使用指定设备 UUID 的协议管理器
+// 发出的帧以该 UUID 作为发送者，收到同一 UUID 发出的帧视为回环
+func NewBinaryProtocolManagerWithUUID(u [16]byte) *BinaryProtocolManager {
 	return &BinaryProtocolManager{
-		deviceUUID: uuidBytes,
-		msgCounter: 0,
+		deviceUUID: u[:],
 	}
 }
 
@@ -120,10 +246,17 @@ func (m *BinaryProtocolManager) GetDeviceUUID() []byte {
 	return m.deviceUUID
 }
 
-// getNextMsgID 获取下一个消息ID
+// getNextMsgID 获取下一个消息ID（进程内唯一）
 func (m *BinaryProtocolManager) getNextMsgID() uint32 {
-	m.msgCounter++
-	return m.msgCounter
+	return msgCounter.Add(1)
+}
+
+// NewOrigin 为本机新产生的条目分配来源
+func (m *BinaryProtocolManager) NewOrigin() Origin {
+	var o Origin
+	copy(o.Sender[:], m.deviceUUID)
+	o.MsgID = m.getNextMsgID()
+	return o
 }
 
 // ==========================================
@@ -132,10 +265,19 @@ func (m *BinaryProtocolManager) getNextMsgID() uint32 {
 
 // CreateHandshake 创建握手包
 func (m *BinaryProtocolManager) CreateHandshake(deviceName, osName string) ([]byte, error) {
+	return m.CreateDeviceHandshake(DeviceInfo{Name: deviceName, OS: osName})
+}
+
+// CreateDeviceHandshake 创建携带完整设备信息的握手包
+func (m *BinaryProtocolManager) CreateDeviceHandshake(device DeviceInfo) ([]byte, error) {
 	meta := HandshakeMeta{
-		Name: deviceName,
-		OS:   osName,
-		Ver:  11, // 协议版本 V1.1
+		Name:        device.Name,
+		OS:          device.OS,
+		Ver:         11, // 协议版本 V1.1
+		Arch:        device.Arch,
+		OSVersion:   device.OSVersion,
+		AppVersion:  device.AppVersion,
+		DeviceClass: device.DeviceClass,
 	}
 
 	payload, err := json.Marshal(meta)
@@ -148,12 +290,17 @@ func (m *BinaryProtocolManager) CreateHandshake(deviceName, osName string) ([]by
 
 // CreateText 创建文本消息包
 func (m *BinaryProtocolManager) CreateText(text string) ([]byte, error) {
+	return m.CreateTextFrom(m.NewOrigin(), text)
+}
+
+// CreateTextFrom 以指定来源创建文本消息包（用于转发，保持原始发送者与消息 ID）
+func (m *BinaryProtocolManager) CreateTextFrom(origin Origin, text string) ([]byte, error) {
 	if len(text) == 0 {
 		return nil, ErrInvalidInput
 	}
 
 	payload := []byte(text)
-	return m.pack(TypeText, FlagNone, m.getNextMsgID(), 0, payload), nil
+	return packFrom(origin.Sender[:], TypeText, FlagNone, origin.MsgID, 0, payload), nil
 }
 
 // CreateHeartbeat 创建心跳包
@@ -161,9 +308,61 @@ func (m *BinaryProtocolManager) CreateHeartbeat() []byte {
 	return m.pack(TypeHeartbeat, FlagNone, m.getNextMsgID(), 0, nil)
 }
 
+// CreateHeartbeatPing 创建携带时间戳的心跳请求，对端回复 Pong 后可据此计算往返延迟
+func (m *BinaryProtocolManager) CreateHeartbeatPing(now time.Time) []byte {
+	return m.pack(TypeHeartbeat, FlagNone, m.getNextMsgID(), 0, heartbeatPayload(HeartbeatPing, now.UnixMilli()))
+}
+
+// CreateHeartbeatPong 创建心跳回复，带回请求中的时间戳
+func (m *BinaryProtocolManager) CreateHeartbeatPong(timestamp int64) []byte {
+	return m.pack(TypeHeartbeat, FlagNone, m.getNextMsgID(), 0, heartbeatPayload(HeartbeatPong, timestamp))
+}
+
+// CreateError 创建错误消息，告知 target 的发送方该消息被拒绝
+func (m *BinaryProtocolManager) CreateError(code string, target Origin, reason string) ([]byte, error) {
+	if code == "" {
+		return nil, ErrInvalidInput
+	}
+	payload := ErrorPayload{Code: code, MsgID: target.MsgID, Reason: reason}
+	if target.Sender != ([16]byte{}) {
+		payload.Target = hex.EncodeToString(target.Sender[:])
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	return m.pack(TypeError, FlagNone, m.getNextMsgID(), 0, data), nil
+}
+
+// heartbeatPayload 编码心跳负载
+func heartbeatPayload(kind uint8, timestamp int64) []byte {
+	payload := make([]byte, HeartbeatPayloadSize)
+	payload[0] = kind
+	binary.BigEndian.PutUint64(payload[1:], uint64(timestamp))
+	return payload
+}
+
+// ParseHeartbeat 解析心跳负载，返回类型与 Unix 毫秒时间戳
+// 空负载（旧版本心跳）返回 ok=false
+func ParseHeartbeat(msg *BinaryMessage) (kind uint8, timestamp int64, ok bool) {
+	if msg == nil || msg.Type != TypeHeartbeat || len(msg.Payload) < HeartbeatPayloadSize {
+		return 0, 0, false
+	}
+	kind = msg.Payload[0]
+	if kind != HeartbeatPing && kind != HeartbeatPong {
+		return 0, 0, false
+	}
+	return kind, int64(binary.BigEndian.Uint64(msg.Payload[1:HeartbeatPayloadSize])), true
+}
+
 // CreateImageChunks 创建图片分片消息
 // chunkSize: 每个分片的 Payload 最大字节数 (建议 64*1024)
 func (m *BinaryProtocolManager) CreateImageChunks(imageData []byte, mime string, chunkSize int) ([][]byte, error) {
+	return m.CreateImageChunksFrom(m.NewOrigin(), imageData, mime, chunkSize)
+}
+
+// CreateImageChunksFrom 以指定来源创建图片分片消息（用于转发）
+func (m *BinaryProtocolManager) CreateImageChunksFrom(origin Origin, imageData []byte, mime string, chunkSize int) ([][]byte, error) {
 	if len(imageData) == 0 {
 		return nil, ErrInvalidInput
 	}
@@ -171,10 +370,11 @@ func (m *BinaryProtocolManager) CreateImageChunks(imageData []byte, mime string,
 		chunkSize = 64 * 1024 // 默认 64KB
 	}
 
-	msgID := m.getNextMsgID()
+	msgID := origin.MsgID
 	meta := TransferMeta{
 		Mime: mime,
 		Size: int64(len(imageData)),
+		Hash: ContentHash(imageData),
 	}
 
 	// 1. 准备元数据
@@ -208,7 +408,7 @@ func (m *BinaryProtocolManager) CreateImageChunks(imageData []byte, mime string,
 	hasMore := len(remainingData) > 0
 
 	// 创建首帧
-	startFrame, err := m.createStartFrame(TypeImage, msgID, meta, firstChunkData, hasMore)
+	startFrame, err := createStartFrame(origin, TypeImage, meta, firstChunkData, hasMore)
 	if err != nil {
 		return nil, err
 	}
@@ -240,7 +440,7 @@ func (m *BinaryProtocolManager) CreateImageChunks(imageData []byte, mime string,
 			flags = FlagMF
 		}
 
-		frame := m.pack(TypeImage, flags, msgID, seq, chunkData)
+		frame := packFrom(origin.Sender[:], TypeImage, flags, msgID, seq, chunkData)
 		chunks = append(chunks, frame)
 
 		seq++
@@ -252,6 +452,11 @@ func (m *BinaryProtocolManager) CreateImageChunks(imageData []byte, mime string,
 
 // CreateImageFrame 创建单帧图片消息 (仅适用于小图片)
 func (m *BinaryProtocolManager) CreateImageFrame(imageData []byte, mime string) ([]byte, error) {
+	return m.CreateImageFrameFrom(m.NewOrigin(), imageData, mime)
+}
+
+// CreateImageFrameFrom 以指定来源创建单帧图片消息（用于转发）
+func (m *BinaryProtocolManager) CreateImageFrameFrom(origin Origin, imageData []byte, mime string) ([]byte, error) {
 	if len(imageData) == 0 {
 		return nil, ErrInvalidInput
 	}
@@ -259,14 +464,15 @@ func (m *BinaryProtocolManager) CreateImageFrame(imageData []byte, mime string)
 	meta := TransferMeta{
 		Mime: mime,
 		Size: int64(len(imageData)),
+		Hash: ContentHash(imageData),
 	}
 
 	// 单帧意味着没有后续分片
-	return m.createStartFrame(TypeImage, m.getNextMsgID(), meta, imageData, false)
+	return createStartFrame(origin, TypeImage, meta, imageData, false)
 }
 
 // createStartFrame 创建带元数据的首帧
-func (m *BinaryProtocolManager) createStartFrame(msgType MessageType, msgID uint32, meta TransferMeta, chunkData []byte, hasMore bool) ([]byte, error) {
+func createStartFrame(origin Origin, msgType MessageType, meta TransferMeta, chunkData []byte, hasMore bool) ([]byte, error) {
 	metaJSON, err := json.Marshal(meta)
 	if err != nil {
 		return nil, err
@@ -294,13 +500,27 @@ func (m *BinaryProtocolManager) createStartFrame(msgType MessageType, msgID uint
 		flags |= FlagMF
 	}
 
-	return m.pack(msgType, flags, msgID, 0, payload), nil
+	return packFrom(origin.Sender[:], msgType, flags, origin.MsgID, 0, payload), nil
 }
 
-// pack 底层封包方法
+// pack 以本机 UUID 封包
 func (m *BinaryProtocolManager) pack(msgType MessageType, flags MessageFlags, msgID uint32, seq uint32, payload []byte) []byte {
+	return packFrom(m.deviceUUID, msgType, flags, msgID, seq, payload)
+}
+
+// packFrom 底层封包方法，开启帧校验时追加 CRC32
+func packFrom(sender []byte, msgType MessageType, flags MessageFlags, msgID uint32, seq uint32, payload []byte) []byte {
+	checksum := frameChecksum.Load()
+	if checksum {
+		flags |= FlagCRC
+	}
+
 	totalLen := HeaderSize + len(payload)
-	buffer := make([]byte, totalLen)
+	bufferLen := totalLen
+	if checksum {
+		bufferLen += ChecksumSize
+	}
+	buffer := make([]byte, bufferLen)
 
 	// Magic (2 bytes)
 	binary.BigEndian.PutUint16(buffer[0:2], ProtocolMagic)
@@ -322,7 +542,7 @@ func (m *BinaryProtocolManager) pack(msgType MessageType, flags MessageFlags, ms
 	binary.BigEndian.PutUint32(buffer[9:13], seq)
 
 	// Sender UUID (16 bytes, 从偏移13开始)
-	copy(buffer[13:29], m.deviceUUID)
+	copy(buffer[13:29], sender)
 
 	// Payload Length (4 bytes, 从偏移29开始)
 	binary.BigEndian.PutUint32(buffer[29:33], uint32(len(payload)))
@@ -332,6 +552,11 @@ func (m *BinaryProtocolManager) pack(msgType MessageType, flags MessageFlags, ms
 		copy(buffer[HeaderSize:], payload)
 	}
 
+	// CRC32 (4 bytes, 覆盖头部与 Payload)
+	if checksum {
+		binary.BigEndian.PutUint32(buffer[totalLen:], crc32.ChecksumIEEE(buffer[:totalLen]))
+	}
+
 	return buffer
 }
 
@@ -375,6 +600,18 @@ func (m *BinaryProtocolManager) Parse(data []byte) (*BinaryMessage, error) {
 
 	payload := data[HeaderSize : HeaderSize+payloadLen]
 
+	// 校验帧尾 CRC32
+	if flags&FlagCRC != 0 {
+		end := HeaderSize + int(payloadLen)
+		if len(data) < end+ChecksumSize {
+			return nil, fmt.Errorf("%w: 缺少校验值", ErrChecksumMismatch)
+		}
+		want := binary.BigEndian.Uint32(data[end : end+ChecksumSize])
+		if got := crc32.ChecksumIEEE(data[:end]); got != want {
+			return nil, fmt.Errorf("%w: 期望 %08x，实际 %08x", ErrChecksumMismatch, want, got)
+		}
+	}
+
 	msg := &BinaryMessage{
 		Type:       msgType,
 		Flags:      flags,
@@ -418,6 +655,14 @@ func (m *BinaryProtocolManager) isLoopback(senderUUID []byte) bool {
 // 辅助方法
 // ==========================================
 
+// Origin 消息的原始来源
+func (msg *BinaryMessage) Origin() Origin {
+	var o Origin
+	copy(o.Sender[:], msg.SenderUUID)
+	o.MsgID = msg.MsgID
+	return o
+}
+
 // GetTextContent 从文本消息中获取文本内容
 func (msg *BinaryMessage) GetTextContent() string {
 	if msg.Type != TypeText {
@@ -439,6 +684,67 @@ func (msg *BinaryMessage) GetHandshakeMeta() (*HandshakeMeta, error) {
 	return &meta, nil
 }
 
+// GetError 从错误消息中获取错误负载
+func (msg *BinaryMessage) GetError() (*ErrorPayload, error) {
+	if msg.Type != TypeError {
+		return nil, fmt.Errorf("不是错误消息")
+	}
+
+	var payload ErrorPayload
+	if err := json.Unmarshal(msg.Payload, &payload); err != nil {
+		return nil, err
+	}
+	if payload.Code == "" {
+		return nil, fmt.Errorf("错误消息缺少错误码")
+	}
+	return &payload, nil
+}
+
+// HeaderType 从原始数据的头部读取消息类型
+func HeaderType(data []byte) (MessageType, bool) {
+	if len(data) < HeaderSize || binary.BigEndian.Uint16(data[0:2]) != ProtocolMagic {
+		return 0, false
+	}
+	return MessageType(data[2] & 0x0F), true
+}
+
+// HeaderOrigin 从原始数据的头部读取来源（发送者 UUID 与消息 ID），用于在整条消息无法解析时回复错误
+func HeaderOrigin(data []byte) (Origin, bool) {
+	var o Origin
+	if len(data) < HeaderSize || binary.BigEndian.Uint16(data[0:2]) != ProtocolMagic {
+		return o, false
+	}
+	copy(o.Sender[:], data[13:29])
+	o.MsgID = binary.BigEndian.Uint32(data[5:9])
+	return o, true
+}
+
+// HeaderPayloadLen 从原始数据的头部读取 Payload 长度（不含头部与帧校验）
+func HeaderPayloadLen(data []byte) (uint32, bool) {
+	if len(data) < HeaderSize || binary.BigEndian.Uint16(data[0:2]) != ProtocolMagic {
+		return 0, false
+	}
+	return binary.BigEndian.Uint32(data[29:33]), true
+}
+
+// ContentHash 计算完整条目的 SHA-256（十六进制），填入首帧元数据
+func ContentHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// VerifyContentHash 校验重组后的条目与首帧元数据中的哈希是否一致
+// 元数据中没有哈希（旧版本发送方）时不校验
+func VerifyContentHash(meta *TransferMeta, data []byte) error {
+	if meta == nil || meta.Hash == "" {
+		return nil
+	}
+	if got := ContentHash(data); !strings.EqualFold(got, meta.Hash) {
+		return fmt.Errorf("%w: 期望 %s，实际 %s", ErrHashMismatch, meta.Hash, got)
+	}
+	return nil
+}
+
 // GetImageData 从图片消息中获取图片数据
 func (msg *BinaryMessage) GetImageData() []byte {
 	if msg.Type != TypeImage {
@@ -0,0 +1,348 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// testSender 测试中对端的设备 UUID
+var testSender = [16]byte{0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f}
+
+// newTestManager 创建本机 UUID 与 testSender 不同的协议管理器，解析 testSender 发出的帧时不会判为回环
+func newTestManager() *BinaryProtocolManager {
+	return &BinaryProtocolManager{deviceUUID: bytes.Repeat([]byte{0xff}, 16)}
+}
+
+// withFrameChecksum 在测试期间设置帧校验，结束后恢复
+func withFrameChecksum(t *testing.T, enabled bool) {
+	t.Helper()
+	prev := frameChecksum.Load()
+	frameChecksum.Store(enabled)
+	t.Cleanup(func() { frameChecksum.Store(prev) })
+}
+
+// randomBytes 生成 n 字节的随机数据
+func randomBytes(rng *rand.Rand, n int) []byte {
+	b := make([]byte, n)
+	rng.Read(b)
+	return b
+}
+
+func TestPackParseRoundTrip(t *testing.T) {
+	m := newTestManager()
+	rng := rand.New(rand.NewSource(1))
+	types := []MessageType{TypeHeartbeat, TypeHandshake, TypeText, TypeImage, TypeFile, TypeError}
+	sizes := []int{0, 1, 2, 32, 1024, 65536, 300000}
+
+	for _, checksum := range []bool{false, true} {
+		withFrameChecksum(t, checksum)
+		for _, msgType := range types {
+			for _, size := range sizes {
+				name := fmt.Sprintf("crc=%v/type=%d/size=%d", checksum, msgType, size)
+				t.Run(name, func(t *testing.T) {
+					flags := MessageFlags(rng.Intn(2)) // 只取 MF，HAS_META 需要合法的元数据
+					msgID := rng.Uint32()
+					seq := rng.Uint32()
+					payload := randomBytes(rng, size)
+
+					frame := packFrom(testSender[:], msgType, flags, msgID, seq, payload)
+					wantLen := HeaderSize + size
+					if checksum {
+						wantLen += ChecksumSize
+					}
+					if len(frame) != wantLen {
+						t.Fatalf("帧长度 = %d，期望 %d", len(frame), wantLen)
+					}
+
+					msg, err := m.Parse(frame)
+					if err != nil {
+						t.Fatalf("Parse: %v", err)
+					}
+					wantFlags := flags
+					if checksum {
+						wantFlags |= FlagCRC
+					}
+					if msg.Type != msgType || msg.Flags != wantFlags || msg.MsgID != msgID || msg.Seq != seq {
+						t.Fatalf("头部 = (%d, %#x, %d, %d)，期望 (%d, %#x, %d, %d)",
+							msg.Type, msg.Flags, msg.MsgID, msg.Seq, msgType, wantFlags, msgID, seq)
+					}
+					if !bytes.Equal(msg.SenderUUID, testSender[:]) {
+						t.Fatalf("SenderUUID = %x", msg.SenderUUID)
+					}
+					if !bytes.Equal(msg.Payload, payload) {
+						t.Fatalf("Payload 不一致")
+					}
+					if got := msg.Origin(); got != (Origin{Sender: testSender, MsgID: msgID}) {
+						t.Fatalf("Origin = %+v", got)
+					}
+				})
+			}
+		}
+	}
+}
+
+func TestImageChunksRoundTrip(t *testing.T) {
+	m := newTestManager()
+	rng := rand.New(rand.NewSource(2))
+	sizes := []int{1, 100, 1023, 1024, 1025, 4096, 64*1024 + 1, 300000}
+	chunkSizes := []int{0, 1024, 1500, 4096, 64 * 1024}
+
+	for _, checksum := range []bool{false, true} {
+		withFrameChecksum(t, checksum)
+		for _, size := range sizes {
+			for _, chunkSize := range chunkSizes {
+				name := fmt.Sprintf("crc=%v/size=%d/chunk=%d", checksum, size, chunkSize)
+				t.Run(name, func(t *testing.T) {
+					data := randomBytes(rng, size)
+					origin := Origin{Sender: testSender, MsgID: rng.Uint32()}
+					frames, err := m.CreateImageChunksFrom(origin, data, "image/png", chunkSize)
+					if err != nil {
+						t.Fatalf("CreateImageChunksFrom: %v", err)
+					}
+
+					limit := chunkSize
+					if limit < 1024 {
+						limit = 64 * 1024
+					}
+					got, meta := reassemble(t, m, frames, origin, limit)
+					if !bytes.Equal(got, data) {
+						t.Fatalf("重组结果不一致：%d 字节，期望 %d 字节", len(got), len(data))
+					}
+					if meta.Mime != "image/png" || meta.Size != int64(size) {
+						t.Fatalf("元数据 = %+v", meta)
+					}
+					if err := VerifyContentHash(meta, got); err != nil {
+						t.Fatalf("VerifyContentHash: %v", err)
+					}
+				})
+			}
+		}
+	}
+}
+
+// reassemble 按接收方的规则解析并重组分片，同时检查每一帧的头部
+func reassemble(t *testing.T, m *BinaryProtocolManager, frames [][]byte, origin Origin, chunkSize int) ([]byte, *TransferMeta) {
+	t.Helper()
+	var buf []byte
+	var meta *TransferMeta
+	for i, frame := range frames {
+		msg, err := m.Parse(frame)
+		if err != nil {
+			t.Fatalf("第 %d 帧 Parse: %v", i, err)
+		}
+		if msg.Type != TypeImage || msg.Origin() != origin || msg.Seq != uint32(i) {
+			t.Fatalf("第 %d 帧头部 = (%d, %+v, seq %d)", i, msg.Type, msg.Origin(), msg.Seq)
+		}
+		if len(msg.Payload) > chunkSize {
+			t.Fatalf("第 %d 帧 Payload %d 字节，超过分片大小 %d", i, len(msg.Payload), chunkSize)
+		}
+		last := i == len(frames)-1
+		if (msg.Flags&FlagMF == 0) != last {
+			t.Fatalf("第 %d 帧 MF 标志错误: %#x", i, msg.Flags)
+		}
+		if (msg.Flags&FlagHasMeta != 0) != (i == 0) {
+			t.Fatalf("第 %d 帧 HAS_META 标志错误: %#x", i, msg.Flags)
+		}
+		if i == 0 {
+			if msg.Meta == nil {
+				t.Fatalf("首帧缺少元数据")
+			}
+			meta = msg.Meta
+		}
+		buf = append(buf, msg.GetImageData()...)
+	}
+	return buf, meta
+}
+
+func TestImageFrameRoundTrip(t *testing.T) {
+	m := newTestManager()
+	data := []byte("\x89PNG\r\n\x1a\nsmall image")
+	origin := Origin{Sender: testSender, MsgID: 42}
+	frame, err := m.CreateImageFrameFrom(origin, data, "image/png")
+	if err != nil {
+		t.Fatalf("CreateImageFrameFrom: %v", err)
+	}
+	msg, err := m.Parse(frame)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if msg.Flags != FlagHasMeta {
+		t.Fatalf("Flags = %#x，期望只有 HAS_META", msg.Flags)
+	}
+	if !bytes.Equal(msg.GetImageData(), data) {
+		t.Fatalf("图片数据不一致")
+	}
+	if err := VerifyContentHash(msg.Meta, data); err != nil {
+		t.Fatalf("VerifyContentHash: %v", err)
+	}
+}
+
+func TestCreateRejectsEmptyInput(t *testing.T) {
+	m := newTestManager()
+	origin := Origin{Sender: testSender, MsgID: 1}
+	if _, err := m.CreateTextFrom(origin, ""); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("CreateTextFrom(\"\") = %v", err)
+	}
+	if _, err := m.CreateImageChunksFrom(origin, nil, "image/png", 0); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("CreateImageChunksFrom(nil) = %v", err)
+	}
+	if _, err := m.CreateImageFrameFrom(origin, nil, "image/png"); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("CreateImageFrameFrom(nil) = %v", err)
+	}
+	if _, err := m.CreateError("", origin, ""); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("CreateError(\"\") = %v", err)
+	}
+}
+
+func TestErrorTargetRoundTrip(t *testing.T) {
+	sender := NewBinaryProtocolManagerWithUUID(testSender)
+	receiver := newTestManager()
+	target := Origin{Sender: [16]byte{0xab, 0xcd}, MsgID: 42}
+
+	for _, tt := range []struct {
+		name   string
+		target Origin
+		ok     bool
+	}{
+		{"指定发送者", target, true},
+		{"没有发送者", Origin{MsgID: 42}, false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := sender.CreateError(ErrorCodeTooLarge, tt.target, "原因")
+			if err != nil {
+				t.Fatalf("CreateError: %v", err)
+			}
+			msg, err := receiver.Parse(data)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			payload, err := msg.GetError()
+			if err != nil {
+				t.Fatalf("GetError: %v", err)
+			}
+			if payload.Code != ErrorCodeTooLarge || payload.MsgID != 42 || payload.Reason != "原因" {
+				t.Errorf("错误负载 = %+v", payload)
+			}
+			if got, ok := payload.Origin(); ok != tt.ok || (ok && got != tt.target) {
+				t.Errorf("Origin() = %+v, %v，期望 %+v, %v", got, ok, tt.target, tt.ok)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	m := newTestManager()
+	valid := packFrom(testSender[:], TypeText, FlagNone, 7, 0, []byte("hello"))
+
+	badMagic := bytes.Clone(valid)
+	badMagic[0] = 'X'
+
+	truncated := valid[:len(valid)-1]
+
+	metaPayload := append([]byte{0x00, 0x05}, []byte("{oops")...)
+	badMeta := packFrom(testSender[:], TypeImage, FlagHasMeta, 7, 0, metaPayload)
+
+	withCRC := func(frame []byte) []byte {
+		frame = bytes.Clone(frame)
+		frame[3] |= byte(FlagCRC)
+		return binary.BigEndian.AppendUint32(frame, 0)
+	}
+	crcMismatch := withCRC(valid)
+	crcMissing := withCRC(valid)
+	crcMissing = crcMissing[:len(crcMissing)-ChecksumSize]
+
+	loopback := packFrom(m.deviceUUID, TypeText, FlagNone, 7, 0, []byte("hello"))
+
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"空数据", nil, ErrPacketTooShort},
+		{"不足头部长度", valid[:HeaderSize-1], ErrPacketTooShort},
+		{"魔数错误", badMagic, ErrInvalidMagic},
+		{"负载不完整", truncated, nil},
+		{"元数据无效", badMeta, ErrMetaParseFailed},
+		{"校验值不匹配", crcMismatch, ErrChecksumMismatch},
+		{"缺少校验值", crcMissing, ErrChecksumMismatch},
+		{"回环", loopback, ErrLoopbackDetected},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := m.Parse(tt.data)
+			if err == nil {
+				t.Fatalf("Parse 成功: %+v", msg)
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Fatalf("Parse 错误 = %v，期望 %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseIgnoresTrailingBytesWithoutCRC(t *testing.T) {
+	// 旧版本接收方按 PayloadLen 截取 Payload，帧尾多出的字节（如 CRC）被忽略
+	m := newTestManager()
+	frame := packFrom(testSender[:], TypeText, FlagNone, 7, 0, []byte("hello"))
+	frame = append(frame, 0xde, 0xad, 0xbe, 0xef)
+	msg, err := m.Parse(frame)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if msg.GetTextContent() != "hello" {
+		t.Fatalf("文本 = %q", msg.GetTextContent())
+	}
+}
+
+func TestVerifyContentHash(t *testing.T) {
+	data := []byte("clipboard")
+	hash := ContentHash(data)
+	tests := []struct {
+		name string
+		meta *TransferMeta
+		data []byte
+		ok   bool
+	}{
+		{"没有元数据", nil, data, true},
+		{"没有哈希", &TransferMeta{}, data, true},
+		{"一致", &TransferMeta{Hash: hash}, data, true},
+		{"大小写不敏感", &TransferMeta{Hash: strings.ToUpper(hash)}, data, true},
+		{"不一致", &TransferMeta{Hash: hash}, []byte("clipboarD"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := VerifyContentHash(tt.meta, tt.data)
+			if tt.ok && err != nil {
+				t.Fatalf("VerifyContentHash: %v", err)
+			}
+			if !tt.ok && !errors.Is(err, ErrHashMismatch) {
+				t.Fatalf("VerifyContentHash = %v，期望 ErrHashMismatch", err)
+			}
+		})
+	}
+}
+
+func TestHeaderAccessors(t *testing.T) {
+	frame := packFrom(testSender[:], TypeError, FlagNone, 0xdeadbeef, 0, nil)
+	if o, ok := HeaderOrigin(frame); !ok || o != (Origin{Sender: testSender, MsgID: 0xdeadbeef}) {
+		t.Errorf("HeaderOrigin = %+v, %v", o, ok)
+	}
+	if n, ok := HeaderPayloadLen(frame); !ok || n != 0 {
+		t.Errorf("HeaderPayloadLen = %d, %v", n, ok)
+	}
+	if typ, ok := HeaderType(frame); !ok || typ != TypeError {
+		t.Errorf("HeaderType = %d, %v", typ, ok)
+	}
+	if _, ok := HeaderOrigin(frame[:HeaderSize-1]); ok {
+		t.Errorf("HeaderOrigin 接受了不足头部长度的数据")
+	}
+	frame[0] = 0
+	if _, ok := HeaderType(frame); ok {
+		t.Errorf("HeaderType 接受了魔数错误的数据")
+	}
+}
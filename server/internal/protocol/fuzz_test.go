@@ -0,0 +1,129 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+)
+
+// ==========================================
+// 模糊测试
+// ==========================================
+//
+// Parse 直接处理来自网络的数据，任何输入都不能导致 panic；能解析的输入
+// 重新封包后应得到相同的消息。运行：
+//   go test ./internal/protocol -fuzz FuzzParse
+//   go test ./internal/protocol -fuzz FuzzParseMeta
+
+// addVectorSeeds 把金样向量加入语料
+func addVectorSeeds(f *testing.F) {
+	data, err := os.ReadFile(vectorsPath)
+	if err != nil {
+		f.Fatal(err)
+	}
+	var vectors []vector
+	if err := json.Unmarshal(data, &vectors); err != nil {
+		f.Fatal(err)
+	}
+	for _, v := range vectors {
+		frame, err := hex.DecodeString(v.Hex)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(frame)
+	}
+}
+
+func FuzzParse(f *testing.F) {
+	addVectorSeeds(f)
+	f.Add([]byte{})
+	f.Add(make([]byte, HeaderSize))
+	f.Add(packFrom(testSender[:], TypeImage, FlagHasMeta|FlagMF, 1, 0, []byte{0xff, 0xff, '{'}))
+	f.Add(packFrom(testSender[:], TypeText, FlagCRC, 1, 0, []byte("no checksum")))
+
+	m := newTestManager()
+	f.Fuzz(func(t *testing.T, data []byte) {
+		msg, err := m.Parse(data)
+		if err != nil {
+			return
+		}
+
+		if len(msg.SenderUUID) != 16 {
+			t.Fatalf("SenderUUID 长度 = %d", len(msg.SenderUUID))
+		}
+		if msg.Meta != nil && !bytes.HasSuffix(msg.Payload, msg.BinaryData) {
+			t.Fatalf("BinaryData 不是 Payload 的后缀")
+		}
+
+		// 重新封包（不带校验）后解析结果一致
+		var sender [16]byte
+		copy(sender[:], msg.SenderUUID)
+		repacked := packFrom(sender[:], msg.Type, msg.Flags&^FlagCRC, msg.MsgID, msg.Seq, msg.Payload)
+		again, err := m.Parse(repacked)
+		if err != nil {
+			t.Fatalf("重新封包后解析失败: %v", err)
+		}
+		if again.Type != msg.Type || again.Flags != msg.Flags&^FlagCRC || again.MsgID != msg.MsgID || again.Seq != msg.Seq {
+			t.Fatalf("重新封包后头部不一致")
+		}
+		if !bytes.Equal(again.Payload, msg.Payload) || !bytes.Equal(again.BinaryData, msg.BinaryData) {
+			t.Fatalf("重新封包后负载不一致")
+		}
+
+		// 其余解析入口同样不能 panic
+		HeaderOrigin(data)
+		HeaderPayloadLen(data)
+		HeaderType(data)
+		ParseHeartbeat(msg)
+		msg.GetTextContent()
+		msg.GetImageData()
+		msg.GetHandshakeMeta()
+		if payload, err := msg.GetError(); err == nil {
+			payload.Origin()
+		}
+		VerifyContentHash(msg.Meta, msg.BinaryData)
+	})
+}
+
+func FuzzParseMeta(f *testing.F) {
+	f.Add([]byte(`{"mime":"image/png","size":1500}`), []byte{1, 2, 3})
+	f.Add([]byte(`{"name":"a.txt","hash":"00","width":-1,"height":1e9}`), []byte{})
+	f.Add([]byte(`{"size":"big"}`), []byte{0})
+	f.Add([]byte(`null`), []byte{})
+	f.Add([]byte(`{`), []byte{})
+
+	m := newTestManager()
+	f.Fuzz(func(t *testing.T, metaJSON, data []byte) {
+		if len(metaJSON) > 65535 {
+			return
+		}
+		payload := binary.BigEndian.AppendUint16(nil, uint16(len(metaJSON)))
+		payload = append(payload, metaJSON...)
+		payload = append(payload, data...)
+		frame := packFrom(testSender[:], TypeImage, FlagHasMeta, 1, 0, payload)
+
+		msg, err := m.Parse(frame)
+		if err != nil {
+			if !errors.Is(err, ErrMetaParseFailed) {
+				t.Fatalf("元数据错误应为 ErrMetaParseFailed，实际 %v", err)
+			}
+			if json.Valid(metaJSON) && json.Unmarshal(metaJSON, &TransferMeta{}) == nil {
+				t.Fatalf("合法的元数据解析失败: %v", err)
+			}
+			return
+		}
+		if msg.Meta == nil {
+			t.Fatalf("解析成功但没有元数据")
+		}
+		if !bytes.Equal(msg.BinaryData, data) {
+			t.Fatalf("BinaryData 不一致")
+		}
+		if !bytes.Equal(msg.GetImageData(), data) {
+			t.Fatalf("GetImageData 不一致")
+		}
+	})
+}
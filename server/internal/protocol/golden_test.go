@@ -0,0 +1,269 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// ==========================================
+// 协议金样向量
+// ==========================================
+//
+// 固定输入生成的帧字节保存在 testdata/vectors.json，并同步生成 ArkTS 测试使用的
+// entry/src/test/BinaryProtocolVectors.ets，两端按同一组字节校验封包与解析结果，
+// 保证 Go 与 HarmonyOS 实现的线上格式一致。修改协议后运行
+//   go test ./internal/protocol -run Golden -update
+// 重新生成两个文件，并检查差异是否符合预期。
+
+var update = flag.Bool("update", false, "重新生成协议金样向量文件")
+
+const (
+	vectorsPath = "testdata/vectors.json"
+	arktsPath   = "../../../entry/src/test/BinaryProtocolVectors.ets"
+)
+
+// vector 一帧金样数据及其解析结果
+type vector struct {
+	Name       string `json:"name"`
+	Hex        string `json:"hex"`
+	Type       uint8  `json:"type"`
+	Flags      uint8  `json:"flags"`
+	MsgID      uint32 `json:"msgId"`
+	Seq        uint32 `json:"seq"`
+	PayloadHex string `json:"payloadHex"`
+	Meta       string `json:"meta,omitempty"`    // 元数据 JSON
+	DataHex    string `json:"dataHex,omitempty"` // 剥离元数据后的二进制数据
+}
+
+// goldenImage 金样图片数据：两帧分片（分片大小 1024）
+func goldenImage() []byte {
+	data := make([]byte, 1500)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	return data
+}
+
+// buildVectors 以固定的发送者、消息 ID 与内容生成金样帧
+func buildVectors(t *testing.T) []vector {
+	t.Helper()
+	withFrameChecksum(t, false)
+	m := newTestManager()
+
+	var frames []struct {
+		name string
+		data []byte
+	}
+	add := func(name string, data []byte) {
+		frames = append(frames, struct {
+			name string
+			data []byte
+		}{name, data})
+	}
+
+	add("heartbeat_empty", packFrom(testSender[:], TypeHeartbeat, FlagNone, 1, 0, nil))
+	add("heartbeat_ping", packFrom(testSender[:], TypeHeartbeat, FlagNone, 2, 0,
+		heartbeatPayload(HeartbeatPing, 1700000000000)))
+
+	handshake, err := json.Marshal(HandshakeMeta{Name: "Mate60 Pro", OS: "HarmonyOS 5.0", Ver: 11})
+	if err != nil {
+		t.Fatal(err)
+	}
+	add("handshake", packFrom(testSender[:], TypeHandshake, FlagNone, 3, 0, handshake))
+
+	text, err := m.CreateTextFrom(Origin{Sender: testSender, MsgID: 4}, "Hello NextPaste!")
+	if err != nil {
+		t.Fatal(err)
+	}
+	add("text_ascii", text)
+
+	text, err = m.CreateTextFrom(Origin{Sender: testSender, MsgID: 5}, "你好，剪贴板 📋")
+	if err != nil {
+		t.Fatal(err)
+	}
+	add("text_utf8", text)
+
+	chunks, err := m.CreateImageChunksFrom(Origin{Sender: testSender, MsgID: 6}, goldenImage(), "image/png", 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chunks) != 2 {
+		t.Fatalf("金样图片应为 2 帧，实际 %d 帧", len(chunks))
+	}
+	add("image_start", chunks[0])
+	add("image_end", chunks[1])
+
+	single, err := m.CreateImageFrameFrom(Origin{Sender: testSender, MsgID: 7}, []byte("\x89PNG\r\n\x1a\n"), "image/png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	add("image_single", single)
+
+	errPayload, err := json.Marshal(ErrorPayload{Code: ErrorCodeTooLarge, MsgID: 6, Reason: "too large"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	add("error_too_large", packFrom(testSender[:], TypeError, FlagNone, 8, 0, errPayload))
+
+	frameChecksum.Store(true)
+	text, err = m.CreateTextFrom(Origin{Sender: testSender, MsgID: 9}, "checksummed")
+	frameChecksum.Store(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	add("text_crc", text)
+
+	vectors := make([]vector, 0, len(frames))
+	for _, f := range frames {
+		msg, err := m.Parse(f.data)
+		if err != nil {
+			t.Fatalf("%s: Parse: %v", f.name, err)
+		}
+		v := vector{
+			Name:       f.name,
+			Hex:        hex.EncodeToString(f.data),
+			Type:       uint8(msg.Type),
+			Flags:      uint8(msg.Flags),
+			MsgID:      msg.MsgID,
+			Seq:        msg.Seq,
+			PayloadHex: hex.EncodeToString(msg.Payload),
+		}
+		if msg.Meta != nil {
+			meta, err := json.Marshal(msg.Meta)
+			if err != nil {
+				t.Fatal(err)
+			}
+			v.Meta = string(meta)
+			v.DataHex = hex.EncodeToString(msg.BinaryData)
+		}
+		vectors = append(vectors, v)
+	}
+	return vectors
+}
+
+// renderVectorsJSON 金样向量的 JSON 文件内容
+func renderVectorsJSON(t *testing.T, vectors []vector) []byte {
+	t.Helper()
+	data, err := json.MarshalIndent(vectors, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return append(data, '\n')
+}
+
+// renderVectorsArkTS 金样向量的 ArkTS 文件内容
+func renderVectorsArkTS(vectors []vector) []byte {
+	var b strings.Builder
+	b.WriteString("// 由 server/internal/protocol/golden_test.go 生成，请勿手动修改\n")
+	b.WriteString("// 重新生成：cd server && go test ./internal/protocol -run Golden -update\n\n")
+	b.WriteString("export interface BinaryVector {\n")
+	b.WriteString("  name: string;\n  hex: string;\n  type: number;\n  flags: number;\n  msgId: number;\n  seq: number;\n")
+	b.WriteString("  payloadHex: string;\n  meta?: string;\n  dataHex?: string;\n}\n\n")
+	b.WriteString("export const BINARY_VECTORS: BinaryVector[] = [\n")
+	for _, v := range vectors {
+		b.WriteString("  {\n")
+		fmt.Fprintf(&b, "    name: %s,\n", tsString(v.Name))
+		fmt.Fprintf(&b, "    hex: %s,\n", tsString(v.Hex))
+		fmt.Fprintf(&b, "    type: %d,\n    flags: %d,\n    msgId: %d,\n    seq: %d,\n", v.Type, v.Flags, v.MsgID, v.Seq)
+		fmt.Fprintf(&b, "    payloadHex: %s", tsString(v.PayloadHex))
+		if v.Meta != "" {
+			fmt.Fprintf(&b, ",\n    meta: %s,\n    dataHex: %s", tsString(v.Meta), tsString(v.DataHex))
+		}
+		b.WriteString("\n  },\n")
+	}
+	b.WriteString("];\n")
+	return []byte(b.String())
+}
+
+// tsString ArkTS 单引号字符串字面量
+func tsString(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `'`, `\'`)
+	return "'" + s + "'"
+}
+
+func TestGoldenVectors(t *testing.T) {
+	vectors := buildVectors(t)
+	files := []struct {
+		path     string
+		data     []byte
+		optional bool // 单独检出 server 目录时不存在
+	}{
+		{vectorsPath, renderVectorsJSON(t, vectors), false},
+		{arktsPath, renderVectorsArkTS(vectors), true},
+	}
+
+	for _, f := range files {
+		if *update {
+			if err := os.MkdirAll(filepath.Dir(f.path), 0o755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(f.path, f.data, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		want, err := os.ReadFile(f.path)
+		if os.IsNotExist(err) && f.optional {
+			t.Logf("跳过 %s：文件不存在", f.path)
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(f.data, want) {
+			t.Errorf("%s 与当前实现生成的金样不一致；协议变更是预期的话用 -update 重新生成", f.path)
+		}
+	}
+}
+
+func TestGoldenVectorsParse(t *testing.T) {
+	// 直接从文件解析，确保已保存的字节（而不只是当前实现的输出）仍能被正确解析
+	data, err := os.ReadFile(vectorsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var vectors []vector
+	if err := json.Unmarshal(data, &vectors); err != nil {
+		t.Fatal(err)
+	}
+
+	m := newTestManager()
+	for _, v := range vectors {
+		t.Run(v.Name, func(t *testing.T) {
+			frame, err := hex.DecodeString(v.Hex)
+			if err != nil {
+				t.Fatal(err)
+			}
+			msg, err := m.Parse(frame)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if uint8(msg.Type) != v.Type || uint8(msg.Flags) != v.Flags || msg.MsgID != v.MsgID || msg.Seq != v.Seq {
+				t.Fatalf("头部 = (%d, %#x, %d, %d)", msg.Type, msg.Flags, msg.MsgID, msg.Seq)
+			}
+			if !bytes.Equal(msg.SenderUUID, testSender[:]) {
+				t.Fatalf("SenderUUID = %x", msg.SenderUUID)
+			}
+			if got := hex.EncodeToString(msg.Payload); got != v.PayloadHex {
+				t.Fatalf("Payload = %s", got)
+			}
+			if v.Meta != "" {
+				meta, _ := json.Marshal(msg.Meta)
+				if string(meta) != v.Meta {
+					t.Fatalf("Meta = %s", meta)
+				}
+				if got := hex.EncodeToString(msg.BinaryData); got != v.DataHex {
+					t.Fatalf("BinaryData = %s", got)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package protocol
+
+import (
+	"sync"
+	"time"
+)
+
+// SeenCache 记录近期处理过的条目来源，防止同一条目被重复处理或在多个连接之间循环转发
+type SeenCache struct {
+	entries map[string]time.Time
+	ttl     time.Duration
+	maxSize int
+	mu      sync.Mutex
+}
+
+// NewSeenCache 创建去重缓存
+// ttl: 记录保留时长；maxSize: 最多保留的记录数
+func NewSeenCache(ttl time.Duration, maxSize int) *SeenCache {
+	return &SeenCache{
+		entries: make(map[string]time.Time),
+		ttl:     ttl,
+		maxSize: maxSize,
+	}
+}
+
+// MarkNew 记录来源，首次出现时返回 true，已处理过返回 false
+func (c *SeenCache) MarkNew(origin Origin) bool {
+	key := origin.Key()
+	now := time.Now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if seenAt, ok := c.entries[key]; ok && now.Sub(seenAt) < c.ttl {
+		return false
+	}
+	if len(c.entries) >= c.maxSize {
+		c.evict(now)
+	}
+	c.entries[key] = now
+	return true
+}
+
+// evict 清理过期记录，仍然超出容量时淘汰最旧的记录（调用方需持有 c.mu）
+func (c *SeenCache) evict(now time.Time) {
+	var oldestKey string
+	var oldest time.Time
+	for key, seenAt := range c.entries {
+		if now.Sub(seenAt) >= c.ttl {
+			delete(c.entries, key)
+			continue
+		}
+		if oldestKey == "" || seenAt.Before(oldest) {
+			oldestKey, oldest = key, seenAt
+		}
+	}
+	if len(c.entries) >= c.maxSize && oldestKey != "" {
+		delete(c.entries, oldestKey)
+	}
+}
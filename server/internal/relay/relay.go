@@ -0,0 +1,219 @@
+package relay
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ==========================================
+// 中继服务器（relay-server）客户端辅助
+// ==========================================
+//
+// 中继服务器按房间隔离：同一房间（/v2/ws/{roomID}）内的设备互相转发剪贴板。
+// 房间 ID 相当于共享密钥，知道房间 ID 的设备都可以加入，因此默认生成
+// 128 位随机 ID，并以分享链接的形式在设备之间传递。
+
+// 中继服务器标识与能力
+const (
+	ServiceName        = "nextpaste-relay"
+	FeatureRoomMembers = "room-members"
+)
+
+// ShareScheme 分享链接协议，二维码内容即分享链接
+const ShareScheme = "nextpaste"
+
+// roomIDEncoding 房间 ID 编码：小写 base32，无填充，可直接用在 URL 路径中
+var roomIDEncoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// httpClient 访问中继 HTTP 接口使用的客户端
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// Health 中继服务器健康检查结果
+type Health struct {
+	Status   string   `json:"status"`
+	Service  string   `json:"service"`
+	Features []string `json:"features,omitempty"`
+}
+
+// Supports 中继服务器是否支持指定能力
+func (h *Health) Supports(feature string) bool {
+	return slices.Contains(h.Features, feature)
+}
+
+// Member 房间成员
+type Member struct {
+	ID          string `json:"id"`
+	Sender      string `json:"sender,omitempty"`
+	Name        string `json:"name,omitempty"`
+	OS          string `json:"os,omitempty"`
+	ConnectedAt int64  `json:"connectedAt"`
+}
+
+// GenerateRoomID 生成随机房间 ID（128 位，26 个字符）
+func GenerateRoomID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("生成房间 ID 失败: %w", err)
+	}
+	return roomIDEncoding.EncodeToString(buf), nil
+}
+
+// ValidateRoomID 检查房间 ID 是否可以用作 URL 路径段
+func ValidateRoomID(roomID string) error {
+	if roomID == "" {
+		return fmt.Errorf("房间 ID 不能为空")
+	}
+	if strings.ContainsAny(roomID, "/?#%") || strings.TrimSpace(roomID) != roomID {
+		return fmt.Errorf("房间 ID 不能包含空白或 / ? # %% 字符")
+	}
+	return nil
+}
+
+// NormalizeBaseURL 规范化中继服务器地址，返回 http(s) 形式的基础地址
+// 支持 http/https/ws/wss 前缀，省略时默认 http；路径中的 /ws、/v2/ws 后缀会被去掉
+func NormalizeBaseURL(raw string) (*url.URL, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil, fmt.Errorf("中继服务器地址不能为空")
+	}
+	if !strings.Contains(raw, "://") {
+		raw = "http://" + raw
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("中继服务器地址无效: %w", err)
+	}
+	switch u.Scheme {
+	case "http", "https":
+	case "ws":
+		u.Scheme = "http"
+	case "wss":
+		u.Scheme = "https"
+	default:
+		return nil, fmt.Errorf("不支持的协议: %s", u.Scheme)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("中继服务器地址缺少主机名")
+	}
+
+	path := strings.TrimRight(u.Path, "/")
+	path = strings.TrimSuffix(path, "/v2/ws")
+	path = strings.TrimSuffix(path, "/ws")
+	u.Path = path
+	u.RawQuery = ""
+	u.Fragment = ""
+	return u, nil
+}
+
+// RoomURL 构造房间的 V2 WebSocket 地址，token 非空时附加在查询参数中
+func RoomURL(baseURL, roomID, token string) (string, error) {
+	u, err := NormalizeBaseURL(baseURL)
+	if err != nil {
+		return "", err
+	}
+	if err := ValidateRoomID(roomID); err != nil {
+		return "", err
+	}
+
+	if u.Scheme == "https" {
+		u.Scheme = "wss"
+	} else {
+		u.Scheme = "ws"
+	}
+	u.Path += "/v2/ws/" + roomID
+	if token != "" {
+		u.RawQuery = url.Values{"token": {token}}.Encode()
+	}
+	return u.String(), nil
+}
+
+// ShareLink 构造分享链接（nextpaste://relay?url=...&room=...），不包含访问令牌
+func ShareLink(baseURL, roomID string) (string, error) {
+	u, err := NormalizeBaseURL(baseURL)
+	if err != nil {
+		return "", err
+	}
+	if err := ValidateRoomID(roomID); err != nil {
+		return "", err
+	}
+	query := url.Values{"url": {u.String()}, "room": {roomID}}
+	return ShareScheme + "://relay?" + query.Encode(), nil
+}
+
+// CheckHealth 请求中继服务器的 /health，确认地址指向 NextPaste 中继
+func CheckHealth(ctx context.Context, baseURL string) (*Health, error) {
+	u, err := NormalizeBaseURL(baseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	var health Health
+	if err := getJSON(ctx, u.String()+"/health", "", &health); err != nil {
+		return nil, err
+	}
+	if health.Service != ServiceName {
+		return nil, fmt.Errorf("不是 NextPaste 中继服务器")
+	}
+	if health.Status != "ok" {
+		return nil, fmt.Errorf("中继服务器状态异常: %s", health.Status)
+	}
+	return &health, nil
+}
+
+// FetchMembers 查询房间的在线成员（需要中继支持 room-members 能力）
+// 多实例部署的中继只能列出连到同一实例的成员，此时返回错误而不是不完整的列表
+func FetchMembers(ctx context.Context, baseURL, roomID, token string) ([]Member, error) {
+	u, err := NormalizeBaseURL(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	if err := ValidateRoomID(roomID); err != nil {
+		return nil, err
+	}
+
+	var resp struct {
+		Members []Member `json:"members"`
+		Partial bool     `json:"partial"`
+	}
+	if err := getJSON(ctx, u.String()+"/v2/rooms/"+roomID+"/members", token, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Partial {
+		return nil, fmt.Errorf("中继服务器为多实例部署，无法获取完整的成员列表")
+	}
+	return resp.Members, nil
+}
+
+// getJSON 发送 GET 请求并解析 JSON 响应
+func getJSON(ctx context.Context, target, token string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("无法访问中继服务器: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("中继服务器返回 %s", resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("解析中继服务器响应失败: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package settings
+
+import "fmt"
+
+// ==========================================
+// 设置文件迁移
+// ==========================================
+//
+// 设置文件以通用 JSON 对象的形式逐版本迁移，迁移后再解析为 Settings；
+// 新版本新增的字段由默认值补齐，因此只有字段改名、拆分、含义变化时才需要迁移函数。
+
+// migrations 第 i 项把版本 i 的设置迁移到版本 i+1
+var migrations = []func(raw map[string]any) error{
+	migrateV0,
+}
+
+// migrate 把任意旧版本的设置迁移到当前版本，返回迁移前的版本
+func migrate(raw map[string]any) (int, error) {
+	from := 0
+	if v, ok := raw["version"].(float64); ok {
+		from = int(v)
+	}
+	if from < 0 {
+		return from, fmt.Errorf("设置文件版本 %d 无效", from)
+	}
+	if from > CurrentVersion {
+		return from, fmt.Errorf("设置文件版本 %d 高于当前支持的版本 %d", from, CurrentVersion)
+	}
+
+	for version := from; version < CurrentVersion; version++ {
+		if err := migrations[version](raw); err != nil {
+			return from, fmt.Errorf("迁移设置文件 v%d 失败: %w", version, err)
+		}
+		raw["version"] = version + 1
+	}
+	return from, nil
+}
+
+// migrateV0 v0（无版本号）为前端早期保存在 localStorage 中的扁平结构：
+// {"mode", "address", "port", "clientUrl"}，已是嵌套结构的字段（如 "client.relay"）原样保留
+func migrateV0(raw map[string]any) error {
+	server, _ := raw["server"].(map[string]any)
+	if server == nil {
+		server = map[string]any{}
+	}
+	if v, ok := raw["address"]; ok {
+		server["address"] = v
+	}
+	if v, ok := raw["port"]; ok {
+		server["port"] = v
+	}
+	if len(server) > 0 {
+		raw["server"] = server
+	}
+
+	if v, ok := raw["clientUrl"]; ok {
+		client, _ := raw["client"].(map[string]any)
+		if client == nil {
+			client = map[string]any{}
+		}
+		client["url"] = v
+		raw["client"] = client
+	}
+
+	for _, key := range []string{"address", "port", "clientUrl"} {
+		delete(raw, key)
+	}
+	return nil
+}
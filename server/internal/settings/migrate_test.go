@@ -0,0 +1,45 @@
+package settings
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestMigrate(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     map[string]any
+		from    int
+		wantErr bool
+	}{
+		{"无版本号", map[string]any{"address": "0.0.0.0", "port": float64(8080)}, 0, false},
+		{"当前版本", map[string]any{"version": float64(CurrentVersion)}, CurrentVersion, false},
+		{"高于当前版本", map[string]any{"version": float64(CurrentVersion + 1)}, CurrentVersion + 1, true},
+		{"负数版本", map[string]any{"version": float64(-1)}, -1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			from, err := migrate(tt.raw)
+			if from != tt.from {
+				t.Errorf("from = %d，期望 %d", from, tt.from)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v，期望出错: %v", err, tt.wantErr)
+			}
+			if _, flat := tt.raw["address"]; !tt.wantErr && flat {
+				t.Errorf("迁移后仍有旧版字段: %v", tt.raw)
+			}
+		})
+	}
+}
+
+func TestStoreRejectsNegativeVersion(t *testing.T) {
+	store := NewStore(filepath.Join(t.TempDir(), "settings.json"))
+	before := store.Get()
+	if err := store.Import([]byte(`{"version": -1}`)); err == nil {
+		t.Fatalf("导入负数版本的设置未返回错误")
+	}
+	if got := store.Get(); got.Version != before.Version {
+		t.Errorf("导入失败后 version = %d，期望保持 %d", got.Version, before.Version)
+	}
+}
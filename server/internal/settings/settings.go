@@ -0,0 +1,305 @@
+package settings
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ==========================================
+// 应用设置
+// ==========================================
+
+// CurrentVersion 当前设置文件结构版本，结构变化时递增并在 migrate.go 中补充迁移
+const CurrentVersion = 1
+
+// 模式
+const (
+	ModeServer = "server"
+	ModeClient = "client"
+)
+
+// Settings 持久化的应用设置
+type Settings struct {
+	Version       int               `json:"version"`
+	Mode          string            `json:"mode"`          // "server" 或 "client"
+	AutoStart     bool              `json:"autoStart"`     // 启动时自动恢复上次的同步（启动服务器或重新连接）
+	FrameChecksum bool              `json:"frameChecksum"` // 发出的每一帧附带 CRC32 校验，旧版本接收方会忽略
+	Device        DeviceSettings    `json:"device"`
+	Server        ServerSettings    `json:"server"`
+	Client        ClientSettings    `json:"client"`
+	Limits        LimitSettings     `json:"limits"`
+	Reconnect     ReconnectSettings `json:"reconnect"`
+	Heartbeat     HeartbeatSettings `json:"heartbeat"`
+	Logging       LoggingSettings   `json:"logging"`
+}
+
+// DeviceSettings 本机设备信息（握手时发送给对端）
+type DeviceSettings struct {
+	Name string `json:"name"` // 设备名称，留空使用主机名
+}
+
+// ServerSettings 本机服务器设置
+type ServerSettings struct {
+	Address        string            `json:"address"`
+	Port           int               `json:"port"`
+	AllowedOrigins []string          `json:"allowedOrigins"` // 允许的浏览器来源，默认拒绝所有带 Origin 头的连接
+	BlockedDevices []string          `json:"blockedDevices"` // 已屏蔽的设备 UUID，握手时拒绝
+	DeviceAliases  map[string]string `json:"deviceAliases"`  // 设备 UUID → 别名，仅在本机显示
+	// HandshakeTimeoutSec 新连接须在该时间内完成握手，否则断开
+	HandshakeTimeoutSec int `json:"handshakeTimeoutSec"`
+	// SlowConsumer 客户端接收过慢（发送队列已满）时的处理：drop 丢弃新条目，latest 只保留最新条目，disconnect 持续积压时断开
+	SlowConsumer string `json:"slowConsumer"`
+}
+
+// ClientSettings 客户端模式设置
+type ClientSettings struct {
+	URL      string        `json:"url"`      // 直连服务器地址
+	UseRelay bool          `json:"useRelay"` // 上次通过中继房间连接
+	Relay    RelaySettings `json:"relay"`
+}
+
+// RelaySettings 中继房间设置
+type RelaySettings struct {
+	BaseURL string `json:"baseUrl"`
+	RoomID  string `json:"roomId"`
+	Token   string `json:"token"`
+}
+
+// LimitSettings 容量限制
+type LimitSettings struct {
+	MaxLogs          int `json:"maxLogs"`          // 内存中保留的日志条数
+	OfflineQueueSize int `json:"offlineQueueSize"` // 断线期间缓存的剪贴板条目数，0 表示不缓存
+	MaxFrameSizeMB   int `json:"maxFrameSizeMb"`   // 接收的单帧上限，服务器与出站连接相同
+	MaxItemSizeMB    int `json:"maxItemSizeMb"`    // 接收的单个条目上限
+	MaxBufferedMB    int `json:"maxBufferedMb"`    // 在内存中重组的数据合计上限，出站连接按连接计算
+	SpillThresholdMB int `json:"spillThresholdMb"` // 超过该大小的条目写入临时文件重组，0 表示不落盘
+	MaxSpilledMB     int `json:"maxSpilledMb"`     // 在临时文件中重组的数据合计上限，出站连接按连接计算
+}
+
+// ReconnectSettings 客户端重连策略
+type ReconnectSettings struct {
+	InitialDelayMs int64   `json:"initialDelayMs"`
+	MaxDelayMs     int64   `json:"maxDelayMs"`
+	Multiplier     float64 `json:"multiplier"`
+	Jitter         float64 `json:"jitter"`
+	MaxAttempts    int     `json:"maxAttempts"` // 0 表示不限制
+}
+
+// HeartbeatSettings 客户端心跳设置
+// 只影响本机作为客户端的出站连接。间隔不设上限：对端服务器会定期发送 WebSocket Ping
+// （本机服务器为每 30 秒），客户端的 Pong 回复即可维持对端的读取期限
+type HeartbeatSettings struct {
+	IntervalSec int `json:"intervalSec"` // 发送心跳的间隔
+	TimeoutSec  int `json:"timeoutSec"`  // 超过该时间没有收到任何消息视为断线，须大于间隔
+}
+
+// LoggingSettings 日志设置（内存中保留的条数见 Limits.MaxLogs）
+type LoggingSettings struct {
+	Level         string `json:"level"`         // 最低记录级别：DEBUG、INFO、WARNING、ERROR
+	File          bool   `json:"file"`          // 同时写入用户配置目录下的日志文件
+	MaxFileSizeMB int    `json:"maxFileSizeMb"` // 单个日志文件大小上限，超过后滚动
+	MaxFiles      int    `json:"maxFiles"`      // 保留的历史日志文件数
+}
+
+// Default 默认设置
+func Default() Settings {
+	return Settings{
+		Version:       CurrentVersion,
+		Mode:          ModeServer,
+		FrameChecksum: true,
+		Server: ServerSettings{
+			Address:        "0.0.0.0",
+			Port:           8080,
+			AllowedOrigins: []string{},
+			BlockedDevices: []string{},
+			DeviceAliases:  map[string]string{},
+
+			HandshakeTimeoutSec: 10,
+			SlowConsumer:        "drop",
+		},
+		Client: ClientSettings{
+			URL: "ws://localhost:8080/ws/my-room",
+		},
+		Limits: LimitSettings{
+			MaxLogs:          500,
+			OfflineQueueSize: 5,
+			MaxFrameSizeMB:   16,
+			MaxItemSizeMB:    100,
+			MaxBufferedMB:    256,
+			SpillThresholdMB: 16,
+			MaxSpilledMB:     1024,
+		},
+		Reconnect: ReconnectSettings{
+			InitialDelayMs: 1000,
+			MaxDelayMs:     60000,
+			Multiplier:     2,
+			Jitter:         0.2,
+		},
+		Heartbeat: HeartbeatSettings{
+			IntervalSec: 15,
+			TimeoutSec:  45,
+		},
+		Logging: LoggingSettings{
+			Level:         "INFO",
+			File:          true,
+			MaxFileSizeMB: 5,
+			MaxFiles:      3,
+		},
+	}
+}
+
+// Validate 校验设置，返回第一个不合法的字段
+func (s *Settings) Validate() error {
+	if s.Mode != ModeServer && s.Mode != ModeClient {
+		return fmt.Errorf("mode 只能是 %s 或 %s", ModeServer, ModeClient)
+	}
+	if len([]rune(s.Device.Name)) > 64 {
+		return fmt.Errorf("设备名称不能超过 64 个字符")
+	}
+
+	if strings.TrimSpace(s.Server.Address) == "" {
+		return fmt.Errorf("服务器监听地址不能为空")
+	}
+	if s.Server.Port < 1 || s.Server.Port > 65535 {
+		return fmt.Errorf("服务器端口必须在 1-65535 之间")
+	}
+	for _, origin := range s.Server.AllowedOrigins {
+		if strings.TrimSpace(origin) == "" {
+			return fmt.Errorf("允许的来源不能为空字符串")
+		}
+	}
+	for _, id := range s.Server.BlockedDevices {
+		if _, err := uuid.Parse(id); err != nil {
+			return fmt.Errorf("屏蔽列表中的设备 UUID 无效: %s", id)
+		}
+	}
+	for id, alias := range s.Server.DeviceAliases {
+		if _, err := uuid.Parse(id); err != nil {
+			return fmt.Errorf("设备别名中的 UUID 无效: %s", id)
+		}
+		if strings.TrimSpace(alias) == "" || len([]rune(alias)) > 64 {
+			return fmt.Errorf("设备别名不能为空且不能超过 64 个字符")
+		}
+	}
+
+	if s.Server.HandshakeTimeoutSec < 1 || s.Server.HandshakeTimeoutSec > 120 {
+		return fmt.Errorf("握手超时时间必须在 1-120 秒之间")
+	}
+	switch s.Server.SlowConsumer {
+	case "drop", "latest", "disconnect":
+	default:
+		return fmt.Errorf("慢速客户端策略只能是 drop、latest 或 disconnect")
+	}
+
+	if s.Client.URL != "" {
+		u, err := url.Parse(s.Client.URL)
+		if err != nil || (u.Scheme != "ws" && u.Scheme != "wss") || u.Host == "" {
+			return fmt.Errorf("客户端服务器地址必须以 ws:// 或 wss:// 开头")
+		}
+	}
+	if s.Client.UseRelay && (s.Client.Relay.BaseURL == "" || s.Client.Relay.RoomID == "") {
+		return fmt.Errorf("使用中继时必须填写中继服务器地址和房间 ID")
+	}
+
+	if s.Limits.MaxLogs < 50 || s.Limits.MaxLogs > 100000 {
+		return fmt.Errorf("日志条数必须在 50-100000 之间")
+	}
+	if s.Limits.OfflineQueueSize < 0 || s.Limits.OfflineQueueSize > 100 {
+		return fmt.Errorf("离线缓存条目数必须在 0-100 之间")
+	}
+	if s.Limits.MaxFrameSizeMB < 1 || s.Limits.MaxFrameSizeMB > 256 {
+		return fmt.Errorf("单帧上限必须在 1-256 MB 之间")
+	}
+	if s.Limits.MaxItemSizeMB < 1 || s.Limits.MaxItemSizeMB > 1024 {
+		return fmt.Errorf("单个条目上限必须在 1-1024 MB 之间")
+	}
+	if s.Limits.MaxBufferedMB < s.Limits.MaxFrameSizeMB || s.Limits.MaxBufferedMB > 4096 {
+		return fmt.Errorf("接收缓冲区上限必须不小于单帧上限且不超过 4096 MB")
+	}
+	if s.Limits.SpillThresholdMB < 0 || s.Limits.SpillThresholdMB > s.Limits.MaxItemSizeMB {
+		return fmt.Errorf("落盘阈值必须在 0 到单个条目上限之间")
+	}
+	if s.Limits.MaxSpilledMB < s.Limits.MaxItemSizeMB || s.Limits.MaxSpilledMB > 65536 {
+		return fmt.Errorf("临时文件上限必须不小于单个条目上限且不超过 65536 MB")
+	}
+
+	r := s.Reconnect
+	if r.InitialDelayMs < 100 {
+		return fmt.Errorf("重连初始等待时间不能小于 100 毫秒")
+	}
+	if r.MaxDelayMs < r.InitialDelayMs {
+		return fmt.Errorf("重连最长等待时间不能小于初始等待时间")
+	}
+	if r.Multiplier < 1 || r.Multiplier > 10 {
+		return fmt.Errorf("重连等待倍数必须在 1-10 之间")
+	}
+	if r.Jitter < 0 || r.Jitter > 1 {
+		return fmt.Errorf("重连抖动比例必须在 0-1 之间")
+	}
+	if r.MaxAttempts < 0 {
+		return fmt.Errorf("最大重连次数不能为负数")
+	}
+
+	h := s.Heartbeat
+	if h.IntervalSec < 1 {
+		return fmt.Errorf("心跳间隔不能小于 1 秒")
+	}
+	if h.TimeoutSec <= h.IntervalSec {
+		return fmt.Errorf("心跳超时时间必须大于心跳间隔")
+	}
+
+	l := s.Logging
+	switch l.Level {
+	case "DEBUG", "INFO", "WARNING", "ERROR":
+	default:
+		return fmt.Errorf("日志级别只能是 DEBUG、INFO、WARNING 或 ERROR")
+	}
+	if l.MaxFileSizeMB < 1 || l.MaxFileSizeMB > 100 {
+		return fmt.Errorf("日志文件大小上限必须在 1-100 MB 之间")
+	}
+	if l.MaxFiles < 1 || l.MaxFiles > 20 {
+		return fmt.Errorf("历史日志文件数必须在 1-20 之间")
+	}
+	return nil
+}
+
+// InitialDelay 重连初始等待时间
+func (r ReconnectSettings) InitialDelay() time.Duration {
+	return time.Duration(r.InitialDelayMs) * time.Millisecond
+}
+
+// MaxDelay 重连最长等待时间
+func (r ReconnectSettings) MaxDelay() time.Duration {
+	return time.Duration(r.MaxDelayMs) * time.Millisecond
+}
+
+// Interval 心跳间隔
+func (h HeartbeatSettings) Interval() time.Duration {
+	return time.Duration(h.IntervalSec) * time.Second
+}
+
+// Timeout 心跳超时时间
+func (h HeartbeatSettings) Timeout() time.Duration {
+	return time.Duration(h.TimeoutSec) * time.Second
+}
+
+// MaxFileBytes 单个日志文件大小上限（字节）
+func (l LoggingSettings) MaxFileBytes() int64 {
+	return int64(l.MaxFileSizeMB) << 20
+}
+
+// clone 深拷贝（切片字段不与调用方共享）
+func (s Settings) clone() Settings {
+	s.Server.AllowedOrigins = append([]string{}, s.Server.AllowedOrigins...)
+	s.Server.BlockedDevices = append([]string{}, s.Server.BlockedDevices...)
+	aliases := make(map[string]string, len(s.Server.DeviceAliases))
+	for id, alias := range s.Server.DeviceAliases {
+		aliases[id] = alias
+	}
+	s.Server.DeviceAliases = aliases
+	return s
+}
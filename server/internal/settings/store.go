@@ -0,0 +1,188 @@
+package settings
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// ==========================================
+// 设置文件存储
+// ==========================================
+
+// fileName 设置文件名
+const fileName = "settings.json"
+
+// DefaultPath 默认设置文件路径（用户配置目录下的 NextPaste/settings.json）
+func DefaultPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("获取用户配置目录失败: %w", err)
+	}
+	return filepath.Join(dir, "NextPaste", fileName), nil
+}
+
+// Store 设置存储，读写均为整份设置
+type Store struct {
+	path     string
+	settings Settings
+	mu       sync.RWMutex
+}
+
+// NewStore 创建设置存储，调用 Load 之前为默认设置；path 为空时只保存在内存中
+func NewStore(path string) *Store {
+	return &Store{
+		path:     path,
+		settings: Default(),
+	}
+}
+
+// Path 设置文件路径
+func (s *Store) Path() string {
+	return s.path
+}
+
+// Load 从文件加载设置，文件不存在时使用默认设置
+// 旧版本的设置会迁移到当前版本并回写；文件无效时保留默认设置并返回错误
+func (s *Store) Load() error {
+	if s.path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("读取设置文件失败: %w", err)
+	}
+
+	loaded, from, err := decode(Default(), data)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.settings = loaded
+	if from != CurrentVersion {
+		return s.save(loaded)
+	}
+	return nil
+}
+
+// Get 获取当前设置的副本
+func (s *Store) Get() Settings {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.settings.clone()
+}
+
+// Update 校验并保存整份设置
+func (s *Store) Update(settings Settings) error {
+	settings.Version = CurrentVersion
+	settings = settings.clone()
+	if err := settings.Validate(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.save(settings); err != nil {
+		return err
+	}
+	s.settings = settings
+	return nil
+}
+
+// Modify 在当前设置上修改部分字段后校验并保存
+func (s *Store) Modify(fn func(*Settings)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	settings := s.settings.clone()
+	fn(&settings)
+	settings.Version = CurrentVersion
+	if err := settings.Validate(); err != nil {
+		return err
+	}
+	if err := s.save(settings); err != nil {
+		return err
+	}
+	s.settings = settings
+	return nil
+}
+
+// Import 导入任意版本的设置（JSON），缺少的字段保留当前值
+func (s *Store) Import(data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	settings, _, err := decode(s.settings.clone(), data)
+	if err != nil {
+		return err
+	}
+	if err := s.save(settings); err != nil {
+		return err
+	}
+	s.settings = settings
+	return nil
+}
+
+// decode 解析设置 JSON：迁移到当前版本后覆盖到 base 上并校验，返回迁移前的版本
+func decode(base Settings, data []byte) (Settings, int, error) {
+	var raw map[string]any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return base, 0, fmt.Errorf("解析设置失败: %w", err)
+	}
+	if raw == nil {
+		raw = map[string]any{}
+	}
+
+	from, err := migrate(raw)
+	if err != nil {
+		return base, from, err
+	}
+
+	migrated, err := json.Marshal(raw)
+	if err != nil {
+		return base, from, err
+	}
+	if err := json.Unmarshal(migrated, &base); err != nil {
+		return base, from, fmt.Errorf("解析设置失败: %w", err)
+	}
+	base = base.clone() // 补齐为 nil 的切片与映射
+	if err := base.Validate(); err != nil {
+		return base, from, fmt.Errorf("设置无效: %w", err)
+	}
+	return base, from, nil
+}
+
+// save 原子写入设置文件（先写临时文件再重命名），调用方需持有 s.mu
+func (s *Store) save(settings Settings) error {
+	if s.path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o700); err != nil {
+		return fmt.Errorf("创建设置目录失败: %w", err)
+	}
+
+	// 设置中可能包含中继访问令牌，仅当前用户可读写
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("保存设置失败: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("保存设置失败: %w", err)
+	}
+	return nil
+}
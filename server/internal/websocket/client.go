@@ -3,8 +3,12 @@ package websocket
 import (
 	"context"
 	"encoding/base64"
+	"encoding/binary"
 	"errors"
 	"fmt"
+	"net"
+	"net/url"
+	"strings"
 	"sync"
 	"time"
 
@@ -13,41 +17,237 @@ import (
 	"github.com/gorilla/websocket"
 )
 
+// errConnectionLost 连接已断开（读写均未返回具体错误时使用）
+var errConnectionLost = errors.New("连接已断开")
+
+// ErrTransferCancelled 分片发送被用户取消
+var ErrTransferCancelled = errors.New("传输已取消")
+
+// RejectedError 服务器主动断开（踢出或屏蔽），客户端不再自动重连
+type RejectedError struct {
+	Code   int
+	Reason string
+}
+
+// Error 显示给用户的断开原因
+func (e *RejectedError) Error() string {
+	message := "已被服务器断开连接"
+	if e.Code == CloseBlocked {
+		message = "本设备已被服务器屏蔽"
+	}
+	if e.Reason != "" {
+		message += ": " + e.Reason
+	}
+	return message
+}
+
+// asRejected 从连接错误中识别服务器的踢出或屏蔽
+func asRejected(err error) (*RejectedError, bool) {
+	var closeErr *websocket.CloseError
+	if !errors.As(err, &closeErr) || (closeErr.Code != CloseKicked && closeErr.Code != CloseBlocked) {
+		return nil, false
+	}
+	return &RejectedError{Code: closeErr.Code, Reason: closeErr.Text}, true
+}
+
+// imageChunkSize 图片分片大小
+const imageChunkSize = 64 * 1024
+
+// handshakeAckTimeout 等待服务器回复握手的期限，旧版服务器不回复，超时后仍视为已接受
+const handshakeAckTimeout = 5 * time.Second
+
+// isRelayURL 是否为中继房间地址（/v2/ws/{roomID}）
+// 中继在升级连接时完成鉴权，只转发帧，不回复握手
+func isRelayURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	return err == nil && strings.Contains(u.Path, "/v2/ws/")
+}
+
+// clientConn 一次 WebSocket 连接的生命周期
+// 读或写失败时取消 ctx，连接循环据此检测断线并重连
+type clientConn struct {
+	conn    *websocket.Conn
+	ctx     context.Context
+	cancel  context.CancelFunc
+	writeMu sync.Mutex // gorilla/websocket 不支持并发写
+	errMu   sync.Mutex
+	err     error // 导致连接结束的第一个错误
+
+	accepted   chan struct{} // 收到服务器的握手回复时关闭
+	acceptOnce sync.Once
+}
+
+// newClientConn 为连接创建独立的上下文，随连接循环一同取消
+func newClientConn(parent context.Context, conn *websocket.Conn) *clientConn {
+	ctx, cancel := context.WithCancel(parent)
+	return &clientConn{conn: conn, ctx: ctx, cancel: cancel, accepted: make(chan struct{})}
+}
+
+// accept 标记服务器已确认握手
+func (cc *clientConn) accept() {
+	cc.acceptOnce.Do(func() { close(cc.accepted) })
+}
+
+// fail 记录错误并结束连接
+func (cc *clientConn) fail(err error) {
+	cc.errMu.Lock()
+	if cc.err == nil {
+		cc.err = err
+	}
+	cc.errMu.Unlock()
+	cc.cancel()
+}
+
+// cause 导致连接结束的错误
+func (cc *clientConn) cause() error {
+	cc.errMu.Lock()
+	defer cc.errMu.Unlock()
+	if cc.err == nil {
+		return errConnectionLost
+	}
+	return cc.err
+}
+
+// write 发送一条消息，失败时结束连接
+func (cc *clientConn) write(messageType int, data []byte) error {
+	cc.writeMu.Lock()
+	defer cc.writeMu.Unlock()
+
+	if cc.ctx.Err() != nil {
+		return errConnectionLost
+	}
+
+	cc.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	if err := cc.conn.WriteMessage(messageType, data); err != nil {
+		cc.fail(err)
+		return err
+	}
+	return nil
+}
+
 // WSClient WebSocket 客户端（V1.1 二进制协议版本）
 type WSClient struct {
 	url               string
-	conn              *websocket.Conn
-	ctx               context.Context
+	current           *clientConn // 当前连接，未连接时为 nil
 	cancel            context.CancelFunc
-	isConnected       bool
+	isConnected       bool // 已连接且完成握手与离线队列补发
 	everConnected     bool // 是否曾经连接成功过
+	running           bool // 连接循环是否在运行（含重连等待中）
+	state             ConnectionState
 	mu                sync.RWMutex
-	deviceName        string
-	platform          string
+	device            protocol.DeviceInfo // 握手时发送的本机设备信息
 	logCb             LogCallback
+	protocolLogCb     LogCallback // 协议层日志（解析失败、未知消息等），为空时使用 logCb
 	clipboardCallback BinaryClipboardCallback
-	onConnected       func() // 连接成功回调
-	reconnectInterval time.Duration
+	peerErrorCb       PeerErrorCallback
+	transfers         *TransferTracker // 分片传输进度，为空时不记录
+	onConnected       func()           // 连接成功（握手完成）回调
+	onDisconnected    func()           // 连接断开回调，与 onConnected 一一对应
+	stateCb           StateCallback
+	reconnectPolicy   ReconnectPolicy
 	heartbeatInterval time.Duration
+	heartbeatTimeout  time.Duration // 超过该时间未收到服务器任何数据视为断线
+	latency           time.Duration // 最近一次心跳往返延迟
+	lastPingMs        int64         // 最近一次心跳请求的时间戳，用于匹配服务器回复
+	reconnectHint     time.Duration // 服务器关闭时通过 Close 帧给出的重连等待时间
+	outbox            *outbox       // 离线发送队列
+	lastSyncedHash    string        // 最后一次成功发送或收到的内容哈希，即服务器已有的内容
+	sendingHash       string        // 正在发送的内容哈希
+	tooLargeHash      string        // 服务器以 1009 拒绝的内容哈希，重连后不再补发
+	connectedAt       time.Time     // 本次连接成功的时间，未连接时为零值
+	stats             *Stats        // 同步统计，跨重连累计
+	limits            Limits        // 接收限制，与服务器端相同
+	buffered          bufferBudget  // 正在内存中重组的数据
+	spilled           bufferBudget  // 正在临时文件中重组的数据
+	sent              recentOrigins // 最近发出的消息，用于判断收到的错误消息是否针对本机
 
 	// V1.1 二进制协议管理器
 	protocolMgr *protocol.BinaryProtocolManager
 
 	// 分片重组缓冲区
-	PendingMsgID  uint32
-	PendingBuffer []byte
-	PendingMeta   *protocol.TransferMeta
+	PendingMsgID    uint32
+	pending         *reassembly // 正在重组的条目，未接收时为 nil
+	PendingMeta     *protocol.TransferMeta
+	PendingTransfer *Transfer // 多分片接收的进度，单帧条目为 nil
 }
 
-// NewWSClient 创建 WebSocket 客户端
-func NewWSClient(deviceName, platform string) *WSClient {
+// NewWSClient 创建 WebSocket 客户端，使用本机设备 UUID
+func NewWSClient(device protocol.DeviceInfo) *WSClient {
+	return NewWSClientWithUUID(device, protocol.DeviceUUID())
+}
+
+// NewWSClientWithUUID 创建以指定设备 UUID 收发消息的 WebSocket 客户端
+func NewWSClientWithUUID(device protocol.DeviceInfo, deviceUUID [16]byte) *WSClient {
 	return &WSClient{
-		deviceName:        deviceName,
-		platform:          platform,
-		reconnectInterval: 5 * time.Second,
-		heartbeatInterval: 30 * time.Second,
-		protocolMgr:       protocol.NewBinaryProtocolManager(),
+		device:            device,
+		state:             StateDisconnected,
+		reconnectPolicy:   DefaultReconnectPolicy(),
+		heartbeatInterval: 15 * time.Second,
+		heartbeatTimeout:  45 * time.Second,
+		outbox:            newOutbox(5),
+		stats:             NewStats(),
+		limits:            DefaultLimits(),
+		protocolMgr:       protocol.NewBinaryProtocolManagerWithUUID(deviceUUID),
+	}
+}
+
+// SetOfflineQueueSize 设置离线发送队列容量
+// 断线期间只保留最新的 size 条剪贴板变化，1 表示只保留最新一条，0 表示不缓存
+func (c *WSClient) SetOfflineQueueSize(size int) {
+	c.outbox.setCapacity(size)
+}
+
+// SetHeartbeat 设置心跳间隔与超时时间，下次连接时生效
+// timeout 内未收到服务器任何数据（含心跳回复）即断开并进入重连流程
+func (c *WSClient) SetHeartbeat(interval, timeout time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.heartbeatInterval = interval
+	c.heartbeatTimeout = timeout
+}
+
+// SetLimits 设置接收限制：单帧上限下次连接时生效，其余限制对之后开始接收的条目生效
+func (c *WSClient) SetLimits(limits Limits) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.limits = limits
+}
+
+// Latency 最近一次心跳往返延迟，未连接或尚未测得时为 0
+func (c *WSClient) Latency() time.Duration {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.latency
+}
+
+// setLatency 记录心跳往返延迟
+func (c *WSClient) setLatency(rtt time.Duration) {
+	c.mu.Lock()
+	c.latency = rtt
+	c.mu.Unlock()
+	c.stats.recordLatency(rtt)
+}
+
+// Stats 同步统计计数
+func (c *WSClient) Stats() *Stats {
+	return c.stats
+}
+
+// ConnectedSince 本次连接成功的时间，未连接时为零值
+func (c *WSClient) ConnectedSince() time.Time {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if !c.isConnected {
+		return time.Time{}
 	}
+	return c.connectedAt
+}
+
+// IsActive 连接循环是否在运行（已连接或正在重连）
+func (c *WSClient) IsActive() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.running
 }
 
 // SetClipboardCallback 设置剪贴板数据回调（V1.1）
@@ -64,21 +264,70 @@ func (c *WSClient) SetOnConnected(cb func()) {
 	c.onConnected = cb
 }
 
+// SetOnDisconnected 设置连接断开回调
+// 每次 onConnected 之后、连接断开（含主动断开）时调用一次
+func (c *WSClient) SetOnDisconnected(cb func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.onDisconnected = cb
+}
+
+// SetStateCallback 设置连接状态变化回调
+func (c *WSClient) SetStateCallback(cb StateCallback) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stateCb = cb
+}
+
+// SetReconnectPolicy 设置重连策略，下次连接时生效
+func (c *WSClient) SetReconnectPolicy(policy ReconnectPolicy) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.reconnectPolicy = policy
+}
+
+// State 获取当前连接状态
+func (c *WSClient) State() ConnectionState {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.state
+}
+
+// setState 更新连接状态并通知回调
+// ctx 为所属连接循环的上下文，循环已被取消时不再上报（避免覆盖 Disconnect 的状态）
+func (c *WSClient) setState(ctx context.Context, event ConnectionStateEvent) {
+	c.mu.Lock()
+	if ctx != nil && ctx.Err() != nil {
+		c.mu.Unlock()
+		return
+	}
+	c.state = event.State
+	event.URL = c.url
+	cb := c.stateCb
+	c.mu.Unlock()
+
+	if cb != nil {
+		cb(event)
+	}
+}
+
 // Connect 连接到 WebSocket 服务器
 func (c *WSClient) Connect(url string, logCb LogCallback) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	if c.isConnected {
+	if c.isConnected || c.running {
 		return fmt.Errorf("客户端已连接")
 	}
 
 	c.url = url
 	c.logCb = logCb
-	c.ctx, c.cancel = context.WithCancel(context.Background())
+	c.running = true
+	ctx, cancel := context.WithCancel(context.Background())
+	c.cancel = cancel
 
 	// 启动连接协程
-	go c.connectLoop()
+	go c.connectLoop(ctx, c.reconnectPolicy)
 
 	return nil
 }
@@ -86,73 +335,142 @@ func (c *WSClient) Connect(url string, logCb LogCallback) error {
 // Disconnect 断开连接
 func (c *WSClient) Disconnect() error {
 	c.mu.Lock()
-	defer c.mu.Unlock()
+	defer func() {
+		c.mu.Unlock()
+		c.setState(nil, ConnectionStateEvent{State: StateDisconnected})
+	}()
 
-	if !c.isConnected && c.conn == nil {
+	if !c.running && c.current == nil {
 		return nil
 	}
 
+	// 取消连接循环，当前连接随之结束，由 doConnect 负责清理并触发断开回调
 	if c.cancel != nil {
 		c.cancel()
 	}
 
-	if c.conn != nil {
-		c.conn.Close()
-		c.conn = nil
+	if c.current != nil {
+		c.current.conn.Close()
 	}
 
 	c.isConnected = false
 	c.everConnected = false // 重置连接状态
+	c.running = false
+	c.outbox.drain() // 主动断开后不再补发
 	c.log("INFO", "客户端已断开连接")
 	return nil
 }
 
-// connectLoop 连接循环（支持自动重连）
-func (c *WSClient) connectLoop() {
+// connectLoop 连接循环（按重连策略指数退避重连）
+// 首次连接遇到暂时性错误（如服务器尚未启动）也会重试；曾经连接成功后任何错误都会重试
+func (c *WSClient) connectLoop(ctx context.Context, policy ReconnectPolicy) {
+	attempts := 0 // 连续失败次数
+
 	for {
+		if ctx.Err() != nil {
+			return
+		}
+
+		c.setState(ctx, ConnectionStateEvent{State: StateConnecting, Attempt: attempts})
+		established, err := c.doConnect(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if rejected, ok := asRejected(err); ok {
+			// 被服务器踢出或屏蔽：重连没有意义，直接放弃并显示原因
+			c.fail(ctx, attempts, rejected, rejected.Error())
+			return
+		}
+		if established {
+			attempts = 0
+			c.log("WARNING", fmt.Sprintf("连接已断开: %v", err))
+		} else if err != nil {
+			c.log("ERROR", fmt.Sprintf("连接失败: %v", err))
+		}
+
+		c.mu.RLock()
+		everConnected := c.everConnected
+		c.mu.RUnlock()
+
+		if !everConnected && !isTransientError(err) {
+			c.fail(ctx, attempts, err, "首次连接失败，请检查服务器地址")
+			return
+		}
+
+		attempts++
+		if policy.Exhausted(attempts) {
+			c.fail(ctx, attempts, err, fmt.Sprintf("已连续重试 %d 次，放弃重连", attempts))
+			return
+		}
+
+		delay := policy.Delay(attempts)
+		var he *handshakeError
+		if errors.As(err, &he) && he.RetryAfter > 0 {
+			delay = he.RetryAfter
+		}
+		c.mu.Lock()
+		if c.reconnectHint > 0 {
+			delay = c.reconnectHint
+			c.reconnectHint = 0
+		}
+		c.mu.Unlock()
+
+		event := ConnectionStateEvent{
+			State:         StateBackingOff,
+			Attempt:       attempts,
+			NextAttemptAt: time.Now().Add(delay).UnixMilli(),
+		}
+		if err != nil {
+			event.Error = err.Error()
+		}
+		c.setState(ctx, event)
+		c.log("INFO", fmt.Sprintf("将在 %v 后重试连接（第 %d 次）...", delay.Round(100*time.Millisecond), attempts))
+
+		timer := time.NewTimer(delay)
 		select {
-		case <-c.ctx.Done():
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
 			return
-		default:
-			if err := c.doConnect(); err != nil {
-				c.log("ERROR", fmt.Sprintf("连接失败: %v", err))
-
-				// 检查是否曾经连接成功过
-				c.mu.RLock()
-				everConnected := c.everConnected
-				c.mu.RUnlock()
-
-				// 只有曾经连接成功过才自动重连
-				if everConnected {
-					c.log("INFO", fmt.Sprintf("将在 %v 后重试连接...", c.reconnectInterval))
-					select {
-					case <-time.After(c.reconnectInterval):
-						continue
-					case <-c.ctx.Done():
-						return
-					}
-				} else {
-					// 首次连接失败，不重连，直接退出
-					c.log("ERROR", "首次连接失败，请检查服务器地址")
-					return
-				}
-			}
 		}
 	}
 }
 
-// doConnect 执行连接
-func (c *WSClient) doConnect() error {
+// fail 放弃重连
+func (c *WSClient) fail(ctx context.Context, attempts int, err error, message string) {
+	c.log("ERROR", message)
+
+	c.mu.Lock()
+	if ctx.Err() == nil {
+		c.running = false
+		c.outbox.drain()
+	}
+	c.mu.Unlock()
+
+	event := ConnectionStateEvent{State: StateFailed, Attempt: attempts}
+	if err != nil {
+		event.Error = err.Error()
+	}
+	c.setState(ctx, event)
+}
+
+// doConnect 建立一次连接并阻塞到连接结束
+// established: 是否成功建立过连接；连接结束时返回导致断开的错误
+func (c *WSClient) doConnect(ctx context.Context) (established bool, err error) {
 	c.log("INFO", fmt.Sprintf("正在连接到 %s...", c.url))
 
-	conn, _, err := websocket.DefaultDialer.Dial(c.url, nil)
+	conn, resp, err := websocket.DefaultDialer.DialContext(ctx, c.url, nil)
 	if err != nil {
-		return err
+		if errors.Is(err, websocket.ErrBadHandshake) && resp != nil {
+			return false, newHandshakeError(resp, err)
+		}
+		return false, err
 	}
 
+	cc := newClientConn(ctx, conn)
+
 	c.mu.Lock()
-	c.conn = conn
-	c.isConnected = true
+	c.current = cc
 	c.everConnected = true // 标记曾经连接成功
 	c.mu.Unlock()
 
@@ -161,10 +479,28 @@ func (c *WSClient) doConnect() error {
 	// 发送握手消息（V1.1 二进制协议）
 	if err := c.sendHandshake(); err != nil {
 		c.log("ERROR", fmt.Sprintf("发送握手消息失败: %v", err))
-		conn.Close()
-		return err
+		c.closeConn(cc, false)
+		return true, err
 	}
 
+	// 启动读写协程，握手回复与补发期间的拒绝都需要读取
+	go c.readPump(cc)
+	go c.heartbeatPump(cc)
+
+	if err := c.awaitAccepted(cc); err != nil {
+		c.closeConn(cc, false)
+		return true, err
+	}
+
+	// 补发离线期间的剪贴板变化，完成后才标记为已连接
+	if err := c.flushOutbox(cc); err != nil {
+		c.log("ERROR", fmt.Sprintf("补发离线数据失败: %v", err))
+		c.closeConn(cc, false)
+		return true, err
+	}
+
+	c.setState(ctx, ConnectionStateEvent{State: StateConnected})
+
 	// 调用连接成功回调
 	c.mu.RLock()
 	onConnected := c.onConnected
@@ -173,89 +509,243 @@ func (c *WSClient) doConnect() error {
 		onConnected()
 	}
 
-	// 启动读写协程
-	go c.readPump()
-	go c.heartbeatPump()
+	// 等待连接结束（读写失败或主动断开）
+	<-cc.ctx.Done()
+	c.closeConn(cc, true)
+	return true, cc.cause()
+}
+
+// awaitAccepted 等待服务器接受握手：桌面端服务器以握手消息回复，中继连接建立即视为接受；
+// 旧版服务器不回复，超过 handshakeAckTimeout 连接仍未被关闭时同样视为接受
+func (c *WSClient) awaitAccepted(cc *clientConn) error {
+	if isRelayURL(c.url) {
+		return nil
+	}
 
-	// 等待连接关闭
-	<-c.ctx.Done()
-	return nil
+	timer := time.NewTimer(handshakeAckTimeout)
+	defer timer.Stop()
+	select {
+	case <-cc.accepted:
+		return nil
+	case <-timer.C:
+		c.log("WARNING", "服务器未回复握手（可能是旧版本），继续同步")
+		return nil
+	case <-cc.ctx.Done():
+		return cc.cause()
+	}
+}
+
+// flushOutbox 按顺序补发离线队列，跳过服务器已有的内容
+// 队列清空后在持有锁的情况下标记为已连接，保证之后的变化直接发送、不会滞留在队列中
+func (c *WSClient) flushOutbox(cc *clientConn) error {
+	for {
+		items := c.outbox.drain()
+		if len(items) == 0 {
+			c.mu.Lock()
+			if c.outbox.len() == 0 {
+				if c.current == cc {
+					c.isConnected = true
+					c.connectedAt = time.Now()
+				}
+				c.mu.Unlock()
+				return nil
+			}
+			c.mu.Unlock()
+			continue
+		}
+
+		c.log("INFO", fmt.Sprintf("补发离线期间的剪贴板数据: %d 条", len(items)))
+		for i, item := range items {
+			c.mu.RLock()
+			synced := item.hash == c.lastSyncedHash
+			tooLarge := item.hash == c.tooLargeHash
+			c.mu.RUnlock()
+			if synced {
+				continue
+			}
+			if tooLarge {
+				c.log("WARNING", fmt.Sprintf("服务器拒绝接收过大的 %s 数据，不再补发", item.dataType))
+				continue
+			}
+
+			if err := c.sendClipboard(item.dataType, item.content, item.origin); err != nil {
+				c.outbox.requeue(items[i:])
+				return err
+			}
+		}
+	}
+}
+
+// closeConn 关闭连接并清理状态
+// notify: 是否已触发过 onConnected，需要对应触发 onDisconnected
+func (c *WSClient) closeConn(cc *clientConn, notify bool) {
+	cc.cancel()
+	cc.conn.Close()
+
+	c.mu.Lock()
+	if c.current == cc {
+		c.current = nil
+		c.isConnected = false
+	}
+	// 丢弃未完成的分片，重连后不会再收到剩余部分
+	c.resetPending(TransferFailed)
+	c.latency = 0
+	onDisconnected := c.onDisconnected
+	c.mu.Unlock()
+
+	if notify && onDisconnected != nil {
+		onDisconnected()
+	}
 }
 
 // sendHandshake 发送握手消息（V1.1 二进制协议）
 func (c *WSClient) sendHandshake() error {
-	data, err := c.protocolMgr.CreateHandshake(c.deviceName, c.platform)
+	data, err := c.protocolMgr.CreateDeviceHandshake(c.device)
 	if err != nil {
 		return err
 	}
+	if origin, ok := protocol.HeaderOrigin(data); ok {
+		c.mu.Lock()
+		c.sent.add(origin)
+		c.mu.Unlock()
+	}
 	return c.sendBinaryData(data)
 }
 
-// readPump 读取服务器消息（V1.1 二进制协议）
-func (c *WSClient) readPump() {
-	defer func() {
-		c.mu.Lock()
-		if c.conn != nil {
-			c.conn.Close()
-		}
-		c.isConnected = false
-		c.mu.Unlock()
-	}()
+// readPump 读取服务器消息（V1.1 二进制协议），读取失败时结束连接
+// 超过 heartbeatTimeout 未收到任何数据（半开连接，如休眠、切换网络）时读取超时，触发重连
+func (c *WSClient) readPump(cc *clientConn) {
+	c.mu.RLock()
+	timeout := c.heartbeatTimeout
+	maxFrameSize := c.limits.MaxFrameSize
+	c.mu.RUnlock()
 
-	for {
-		select {
-		case <-c.ctx.Done():
-			return
-		default:
-			c.mu.RLock()
-			conn := c.conn
-			c.mu.RUnlock()
+	// 单帧超过上限时连接以 1009 关闭，避免一次读入过大的消息
+	cc.conn.SetReadLimit(maxFrameSize)
 
-			if conn == nil {
-				return
-			}
+	// WebSocket Pong 帧带回 Ping 中的纳秒时间戳
+	cc.conn.SetPongHandler(func(appData string) error {
+		cc.conn.SetReadDeadline(time.Now().Add(timeout))
+		if len(appData) == 8 {
+			sent := int64(binary.BigEndian.Uint64([]byte(appData)))
+			c.setLatency(time.Since(time.Unix(0, sent)))
+		}
+		return nil
+	})
 
-			messageType, message, err := conn.ReadMessage()
-			if err != nil {
-				if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+	for {
+		cc.conn.SetReadDeadline(time.Now().Add(timeout))
+		messageType, message, err := cc.conn.ReadMessage()
+		if err != nil {
+			if cc.ctx.Err() == nil {
+				var netErr net.Error
+				if errors.Is(err, websocket.ErrReadLimit) {
+					c.log("WARNING", fmt.Sprintf("服务器发送的消息超过单帧上限 %d 字节，断开连接", maxFrameSize))
+				} else if errors.As(err, &netErr) && netErr.Timeout() {
+					c.log("WARNING", fmt.Sprintf("%v 内未收到服务器数据，心跳超时", timeout))
+				} else if _, rejected := asRejected(err); !rejected && websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure, websocket.CloseMessageTooBig) {
 					c.log("ERROR", fmt.Sprintf("连接异常断开: %v", err))
 				}
-				return
-			}
-
-			// V1.1 二进制协议：只处理二进制消息
-			if messageType != websocket.BinaryMessage {
-				c.log("WARNING", "收到非二进制消息，不兼容的协议版本")
-				continue
+				c.handleCloseError(err)
 			}
+			cc.fail(err)
+			return
+		}
 
-			c.handleBinaryMessage(message)
+		// V1.1 二进制协议：只处理二进制消息
+		if messageType != websocket.BinaryMessage {
+			c.logProtocol("WARNING", "收到非二进制消息，不兼容的协议版本")
+			continue
 		}
+		if msgType, ok := protocol.HeaderType(message); ok && msgType == protocol.TypeHandshake {
+			cc.accept()
+		}
+
+		c.handleBinaryMessage(message)
 	}
 }
 
-// heartbeatPump 发送心跳（V1.1 二进制协议）
-func (c *WSClient) heartbeatPump() {
-	ticker := time.NewTicker(c.heartbeatInterval)
+// handleCloseError 处理服务器发来的 Close 帧，记录其中的重连提示与被拒绝的内容
+func (c *WSClient) handleCloseError(err error) {
+	var closeErr *websocket.CloseError
+	if !errors.As(err, &closeErr) {
+		return
+	}
+	if closeErr.Code == websocket.CloseMessageTooBig {
+		// 服务器拒绝了正在发送的内容：记录下来，避免重连后反复补发
+		c.mu.Lock()
+		c.tooLargeHash = c.sendingHash
+		c.mu.Unlock()
+		c.log("ERROR", fmt.Sprintf("服务器拒绝接收数据: %s", closeErr.Text))
+		return
+	}
+	if closeErr.Code != websocket.CloseGoingAway {
+		return
+	}
+
+	hint, ok := parseReconnectHint(closeErr.Text)
+	if !ok {
+		c.log("WARNING", "服务器正在关闭")
+		return
+	}
+
+	c.mu.Lock()
+	c.reconnectHint = hint
+	c.mu.Unlock()
+	c.log("WARNING", fmt.Sprintf("服务器正在关闭，建议 %v 后重连", hint))
+}
+
+// heartbeatPump 发送心跳，发送失败时连接随之结束
+// 同时发送 V1.1 心跳请求（桌面端服务器会回复）和 WebSocket Ping（中继服务器会回复），
+// 两者都带有时间戳，回复用于保活和计算往返延迟
+func (c *WSClient) heartbeatPump(cc *clientConn) {
+	c.mu.RLock()
+	interval := c.heartbeatInterval
+	c.mu.RUnlock()
+
+	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
 	for {
 		select {
-		case <-c.ctx.Done():
+		case <-cc.ctx.Done():
 			return
 		case <-ticker.C:
-			if err := c.sendHeartbeat(); err != nil {
+			now := time.Now()
+			c.mu.Lock()
+			c.lastPingMs = now.UnixMilli()
+			c.mu.Unlock()
+
+			if err := cc.write(websocket.BinaryMessage, c.protocolMgr.CreateHeartbeatPing(now)); err != nil {
+				c.log("ERROR", fmt.Sprintf("发送心跳失败: %v", err))
+				return
+			}
+
+			ping := make([]byte, 8)
+			binary.BigEndian.PutUint64(ping, uint64(now.UnixNano()))
+			if err := cc.conn.WriteControl(websocket.PingMessage, ping, now.Add(10*time.Second)); err != nil {
 				c.log("ERROR", fmt.Sprintf("发送心跳失败: %v", err))
+				cc.fail(err)
 				return
 			}
 		}
 	}
 }
 
-// sendHeartbeat 发送心跳消息（V1.1 二进制协议）
-func (c *WSClient) sendHeartbeat() error {
-	data := c.protocolMgr.CreateHeartbeat()
-	return c.sendBinaryData(data)
+// handleHeartbeat 处理心跳回复：只接受与最近一次请求时间戳匹配的 Pong，
+// 中继房间中其他成员的心跳请求直接忽略
+func (c *WSClient) handleHeartbeat(msg *protocol.BinaryMessage) {
+	kind, timestamp, ok := protocol.ParseHeartbeat(msg)
+	if !ok || kind != protocol.HeartbeatPong {
+		return
+	}
+
+	c.mu.RLock()
+	matched := timestamp == c.lastPingMs
+	c.mu.RUnlock()
+	if matched {
+		c.setLatency(time.Since(time.UnixMilli(timestamp)))
+	}
 }
 
 // handleBinaryMessage 处理二进制消息（V1.1）
@@ -266,7 +756,18 @@ func (c *WSClient) handleBinaryMessage(data []byte) {
 		if errors.Is(err, protocol.ErrLoopbackDetected) {
 			return
 		}
-		c.log("ERROR", fmt.Sprintf("解析二进制消息失败: %v", err))
+		if origin, ok := protocol.HeaderOrigin(data); ok && errors.Is(err, protocol.ErrChecksumMismatch) {
+			c.discardCorrupt(origin.MsgID)
+			// 错误消息本身损坏时只记录，不再回复
+			if msgType, _ := protocol.HeaderType(data); msgType == protocol.TypeError {
+				c.log("WARNING", fmt.Sprintf("服务器的错误消息校验失败: %v", err))
+				return
+			}
+			c.rejectItem(origin, err)
+			return
+		}
+		c.logProtocol("ERROR", fmt.Sprintf("解析二进制消息失败: %v", err))
+		c.stats.recordParseError()
 		return
 	}
 
@@ -276,12 +777,14 @@ func (c *WSClient) handleBinaryMessage(data []byte) {
 	case protocol.TypeImage:
 		c.handleBinaryImage(msg)
 	case protocol.TypeHeartbeat:
-		// 心跳消息不需要处理
+		c.handleHeartbeat(msg)
 	case protocol.TypeHandshake:
 		// 收到握手响应
 		c.log("INFO", "收到握手响应")
+	case protocol.TypeError:
+		c.handlePeerError(msg)
 	default:
-		c.log("WARNING", fmt.Sprintf("未知的消息类型: 0x%02X", msg.Type))
+		c.logProtocol("WARNING", fmt.Sprintf("未知的消息类型: 0x%02X", msg.Type))
 	}
 }
 
@@ -289,50 +792,69 @@ func (c *WSClient) handleBinaryMessage(data []byte) {
 func (c *WSClient) handleBinaryText(msg *protocol.BinaryMessage) {
 	text := msg.GetTextContent()
 	c.log("INFO", fmt.Sprintf("收到文本数据 [%d 字符]", len(text)))
+	c.stats.recordReceived("text", len(text))
+	c.markSynced("text", []byte(text))
 
 	// 调用回调函数（通知 App 层写入本地剪贴板）
 	if c.clipboardCallback != nil {
-		c.clipboardCallback("text", []byte(text))
+		c.clipboardCallback("text", []byte(text), msg.Origin())
 	}
 }
 
 // handleBinaryImage 处理图片消息（V1.1）
 func (c *WSClient) handleBinaryImage(msg *protocol.BinaryMessage) {
 	var fullData []byte
-	var finished bool
+	var finished, cancelled, spilled bool
+	var rejectErr error
 
 	func() {
 		c.mu.Lock()
 		defer c.mu.Unlock()
 
 		// 检查是否是分片消息
-		isPending := c.PendingBuffer != nil
+		isPending := c.pending != nil
 
 		// 如果包含元数据（首帧）
 		if (msg.Flags & protocol.FlagHasMeta) != 0 {
 			if isPending {
 				c.log("WARNING", "未完成上一次传输就开始新传输，丢弃旧数据")
+				c.resetPending(TransferFailed)
 			}
 
-			// 初始化缓冲区
-			c.PendingMsgID = msg.MsgID
-			c.PendingMeta = msg.Meta
-
-			expectedSize := int(0)
+			// 初始化缓冲区：声明的大小超过限制或内存预算不足时立即拒绝
+			var declared int64
 			if msg.Meta != nil {
-				expectedSize = int(msg.Meta.Size)
+				declared = msg.Meta.Size
 			}
-			// 限制预分配大小，防止 OOM
-			if expectedSize > 100*1024*1024 {
-				expectedSize = 100 * 1024 * 1024
+			pending, err := newReassembly(c.limits, &c.buffered, &c.spilled, declared)
+			if err != nil {
+				rejectErr = err
+				return
 			}
-			c.PendingBuffer = make([]byte, 0, expectedSize)
+			c.PendingMsgID = msg.MsgID
+			c.PendingMeta = msg.Meta
+			c.pending = pending
 
 			// 追加数据（BinaryData 是剥离元数据后的）
+			chunk := msg.Payload
 			if msg.BinaryData != nil {
-				c.PendingBuffer = append(c.PendingBuffer, msg.BinaryData...)
-			} else {
-				c.PendingBuffer = append(c.PendingBuffer, msg.Payload...)
+				chunk = msg.BinaryData
+			}
+			if err := c.pending.write(chunk); err != nil {
+				c.resetPending(TransferFailed)
+				rejectErr = err
+				return
+			}
+
+			// 多分片传输记录接收进度
+			if (msg.Flags & protocol.FlagMF) != 0 {
+				var mime string
+				var total int64
+				if msg.Meta != nil {
+					mime, total = msg.Meta.Mime, msg.Meta.Size
+				}
+				c.PendingTransfer = c.transfers.Begin(TransferReceive, c.peerName(), "image", mime, total)
+				c.PendingTransfer.Add(len(chunk))
 			}
 		} else {
 			// 后续分片
@@ -340,11 +862,21 @@ func (c *WSClient) handleBinaryImage(msg *protocol.BinaryMessage) {
 				return
 			}
 			if msg.MsgID != c.PendingMsgID {
-				c.PendingBuffer = nil
-				c.PendingMeta = nil
+				c.resetPending(TransferFailed)
 				return
 			}
-			c.PendingBuffer = append(c.PendingBuffer, msg.Payload...)
+			if c.PendingTransfer.Cancelled() {
+				// 已取消：丢弃已收到的数据，剩余分片因没有进行中的传输而被忽略
+				c.resetPending(TransferCancelled)
+				cancelled = true
+				return
+			}
+			if err := c.pending.write(msg.Payload); err != nil {
+				c.resetPending(TransferFailed)
+				rejectErr = err
+				return
+			}
+			c.PendingTransfer.Add(len(msg.Payload))
 		}
 
 		// 检查是否还有后续分片
@@ -352,47 +884,150 @@ func (c *WSClient) handleBinaryImage(msg *protocol.BinaryMessage) {
 			return
 		}
 
-		// 传输完成
-		fullData = c.PendingBuffer
+		// 传输完成：与首帧元数据中的哈希比对，不一致时丢弃
+		data, err := c.pending.bytes()
+		if err == nil {
+			err = protocol.VerifyContentHash(c.PendingMeta, data)
+		}
+		if err != nil {
+			c.resetPending(TransferFailed)
+			rejectErr = err
+			return
+		}
+		fullData = data
+		spilled = c.pending.spilled()
 
 		// 清理缓冲区
-		c.PendingBuffer = nil
-		c.PendingMeta = nil
+		c.resetPending(TransferCompleted)
 		finished = true
 	}()
 
+	if rejectErr != nil {
+		if errors.Is(rejectErr, protocol.ErrHashMismatch) {
+			c.stats.recordCorrupt()
+		}
+		c.rejectItem(msg.Origin(), rejectErr)
+		return
+	}
+	if cancelled {
+		c.log("INFO", "已取消接收图片数据")
+		return
+	}
 	if finished {
 		sizeMB := float64(len(fullData)) / 1024 / 1024
-		c.log("INFO", fmt.Sprintf("收到完整图片数据 [%.2f MB]", sizeMB))
+		if spilled {
+			c.log("INFO", fmt.Sprintf("收到完整图片数据 [%.2f MB，经临时文件重组]", sizeMB))
+		} else {
+			c.log("INFO", fmt.Sprintf("收到完整图片数据 [%.2f MB]", sizeMB))
+		}
+		c.stats.recordReceived("image", len(fullData))
+		c.markSynced("image", fullData)
 
 		// 调用回调函数（通知 App 层写入本地剪贴板）
 		if c.clipboardCallback != nil {
-			c.clipboardCallback("image", fullData)
+			c.clipboardCallback("image", fullData, msg.Origin())
 		}
 	}
 }
 
+// discardCorrupt 丢弃校验失败的帧所属的条目：正在重组时放弃已收到的数据，剩余分片随之被忽略
+func (c *WSClient) discardCorrupt(msgID uint32) {
+	c.stats.recordCorrupt()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.pending != nil && c.PendingMsgID == msgID {
+		c.resetPending(TransferFailed)
+	}
+}
+
+// resetPending 丢弃分片重组缓冲区，未完成的接收记为 state（调用方需持有 c.mu）
+func (c *WSClient) resetPending(state string) {
+	c.PendingTransfer.Finish(state)
+	c.pending.discard()
+	c.pending = nil
+	c.PendingMeta = nil
+	c.PendingTransfer = nil
+}
+
+// peerName 传输进度中显示的对端名称（服务器地址）
+func (c *WSClient) peerName() string {
+	if u, err := url.Parse(c.url); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return c.url
+}
+
 // SendClipboardBinary 发送剪贴板数据（V1.1 二进制协议）
 // dataType: "text" 或 "image"
 // content: 对于文本是字符串字节，对于图片是原始二进制数据
+// 断线重连期间数据进入离线队列，重连后补发
 func (c *WSClient) SendClipboardBinary(dataType string, content []byte) error {
-	c.mu.RLock()
+	return c.SendItem(dataType, content, c.protocolMgr.NewOrigin())
+}
+
+// SendItem 以指定来源发送剪贴板条目（用于从其他连接转发，保持原始发送者与消息 ID）
+// 断线重连期间同样进入离线队列
+func (c *WSClient) SendItem(dataType string, content []byte, origin protocol.Origin) error {
+	if dataType != "text" && dataType != "image" {
+		return fmt.Errorf("不支持的数据类型: %s", dataType)
+	}
+
+	c.mu.Lock()
 	if !c.isConnected {
-		c.mu.RUnlock()
-		return fmt.Errorf("客户端未连接")
+		queued := c.running && c.outbox.enabled()
+		var dropped int
+		if queued {
+			dropped = c.outbox.push(dataType, content, origin)
+		}
+		c.mu.Unlock()
+
+		if !queued {
+			return fmt.Errorf("客户端未连接")
+		}
+		c.log("INFO", fmt.Sprintf("客户端离线，剪贴板数据已加入发送队列: %s", dataType))
+		if dropped > 0 {
+			c.log("WARNING", fmt.Sprintf("离线队列已满，丢弃最旧的 %d 条数据", dropped))
+			c.stats.recordDropped(dropped)
+		}
+		return nil
 	}
-	c.mu.RUnlock()
+	c.mu.Unlock()
 
+	err := c.sendClipboard(dataType, content, origin)
+	if errors.Is(err, ErrTransferCancelled) {
+		c.log("INFO", "已取消发送图片数据")
+		return nil
+	}
+	if err != nil && c.IsActive() && c.outbox.enabled() {
+		// 发送过程中断线：放回队列，重连后补发
+		c.outbox.requeue([]outboxItem{{
+			dataType: dataType,
+			content:  content,
+			origin:   origin,
+			hash:     contentHash(dataType, content),
+			queuedAt: time.Now(),
+		}})
+		c.log("WARNING", fmt.Sprintf("发送失败，剪贴板数据已加入发送队列: %v", err))
+		return nil
+	}
+	return err
+}
+
+// sendClipboard 编码并发送剪贴板数据，成功后记录为服务器已有的内容
+func (c *WSClient) sendClipboard(dataType string, content []byte, origin protocol.Origin) error {
 	c.log("INFO", fmt.Sprintf("发送剪贴板数据: %s", dataType))
 
-	var data []byte
+	var frames [][]byte
 	var err error
 
 	switch dataType {
 	case "text":
-		data, err = c.protocolMgr.CreateText(string(content))
+		var data []byte
+		data, err = c.protocolMgr.CreateTextFrom(origin, string(content))
+		frames = [][]byte{data}
 	case "image":
-		data, err = c.protocolMgr.CreateImageFrame(content, "image/png")
+		frames, err = c.protocolMgr.CreateImageChunksFrom(origin, content, "image/png", imageChunkSize)
 	default:
 		return fmt.Errorf("不支持的数据类型: %s", dataType)
 	}
@@ -401,7 +1036,66 @@ func (c *WSClient) SendClipboardBinary(dataType string, content []byte) error {
 		return err
 	}
 
-	return c.sendBinaryData(data)
+	hash := contentHash(dataType, content)
+	c.mu.Lock()
+	c.sendingHash = hash
+	c.sent.add(origin)
+	c.mu.Unlock()
+
+	if len(frames) == 1 {
+		if err := c.sendBinaryData(frames[0]); err != nil {
+			return err
+		}
+	} else if err := c.sendChunks(frames, len(content)); err != nil {
+		return err
+	}
+	c.stats.recordSent(dataType, len(content))
+	c.markSynced(dataType, content)
+	return nil
+}
+
+// sendChunks 依次发送图片分片并记录发送进度，传输被取消时停止发送剩余分片，
+// 已经发出部分分片的还要发送取消消息，让服务器丢弃已收到的数据
+func (c *WSClient) sendChunks(frames [][]byte, total int) error {
+	transfer := c.transfers.Begin(TransferSend, c.peerName(), "image", "image/png", int64(total))
+	sizes := chunkDataSizes(frames, total)
+	for i, frame := range frames {
+		if transfer.Cancelled() {
+			transfer.Finish(TransferCancelled)
+			if i > 0 {
+				c.sendAbort(frames[0])
+			}
+			return ErrTransferCancelled
+		}
+		if err := c.sendBinaryData(frame); err != nil {
+			transfer.Finish(TransferFailed)
+			return err
+		}
+		transfer.Add(sizes[i])
+	}
+	transfer.Finish(TransferCompleted)
+	return nil
+}
+
+// sendAbort 告知服务器已发出部分分片的条目被取消
+func (c *WSClient) sendAbort(firstFrame []byte) {
+	origin, _ := protocol.HeaderOrigin(firstFrame)
+	data, err := c.protocolMgr.CreateError(protocol.ErrorCodeCancelled, origin, "")
+	if err != nil {
+		c.logProtocol("ERROR", fmt.Sprintf("创建取消消息失败: %v", err))
+		return
+	}
+	if err := c.sendBinaryData(data); err != nil {
+		c.log("WARNING", fmt.Sprintf("发送取消消息失败: %v", err))
+	}
+}
+
+// markSynced 记录服务器已有的内容
+func (c *WSClient) markSynced(dataType string, content []byte) {
+	hash := contentHash(dataType, content)
+	c.mu.Lock()
+	c.lastSyncedHash = hash
+	c.mu.Unlock()
 }
 
 // SendClipboard 发送剪贴板数据（兼容旧接口，内部将 Base64 转为二进制）
@@ -425,15 +1119,14 @@ func (c *WSClient) SendClipboard(dataType, content string) error {
 // sendBinaryData 发送二进制数据
 func (c *WSClient) sendBinaryData(data []byte) error {
 	c.mu.RLock()
-	conn := c.conn
+	cc := c.current
 	c.mu.RUnlock()
 
-	if conn == nil {
+	if cc == nil {
 		return fmt.Errorf("连接未建立")
 	}
 
-	conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
-	return conn.WriteMessage(websocket.BinaryMessage, data)
+	return cc.write(websocket.BinaryMessage, data)
 }
 
 // IsConnected 检查是否已连接
@@ -449,3 +1142,29 @@ func (c *WSClient) log(level, message string) {
 		c.logCb(level, message)
 	}
 }
+
+// SetPeerErrorCallback 设置收到服务器错误消息的回调
+func (c *WSClient) SetPeerErrorCallback(cb PeerErrorCallback) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.peerErrorCb = cb
+}
+
+// SetTransferTracker 设置分片传输进度记录器，需在 Connect 之前调用
+func (c *WSClient) SetTransferTracker(t *TransferTracker) {
+	c.transfers = t
+}
+
+// SetProtocolLogCallback 设置协议层日志回调，需在 Connect 之前调用
+func (c *WSClient) SetProtocolLogCallback(cb LogCallback) {
+	c.protocolLogCb = cb
+}
+
+// logProtocol 记录协议层日志
+func (c *WSClient) logProtocol(level, message string) {
+	if c.protocolLogCb != nil {
+		c.protocolLogCb(level, message)
+		return
+	}
+	c.log(level, message)
+}
@@ -0,0 +1,532 @@
+package websocket_test
+
+import (
+	"bytes"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"server/internal/protocol"
+	ws "server/internal/websocket"
+	"server/internal/wstest"
+
+	"github.com/gorilla/websocket"
+)
+
+// ==========================================
+// 端到端集成测试
+// ==========================================
+//
+// 服务器与客户端运行在同一进程内，通过回环地址上的真实 WebSocket 连接通信，
+// 各端收到的条目写入假剪贴板。
+
+// quiet 确认没有多余条目时的观察时间
+const quiet = 200 * time.Millisecond
+
+// testImage 指定大小的伪随机图片数据（超过 64KB 时分片发送）
+func testImage(size int, seed int64) []byte {
+	data := make([]byte, size)
+	rand.New(rand.NewSource(seed)).Read(data)
+	return data
+}
+
+func TestTextFromClientReachesServerAndPeers(t *testing.T) {
+	t.Parallel()
+	log := wstest.NewLog(t)
+	server := wstest.NewServer(t, log)
+	alice := wstest.Dial(t, server, "alice", log)
+	bob := wstest.Dial(t, server, "bob", log)
+
+	text := []byte("来自 alice 的文本")
+	if err := alice.SendClipboardBinary("text", text); err != nil {
+		t.Fatalf("发送失败: %v", err)
+	}
+
+	got := server.Clipboard.WaitFor(t, "text", text)
+	forwarded := bob.Clipboard.WaitFor(t, "text", text)
+	if got.Origin.Sender != alice.UUID {
+		t.Errorf("服务器收到的发送者 = %x，期望 alice %x", got.Origin.Sender, alice.UUID)
+	}
+	if forwarded.Origin != got.Origin {
+		t.Errorf("转发后来源 = %+v，期望保持原始来源 %+v", forwarded.Origin, got.Origin)
+	}
+
+	// 不回发给发送者，服务器与接收方也只写入一次
+	alice.Clipboard.Consistently(t, 0, quiet)
+	server.Clipboard.Consistently(t, 1, 0)
+	bob.Clipboard.Consistently(t, 1, 0)
+}
+
+func TestServerBroadcastReachesAllClients(t *testing.T) {
+	t.Parallel()
+	log := wstest.NewLog(t)
+	server := wstest.NewServer(t, log)
+	clients := []*wstest.Client{
+		wstest.Dial(t, server, "alice", log),
+		wstest.Dial(t, server, "bob", log),
+		wstest.Dial(t, server, "carol", log),
+	}
+
+	text := []byte("桌面端复制的文本")
+	if err := server.BroadcastClipboardBinary("text", text); err != nil {
+		t.Fatalf("广播失败: %v", err)
+	}
+	for _, c := range clients {
+		item := c.Clipboard.WaitFor(t, "text", text)
+		if item.Origin.Sender != server.UUID {
+			t.Errorf("%s 收到的发送者 = %x，期望服务器 %x", c.Name, item.Origin.Sender, server.UUID)
+		}
+	}
+	if n := server.Clipboard.Len(); n != 0 {
+		t.Errorf("服务器自己的广播写入了本机剪贴板 %d 次", n)
+	}
+}
+
+func TestChunkedImageBothDirections(t *testing.T) {
+	t.Parallel()
+	log := wstest.NewLog(t)
+	server := wstest.NewServer(t, log)
+	alice := wstest.Dial(t, server, "alice", log)
+	bob := wstest.Dial(t, server, "bob", log)
+
+	// 客户端 → 服务器 → 其他客户端
+	upload := testImage(300*1024, 1)
+	if err := alice.SendClipboardBinary("image", upload); err != nil {
+		t.Fatalf("发送图片失败: %v", err)
+	}
+	server.Clipboard.WaitFor(t, "image", upload)
+	bob.Clipboard.WaitFor(t, "image", upload)
+
+	// 服务器 → 客户端
+	download := testImage(200*1024+17, 2)
+	if err := server.BroadcastClipboardBinary("image", download); err != nil {
+		t.Fatalf("广播图片失败: %v", err)
+	}
+	alice.Clipboard.WaitFor(t, "image", download)
+	bob.Clipboard.WaitFor(t, "image", download)
+
+	if n := alice.Clipboard.Len(); n != 1 {
+		t.Errorf("alice 收到 %d 个条目，期望只有服务器广播的图片", n)
+	}
+	if totals := server.Statistics().Totals; totals.Corrupt != 0 || totals.ParseErrors != 0 || totals.Dropped != 0 {
+		t.Errorf("服务器统计 = %+v，不应有解析失败、丢弃或校验失败的条目", totals)
+	}
+}
+
+func TestClientRejectsOversizedItem(t *testing.T) {
+	t.Parallel()
+	log := wstest.NewLog(t)
+	server := wstest.NewServer(t, log)
+	rejections := make(chan ws.PeerError, 1)
+	server.SetPeerErrorCallback(func(e ws.PeerError) { rejections <- e })
+
+	limits := ws.DefaultLimits()
+	limits.MaxItemSize = 256 * 1024
+	alice := wstest.NewClient(t, "alice")
+	alice.SetLimits(limits)
+	if err := alice.Connect(server.URL(), log.Callback("alice")); err != nil {
+		t.Fatalf("alice 连接失败: %v", err)
+	}
+	alice.WaitConnected()
+	server.WaitForClient("alice")
+	bob := wstest.Dial(t, server, "bob", log)
+
+	// 超过 alice 条目上限的图片被拒绝，服务器收到错误消息；bob 使用默认限制照常接收
+	image := testImage(300*1024, 3)
+	if err := server.BroadcastClipboardBinary("image", image); err != nil {
+		t.Fatalf("广播图片失败: %v", err)
+	}
+	bob.Clipboard.WaitFor(t, "image", image)
+	select {
+	case e := <-rejections:
+		if e.Code != protocol.ErrorCodeTooLarge || e.Peer != "alice" {
+			t.Errorf("错误消息 = %+v，期望 alice 回复 %s", e, protocol.ErrorCodeTooLarge)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("超时: 服务器未收到 alice 的错误消息")
+	}
+	alice.Clipboard.Consistently(t, 0, quiet)
+
+	// 拒绝条目后连接保持不变，之后的小条目照常接收
+	text := []byte("拒绝后的文本")
+	if err := server.BroadcastClipboardBinary("text", text); err != nil {
+		t.Fatalf("广播失败: %v", err)
+	}
+	alice.Clipboard.WaitFor(t, "text", text)
+}
+
+func TestRelayedRejectionReachesOnlySender(t *testing.T) {
+	t.Parallel()
+	log := wstest.NewLog(t)
+	relay := wstest.NewRelay(t)
+
+	limits := ws.DefaultLimits()
+	limits.MaxItemSize = 256 * 1024
+	alice := wstest.NewClient(t, "alice")
+	alice.SetLimits(limits)
+	if err := alice.Connect(relay.URL(), log.Callback("alice")); err != nil {
+		t.Fatalf("alice 连接中继失败: %v", err)
+	}
+	alice.WaitConnected()
+	relay.WaitForConns(1)
+	bob := relay.Dial("bob", log)
+	carol := relay.Dial("carol", log)
+
+	errs := make(map[string]chan ws.PeerError)
+	for _, c := range []*wstest.Client{alice, bob, carol} {
+		ch := make(chan ws.PeerError, 4)
+		c.SetPeerErrorCallback(func(e ws.PeerError) { ch <- e })
+		errs[c.Name] = ch
+	}
+
+	// alice 拒绝 bob 发送的图片，中继把错误消息转发给 bob 与 carol，只有 bob 显示
+	image := testImage(300*1024, 7)
+	if err := bob.SendClipboardBinary("image", image); err != nil {
+		t.Fatalf("发送图片失败: %v", err)
+	}
+	carol.Clipboard.WaitFor(t, "image", image)
+	select {
+	case e := <-errs["bob"]:
+		if e.Code != protocol.ErrorCodeTooLarge {
+			t.Errorf("bob 收到的错误 = %+v，期望 %s", e, protocol.ErrorCodeTooLarge)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("超时: bob 没有收到 alice 的错误消息")
+	}
+	time.Sleep(quiet)
+	for _, name := range []string{"alice", "carol"} {
+		select {
+		case e := <-errs[name]:
+			t.Errorf("%s 收到了不是针对自己的错误消息: %+v", name, e)
+		default:
+		}
+	}
+}
+
+func TestClientCancelAbortsPartialItem(t *testing.T) {
+	t.Parallel()
+	log := wstest.NewLog(t)
+	transfers := ws.NewTransferTracker()
+	aborts := make(chan *protocol.ErrorPayload, 1)
+	firstMsgID := make(chan uint32, 1)
+
+	// 收到首个分片后取消 alice 的发送，之后读到取消消息为止
+	peer := protocol.NewBinaryProtocolManagerWithUUID([16]byte{0xee})
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		if reply, err := peer.CreateHandshake("peer", "test"); err == nil {
+			conn.WriteMessage(websocket.BinaryMessage, reply)
+		}
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			msg, err := peer.Parse(data)
+			if err != nil {
+				continue
+			}
+			switch {
+			case msg.Type == protocol.TypeImage && msg.Flags&protocol.FlagHasMeta != 0:
+				firstMsgID <- msg.MsgID
+				for _, p := range transfers.Active() {
+					transfers.Cancel(p.ID)
+				}
+			case msg.Type == protocol.TypeError:
+				if payload, err := msg.GetError(); err == nil {
+					aborts <- payload
+				}
+				return
+			}
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	alice := wstest.NewClient(t, "alice")
+	alice.SetTransferTracker(transfers)
+	if err := alice.Connect("ws"+strings.TrimPrefix(srv.URL, "http"), log.Callback("alice")); err != nil {
+		t.Fatalf("alice 连接失败: %v", err)
+	}
+	alice.WaitConnected()
+
+	// 图片远大于回环连接的缓冲区，取消时还有分片没有发出
+	if err := alice.SendClipboardBinary("image", testImage(32<<20, 4)); err != nil {
+		t.Fatalf("发送图片失败: %v", err)
+	}
+	select {
+	case payload := <-aborts:
+		if id := <-firstMsgID; payload.Code != protocol.ErrorCodeCancelled || payload.MsgID != id {
+			t.Errorf("取消消息 = %+v，期望 %s #%d", payload, protocol.ErrorCodeCancelled, id)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("超时: 取消发送后没有收到取消消息")
+	}
+}
+
+func TestServerDiscardsCancelledItem(t *testing.T) {
+	t.Parallel()
+	log := wstest.NewLog(t)
+	server := wstest.NewServer(t, log)
+
+	conn, _, err := websocket.DefaultDialer.Dial(server.URL(), nil)
+	if err != nil {
+		t.Fatalf("连接失败: %v", err)
+	}
+	defer conn.Close()
+	mgr := protocol.NewBinaryProtocolManagerWithUUID([16]byte{0xaa})
+	send := func(data []byte) {
+		t.Helper()
+		if err := conn.WriteMessage(websocket.BinaryMessage, data); err != nil {
+			t.Fatalf("发送失败: %v", err)
+		}
+	}
+	handshake, _ := mgr.CreateHandshake("raw", "test")
+	send(handshake)
+	server.WaitForClient("raw")
+
+	// 只发出首个分片就取消，之后发送的新图片完整写入
+	cancelled, _ := mgr.CreateImageChunks(testImage(300*1024, 5), "image/png", 64*1024)
+	send(cancelled[0])
+	origin, _ := protocol.HeaderOrigin(cancelled[0])
+	abort, _ := mgr.CreateError(protocol.ErrorCodeCancelled, origin, "")
+	send(abort)
+	image := testImage(200*1024, 6)
+	chunks, _ := mgr.CreateImageChunks(image, "image/png", 64*1024)
+	for _, chunk := range chunks {
+		send(chunk)
+	}
+
+	server.Clipboard.WaitFor(t, "image", image)
+	server.Clipboard.Consistently(t, 1, 0)
+	for _, line := range log.Lines() {
+		if strings.Contains(line, "未完成上一次传输") || strings.Contains(line, "拒绝了消息") {
+			t.Errorf("取消的条目没有被丢弃: %s", line)
+		}
+	}
+}
+
+func TestServerRepliesToHandshake(t *testing.T) {
+	t.Parallel()
+	log := wstest.NewLog(t)
+	server := wstest.NewServer(t, log)
+
+	conn, _, err := websocket.DefaultDialer.Dial(server.URL(), nil)
+	if err != nil {
+		t.Fatalf("连接失败: %v", err)
+	}
+	defer conn.Close()
+	handshake, _ := protocol.NewBinaryProtocolManagerWithUUID([16]byte{0xab}).CreateHandshake("raw", "test")
+	if err := conn.WriteMessage(websocket.BinaryMessage, handshake); err != nil {
+		t.Fatalf("发送失败: %v", err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, data, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("等待握手回复失败: %v", err)
+	}
+	if msgType, ok := protocol.HeaderType(data); !ok || msgType != protocol.TypeHandshake {
+		t.Fatalf("服务器回复的消息类型 = 0x%02X，期望握手", msgType)
+	}
+}
+
+func TestOfflineQueueWaitsForHandshakeReply(t *testing.T) {
+	t.Parallel()
+	log := wstest.NewLog(t)
+	text := []byte("握手确认后才补发")
+
+	// 第一次连接收到握手后直接关闭，第二次连接稍后才回复握手；记录每条连接上收到的文本
+	type received struct {
+		conn     int
+		afterAck bool
+	}
+	texts := make(chan received, 4)
+	peer := protocol.NewBinaryProtocolManagerWithUUID([16]byte{0xef})
+	upgrader := websocket.Upgrader{}
+	var conns atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		n := int(conns.Add(1))
+		var acked atomic.Bool
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			msg, err := peer.Parse(data)
+			if err != nil {
+				continue
+			}
+			switch msg.Type {
+			case protocol.TypeHandshake:
+				if n == 1 {
+					conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseTryAgainLater, ""))
+					return
+				}
+				go func() {
+					time.Sleep(quiet)
+					acked.Store(true)
+					reply, _ := peer.CreateHandshake("peer", "test")
+					conn.WriteMessage(websocket.BinaryMessage, reply)
+				}()
+			case protocol.TypeText:
+				texts <- received{conn: n, afterAck: acked.Load()}
+			}
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	alice := wstest.NewClient(t, "alice")
+	if err := alice.Connect("ws"+strings.TrimPrefix(srv.URL, "http")+"/ws", log.Callback("alice")); err != nil {
+		t.Fatalf("alice 连接失败: %v", err)
+	}
+	if err := alice.SendClipboardBinary("text", text); err != nil {
+		t.Fatalf("离线发送失败: %v", err)
+	}
+
+	select {
+	case got := <-texts:
+		if got.conn != 2 || !got.afterAck {
+			t.Fatalf("文本在第 %d 条连接上发出（已确认握手: %v），期望在第 2 条连接确认握手后补发", got.conn, got.afterAck)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("超时: 离线队列没有补发")
+	}
+	alice.WaitConnected()
+	select {
+	case got := <-texts:
+		t.Fatalf("文本重复补发（第 %d 条连接）", got.conn)
+	case <-time.After(quiet):
+	}
+}
+
+func TestClientDisconnectRemovesClient(t *testing.T) {
+	t.Parallel()
+	log := wstest.NewLog(t)
+	server := wstest.NewServer(t, log)
+	alice := wstest.Dial(t, server, "alice", log)
+	bob := wstest.Dial(t, server, "bob", log)
+
+	if err := alice.Disconnect(); err != nil {
+		t.Fatalf("断开失败: %v", err)
+	}
+	server.WaitForClientGone("alice")
+	if n := server.GetClientCount(); n != 1 {
+		t.Fatalf("客户端数量 = %d，期望 1", n)
+	}
+
+	// 剩余客户端不受影响；已断开的客户端不再发送
+	text := []byte("after disconnect")
+	if err := server.BroadcastClipboardBinary("text", text); err != nil {
+		t.Fatalf("广播失败: %v", err)
+	}
+	bob.Clipboard.WaitFor(t, "text", text)
+	if err := alice.SendClipboardBinary("text", text); err == nil {
+		t.Errorf("主动断开后发送应返回错误")
+	}
+	alice.Clipboard.Consistently(t, 0, quiet)
+}
+
+func TestKickedClientDoesNotReconnect(t *testing.T) {
+	t.Parallel()
+	log := wstest.NewLog(t)
+	server := wstest.NewServer(t, log)
+	alice := wstest.Dial(t, server, "alice", log)
+
+	failed := make(chan ws.ConnectionStateEvent, 1)
+	alice.SetStateCallback(func(event ws.ConnectionStateEvent) {
+		if event.State == ws.StateFailed {
+			failed <- event
+		}
+	})
+
+	if err := server.KickClient(server.ClientID("alice"), "测试踢出"); err != nil {
+		t.Fatalf("踢出失败: %v", err)
+	}
+	var event ws.ConnectionStateEvent
+	select {
+	case event = <-failed:
+	case <-time.After(wstest.Timeout):
+		t.Fatalf("被踢出后客户端未放弃重连，当前状态 %s", alice.State())
+	}
+
+	want := (&ws.RejectedError{Code: ws.CloseKicked, Reason: "测试踢出"}).Error()
+	if event.Error != want {
+		t.Errorf("失败原因 = %q，期望 %q", event.Error, want)
+	}
+	server.WaitForClientGone("alice")
+	time.Sleep(quiet)
+	if n := server.GetClientCount(); n != 0 {
+		t.Errorf("被踢出的客户端重新连接了，客户端数量 = %d", n)
+	}
+}
+
+func TestClientsReconnectAfterServerRestart(t *testing.T) {
+	t.Parallel()
+	log := wstest.NewLog(t)
+	server := wstest.NewServer(t, log)
+	alice := wstest.Dial(t, server, "alice", log)
+	bob := wstest.Dial(t, server, "bob", log)
+
+	server.Restart()
+	server.WaitForClient("alice")
+	server.WaitForClient("bob")
+	alice.WaitConnected()
+	bob.WaitConnected()
+
+	text := []byte("重连后的文本")
+	if err := alice.SendClipboardBinary("text", text); err != nil {
+		t.Fatalf("发送失败: %v", err)
+	}
+	server.Clipboard.WaitFor(t, "text", text)
+	bob.Clipboard.WaitFor(t, "text", text)
+}
+
+func TestOfflineQueueFlushedOnReconnect(t *testing.T) {
+	t.Parallel()
+	log := wstest.NewLog(t)
+	server := wstest.NewServer(t, log)
+	alice := wstest.Dial(t, server, "alice", log)
+
+	if err := server.Stop(); err != nil {
+		t.Fatalf("停止服务器失败: %v", err)
+	}
+	wstest.Eventually(t, func() bool { return !alice.IsConnected() }, "alice 等待断线")
+
+	// 断线期间的变化进入离线队列，重连后按顺序补发
+	first := []byte("离线时复制的第一条")
+	image := testImage(100*1024, 3)
+	for _, item := range []struct {
+		dataType string
+		content  []byte
+	}{{"text", first}, {"image", image}} {
+		if err := alice.SendClipboardBinary(item.dataType, item.content); err != nil {
+			t.Fatalf("离线发送 %s 失败: %v", item.dataType, err)
+		}
+	}
+	if server.Clipboard.Len() != 0 {
+		t.Fatalf("服务器停止期间收到了条目")
+	}
+
+	server.Resume()
+	server.Clipboard.WaitFor(t, "text", first)
+	server.Clipboard.WaitFor(t, "image", image)
+
+	items := server.Clipboard.Items()
+	if len(items) != 2 || !bytes.Equal(items[0].Content, first) {
+		t.Errorf("补发顺序或数量不符: 共 %d 个条目", len(items))
+	}
+}
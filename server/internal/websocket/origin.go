@@ -0,0 +1,55 @@
+package websocket
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ==========================================
+// 来源校验（防止网页跨站连接本地服务）
+// ==========================================
+//
+// 浏览器发起的 WebSocket 连接一定带有 Origin 头，而桌面端和鸿蒙端客户端不会
+// 发送该头。默认拒绝所有带 Origin 的请求，避免用户访问的任意网页连接本地
+// 服务器并注入剪贴板内容；确需网页接入时，通过允许列表放行。
+
+// originAllowed 检查 WebSocket 升级请求的来源
+// - 没有 Origin 头：非浏览器客户端，允许
+// - 命中允许列表：允许，支持 "*" 与 "https://*.example.com" 形式的子域名通配
+// - 其他浏览器来源：拒绝
+func originAllowed(r *http.Request, allowed []string) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+
+	for _, pattern := range allowed {
+		if matchOrigin(pattern, u) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchOrigin 判断来源是否匹配允许列表中的一项
+func matchOrigin(pattern string, origin *url.URL) bool {
+	if pattern == "*" {
+		return true
+	}
+
+	p, err := url.Parse(strings.TrimSuffix(strings.TrimSpace(pattern), "/"))
+	if err != nil || !strings.EqualFold(p.Scheme, origin.Scheme) {
+		return false
+	}
+	if suffix, ok := strings.CutPrefix(p.Host, "*."); ok {
+		host := strings.ToLower(origin.Host)
+		return strings.HasSuffix(host, "."+strings.ToLower(suffix))
+	}
+	return strings.EqualFold(p.Host, origin.Host)
+}
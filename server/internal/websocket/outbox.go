@@ -0,0 +1,126 @@
+package websocket
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"server/internal/protocol"
+)
+
+// ==========================================
+// 离线发送队列
+// ==========================================
+//
+// 客户端断线重连期间，本地剪贴板变化先进入有界队列，只保留最新的 N 条；
+// 重连并完成握手后按顺序补发。补发前与服务器已有的内容（最后一次成功
+// 发送或收到的内容）比对，相同的条目不再重复发送。
+
+// outboxItem 待发送的剪贴板条目
+type outboxItem struct {
+	dataType string
+	content  []byte
+	origin   protocol.Origin
+	hash     string
+	queuedAt time.Time
+}
+
+// outbox 有界离线发送队列
+type outbox struct {
+	items    []outboxItem
+	capacity int // 最多保留的条目数，0 表示不缓存
+	mu       sync.Mutex
+}
+
+// newOutbox 创建离线发送队列
+func newOutbox(capacity int) *outbox {
+	return &outbox{capacity: capacity}
+}
+
+// contentHash 计算剪贴板条目的哈希，用于去重
+func contentHash(dataType string, content []byte) string {
+	h := sha256.New()
+	h.Write([]byte(dataType))
+	h.Write([]byte{0})
+	h.Write(content)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// setCapacity 修改队列容量，超出部分丢弃最旧的条目
+func (o *outbox) setCapacity(capacity int) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if capacity < 0 {
+		capacity = 0
+	}
+	o.capacity = capacity
+	o.trim()
+}
+
+// enabled 是否开启离线缓存
+func (o *outbox) enabled() bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.capacity > 0
+}
+
+// push 加入一条待发送条目，返回因超出容量被丢弃的条目数
+// 队列中已有相同内容时移到队尾，不重复保存
+func (o *outbox) push(dataType string, content []byte, origin protocol.Origin) int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	item := outboxItem{
+		dataType: dataType,
+		content:  content,
+		origin:   origin,
+		hash:     contentHash(dataType, content),
+		queuedAt: time.Now(),
+	}
+	for i, existing := range o.items {
+		if existing.hash == item.hash {
+			o.items = append(o.items[:i], o.items[i+1:]...)
+			break
+		}
+	}
+	o.items = append(o.items, item)
+	return o.trim()
+}
+
+// requeue 把未能发送的条目放回队首，仍受容量限制（优先保留较新的条目）
+func (o *outbox) requeue(items []outboxItem) {
+	if len(items) == 0 {
+		return
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.items = append(append([]outboxItem(nil), items...), o.items...)
+	o.trim()
+}
+
+// drain 取出全部待发送条目
+func (o *outbox) drain() []outboxItem {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	items := o.items
+	o.items = nil
+	return items
+}
+
+// len 队列中的条目数
+func (o *outbox) len() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return len(o.items)
+}
+
+// trim 丢弃超出容量的最旧条目（调用方需持有 o.mu）
+func (o *outbox) trim() int {
+	dropped := len(o.items) - o.capacity
+	if dropped <= 0 {
+		return 0
+	}
+	o.items = append([]outboxItem(nil), o.items[dropped:]...)
+	return dropped
+}
@@ -0,0 +1,227 @@
+package websocket
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// ==========================================
+// 接收限制与分片重组
+// ==========================================
+//
+// 对端发来的分片在接收端重组为完整条目，服务器与出站客户端使用同一套
+// 代码。为防止恶意或异常的对端耗尽内存，接收时有三层限制：
+//   - 单帧大小（WebSocket 读取上限），超过时连接以 1009 关闭
+//   - 单个条目大小，元数据声明或实际累计超过时拒绝该条目并回复错误消息
+//   - 正在内存中重组的数据合计（服务器为所有客户端合计，出站客户端按连接计算），
+//     超过时拒绝新的数据
+//
+// 超过落盘阈值的条目写入临时文件重组，重组期间不占用内存预算，而是占用同样
+// 按服务器合计、按出站连接计算的临时文件预算，超过时拒绝；完成后一次性读回
+// 内存时按条目大小占用内存预算，预算不足时同样拒绝。
+
+// Limits 接收限制
+type Limits struct {
+	MaxFrameSize    int64  // 单帧最大字节数
+	MaxItemSize     int64  // 单个条目（重组后）最大字节数
+	MaxBufferedSize int64  // 所有客户端在内存中重组的数据合计上限
+	SpillThreshold  int64  // 条目超过该大小时写入临时文件重组，0 表示始终在内存中重组
+	MaxSpilledSize  int64  // 所有客户端写入临时文件的数据合计上限
+	SpillDir        string // 临时文件目录，为空时使用系统临时目录
+}
+
+// DefaultLimits 默认接收限制
+func DefaultLimits() Limits {
+	return Limits{
+		MaxFrameSize:    16 * 1024 * 1024,
+		MaxItemSize:     100 * 1024 * 1024,
+		MaxBufferedSize: 256 * 1024 * 1024,
+		SpillThreshold:  16 * 1024 * 1024,
+		MaxSpilledSize:  1024 * 1024 * 1024,
+	}
+}
+
+// ItemTooLargeError 条目超过大小限制
+type ItemTooLargeError struct {
+	Size  int64
+	Limit int64
+}
+
+// Error 拒绝原因，随错误消息发送给客户端
+func (e *ItemTooLargeError) Error() string {
+	return fmt.Sprintf("条目大小 %d 字节超过上限 %d 字节", e.Size, e.Limit)
+}
+
+// errBufferFull 内存重组预算已用完
+var errBufferFull = errors.New("接收缓冲区已满")
+
+// errSpillFull 临时文件预算已用完，与 errBufferFull 一样以 buffer_full 拒绝
+var errSpillFull = fmt.Errorf("%w（临时文件空间不足）", errBufferFull)
+
+// bufferBudget 重组预算（内存或临时文件），服务器由所有客户端共享
+type bufferBudget struct {
+	used int64
+	mu   sync.Mutex
+}
+
+// reserve 占用 n 字节预算，超过 limit 时返回 false
+func (b *bufferBudget) reserve(n, limit int64) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.used+n > limit {
+		return false
+	}
+	b.used += n
+	return true
+}
+
+// release 归还 n 字节预算
+func (b *bufferBudget) release(n int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.used -= n
+}
+
+// reassembly 一个条目的重组缓冲区：在内存中或临时文件中
+type reassembly struct {
+	limits       Limits
+	budget       *bufferBudget // 内存预算
+	disk         *bufferBudget // 临时文件预算
+	buf          []byte
+	file         *os.File
+	size         int64
+	reserved     int64 // 已占用的内存预算
+	diskReserved int64 // 已占用的临时文件预算
+}
+
+// newReassembly 开始重组一个条目，declared 为元数据中声明的大小（未知时为 0）
+// 声明的大小超过限制或内存（落盘时为临时文件）预算不足时立即拒绝
+func newReassembly(limits Limits, budget, disk *bufferBudget, declared int64) (*reassembly, error) {
+	if declared > limits.MaxItemSize {
+		return nil, &ItemTooLargeError{Size: declared, Limit: limits.MaxItemSize}
+	}
+
+	r := &reassembly{limits: limits, budget: budget, disk: disk}
+	if limits.SpillThreshold > 0 && declared > limits.SpillThreshold {
+		if !disk.reserve(declared, limits.MaxSpilledSize) {
+			return nil, errSpillFull
+		}
+		r.diskReserved = declared
+		if err := r.spill(); err != nil {
+			r.discard()
+			return nil, err
+		}
+		return r, nil
+	}
+	if declared > 0 {
+		if !budget.reserve(declared, limits.MaxBufferedSize) {
+			return nil, errBufferFull
+		}
+		r.reserved = declared
+		r.buf = make([]byte, 0, declared)
+	}
+	return r, nil
+}
+
+// write 追加一段数据，超过条目上限或内存预算时返回错误（调用方应随后 discard）
+func (r *reassembly) write(p []byte) error {
+	size := r.size + int64(len(p))
+	if size > r.limits.MaxItemSize {
+		return &ItemTooLargeError{Size: size, Limit: r.limits.MaxItemSize}
+	}
+
+	if r.file == nil && r.limits.SpillThreshold > 0 && size > r.limits.SpillThreshold {
+		if err := r.spill(); err != nil {
+			return err
+		}
+	}
+
+	if r.file != nil {
+		if size > r.diskReserved {
+			if !r.disk.reserve(size-r.diskReserved, r.limits.MaxSpilledSize) {
+				return errSpillFull
+			}
+			r.diskReserved = size
+		}
+		if _, err := r.file.Write(p); err != nil {
+			return fmt.Errorf("写入临时文件失败: %w", err)
+		}
+	} else {
+		if size > r.reserved {
+			if !r.budget.reserve(size-r.reserved, r.limits.MaxBufferedSize) {
+				return errBufferFull
+			}
+			r.reserved = size
+		}
+		r.buf = append(r.buf, p...)
+	}
+	r.size = size
+	return nil
+}
+
+// spill 改为在临时文件中重组，已在内存中的数据一并写入并归还内存预算
+// 已在内存中的数据改为占用临时文件预算
+func (r *reassembly) spill() error {
+	if n := int64(len(r.buf)); n > r.diskReserved {
+		if !r.disk.reserve(n-r.diskReserved, r.limits.MaxSpilledSize) {
+			return errSpillFull
+		}
+		r.diskReserved = n
+	}
+	f, err := os.CreateTemp(r.limits.SpillDir, "nextpaste-*.part")
+	if err != nil {
+		return fmt.Errorf("创建临时文件失败: %w", err)
+	}
+	if _, err := f.Write(r.buf); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return fmt.Errorf("写入临时文件失败: %w", err)
+	}
+	r.file = f
+	r.buf = nil
+	r.budget.release(r.reserved)
+	r.reserved = 0
+	return nil
+}
+
+// bytes 读出完整条目，之后需调用 discard 释放资源
+// 临时文件中的条目读回内存前先占用预算，预算不足时返回 errBufferFull
+func (r *reassembly) bytes() ([]byte, error) {
+	if r.file == nil {
+		return r.buf, nil
+	}
+	if !r.budget.reserve(r.size, r.limits.MaxBufferedSize) {
+		return nil, errBufferFull
+	}
+	r.reserved = r.size
+	data := make([]byte, r.size)
+	if _, err := r.file.ReadAt(data, 0); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("读取临时文件失败: %w", err)
+	}
+	return data, nil
+}
+
+// spilled 是否在临时文件中重组
+func (r *reassembly) spilled() bool {
+	return r.file != nil
+}
+
+// discard 释放内存与临时文件预算并删除临时文件，可重复调用
+func (r *reassembly) discard() {
+	if r == nil {
+		return
+	}
+	r.budget.release(r.reserved)
+	r.reserved = 0
+	r.disk.release(r.diskReserved)
+	r.diskReserved = 0
+	r.buf = nil
+	if r.file != nil {
+		r.file.Close()
+		os.Remove(r.file.Name())
+		r.file = nil
+	}
+}
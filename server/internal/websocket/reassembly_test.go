@@ -0,0 +1,170 @@
+package websocket
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"server/internal/protocol"
+)
+
+// testLimits 小尺寸的接收限制，临时文件写入测试目录
+func testLimits(t *testing.T) Limits {
+	return Limits{
+		MaxFrameSize:    1024,
+		MaxItemSize:     4096,
+		MaxBufferedSize: 2048,
+		SpillThreshold:  1024,
+		MaxSpilledSize:  4096,
+		SpillDir:        t.TempDir(),
+	}
+}
+
+func TestReassemblyInMemoryUsesBudget(t *testing.T) {
+	var budget, disk bufferBudget
+	limits := testLimits(t)
+
+	r, err := newReassembly(limits, &budget, &disk, 1000)
+	if err != nil {
+		t.Fatalf("newReassembly: %v", err)
+	}
+	if budget.used != 1000 {
+		t.Fatalf("预算占用 = %d，期望按声明大小占用 1000", budget.used)
+	}
+	if _, err := newReassembly(limits, &budget, &disk, 1000); err != nil {
+		t.Fatalf("第二个条目: %v", err)
+	}
+	if _, err := newReassembly(limits, &budget, &disk, 100); !errors.Is(err, errBufferFull) {
+		t.Fatalf("预算用完后 err = %v，期望 errBufferFull", err)
+	}
+
+	r.discard()
+	r.discard()
+	if budget.used != 1000 {
+		t.Fatalf("discard 后预算占用 = %d，期望 1000", budget.used)
+	}
+}
+
+func TestReassemblyRejectsOversizedItem(t *testing.T) {
+	var budget, disk bufferBudget
+	limits := testLimits(t)
+
+	var tooLarge *ItemTooLargeError
+	if _, err := newReassembly(limits, &budget, &disk, 5000); !errors.As(err, &tooLarge) {
+		t.Fatalf("声明大小超限时 err = %v，期望 ItemTooLargeError", err)
+	}
+
+	// 未声明大小的条目在累计超过上限时拒绝
+	r, err := newReassembly(limits, &budget, &disk, 0)
+	if err != nil {
+		t.Fatalf("newReassembly: %v", err)
+	}
+	defer r.discard()
+	for i := 0; i < 4; i++ {
+		if err := r.write(make([]byte, 1024)); err != nil {
+			t.Fatalf("第 %d 段: %v", i, err)
+		}
+	}
+	if err := r.write([]byte{0}); !errors.As(err, &tooLarge) {
+		t.Fatalf("累计超限时 err = %v，期望 ItemTooLargeError", err)
+	}
+}
+
+func TestReassemblySpilledReadBackUsesBudget(t *testing.T) {
+	var budget, disk bufferBudget
+	limits := testLimits(t)
+	data := bytes.Repeat([]byte("0123456789"), 150)
+
+	r, err := newReassembly(limits, &budget, &disk, int64(len(data)))
+	if err != nil {
+		t.Fatalf("newReassembly: %v", err)
+	}
+	if err := r.write(data); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if !r.spilled() || budget.used != 0 {
+		t.Fatalf("spilled = %v，预算占用 = %d，期望在临时文件中重组且不占用预算", r.spilled(), budget.used)
+	}
+
+	got, err := r.bytes()
+	if err != nil {
+		t.Fatalf("bytes: %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatalf("读回的数据与写入的不一致")
+	}
+	if budget.used != int64(len(data)) {
+		t.Fatalf("读回后预算占用 = %d，期望 %d", budget.used, len(data))
+	}
+	r.discard()
+	if budget.used != 0 {
+		t.Fatalf("discard 后预算占用 = %d，期望 0", budget.used)
+	}
+}
+
+func TestReassemblySpilledReadBackRejectedWhenBudgetFull(t *testing.T) {
+	var budget, disk bufferBudget
+	limits := testLimits(t)
+
+	r, err := newReassembly(limits, &budget, &disk, 1500)
+	if err != nil {
+		t.Fatalf("newReassembly: %v", err)
+	}
+	defer r.discard()
+	if err := r.write(make([]byte, 1500)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	// 其他条目占用了大部分预算，读回放不下
+	if !budget.reserve(1000, limits.MaxBufferedSize) {
+		t.Fatalf("占用预算失败")
+	}
+	if _, err := r.bytes(); !errors.Is(err, errBufferFull) {
+		t.Fatalf("预算不足时 err = %v，期望 errBufferFull", err)
+	}
+	r.discard()
+	if budget.used != 1000 {
+		t.Fatalf("discard 后预算占用 = %d，期望只剩其他条目的 1000", budget.used)
+	}
+}
+
+func TestReassemblySpillUsesDiskBudget(t *testing.T) {
+	var budget, disk bufferBudget
+	limits := testLimits(t)
+
+	// 声明大小超过落盘阈值的条目按声明大小占用临时文件预算
+	first, err := newReassembly(limits, &budget, &disk, 3000)
+	if err != nil {
+		t.Fatalf("newReassembly: %v", err)
+	}
+	if disk.used != 3000 || budget.used != 0 {
+		t.Fatalf("临时文件预算占用 = %d，内存预算占用 = %d，期望 3000 与 0", disk.used, budget.used)
+	}
+	if _, err := newReassembly(limits, &budget, &disk, 2000); !errors.Is(err, errBufferFull) {
+		t.Fatalf("临时文件预算不足时 err = %v，期望 errBufferFull", err)
+	}
+	if disk.used != 3000 {
+		t.Fatalf("拒绝后临时文件预算占用 = %d，期望 3000", disk.used)
+	}
+
+	// 未声明大小的条目在超过落盘阈值后按实际大小占用，超过预算时拒绝
+	second, err := newReassembly(limits, &budget, &disk, 0)
+	if err != nil {
+		t.Fatalf("newReassembly: %v", err)
+	}
+	if err := second.write(make([]byte, 900)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := second.write(make([]byte, 900)); !errors.Is(err, errBufferFull) {
+		t.Fatalf("落盘后超过临时文件预算时 err = %v，期望 errBufferFull", err)
+	}
+	if code := rejectionCode(errSpillFull); code != protocol.ErrorCodeBufferFull {
+		t.Errorf("rejectionCode = %s，期望 %s", code, protocol.ErrorCodeBufferFull)
+	}
+
+	first.discard()
+	second.discard()
+	if disk.used != 0 || budget.used != 0 {
+		t.Fatalf("discard 后临时文件预算占用 = %d，内存预算占用 = %d，期望 0", disk.used, budget.used)
+	}
+}
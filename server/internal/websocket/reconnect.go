@@ -0,0 +1,156 @@
+package websocket
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// ==========================================
+// 重连策略
+// ==========================================
+
+// ReconnectPolicy 客户端重连策略（指数退避 + 随机抖动）
+type ReconnectPolicy struct {
+	InitialDelay time.Duration // 第一次重试前的等待时间
+	MaxDelay     time.Duration // 单次等待时间上限
+	Multiplier   float64       // 每次失败后等待时间的增长倍数
+	Jitter       float64       // 随机抖动比例（0~1），避免大量客户端同时重连
+	MaxAttempts  int           // 连续失败的最大重试次数，0 表示不限制
+}
+
+// DefaultReconnectPolicy 默认重连策略：1s 起步，每次翻倍，最长 60s，±20% 抖动，不限次数
+func DefaultReconnectPolicy() ReconnectPolicy {
+	return ReconnectPolicy{
+		InitialDelay: time.Second,
+		MaxDelay:     60 * time.Second,
+		Multiplier:   2,
+		Jitter:       0.2,
+	}
+}
+
+// Delay 计算第 attempt 次重试（从 1 开始）前的等待时间
+func (p ReconnectPolicy) Delay(attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+
+	delay := float64(p.InitialDelay) * math.Pow(multiplier, float64(attempt-1))
+	if p.MaxDelay > 0 && delay > float64(p.MaxDelay) {
+		delay = float64(p.MaxDelay)
+	}
+	if p.Jitter > 0 {
+		jitter := math.Min(p.Jitter, 1)
+		delay += delay * jitter * (rand.Float64()*2 - 1)
+	}
+	return time.Duration(delay)
+}
+
+// Exhausted 连续失败 attempts 次后是否应放弃重连
+func (p ReconnectPolicy) Exhausted(attempts int) bool {
+	return p.MaxAttempts > 0 && attempts >= p.MaxAttempts
+}
+
+// ==========================================
+// 连接状态
+// ==========================================
+
+// ConnectionState 客户端连接状态
+type ConnectionState string
+
+const (
+	StateDisconnected ConnectionState = "disconnected" // 未连接（未启动或已主动断开）
+	StateConnecting   ConnectionState = "connecting"   // 正在连接
+	StateConnected    ConnectionState = "connected"    // 已连接
+	StateBackingOff   ConnectionState = "backing-off"  // 连接失败，等待下次重试
+	StateFailed       ConnectionState = "failed"       // 放弃重连
+)
+
+// ConnectionStateEvent 连接状态变化事件，推送给前端
+type ConnectionStateEvent struct {
+	ID            string          `json:"id,omitempty"` // 连接 ID（由连接管理器填写）
+	State         ConnectionState `json:"state"`
+	URL           string          `json:"url"`
+	Attempt       int             `json:"attempt"`                 // 当前连续失败次数
+	NextAttemptAt int64           `json:"nextAttemptAt,omitempty"` // 下次重试时间（毫秒时间戳），仅 backing-off
+	Error         string          `json:"error,omitempty"`
+}
+
+// StateCallback 连接状态变化回调
+type StateCallback func(event ConnectionStateEvent)
+
+// ==========================================
+// 错误分类
+// ==========================================
+
+// handshakeError 服务器拒绝了 WebSocket 升级请求
+type handshakeError struct {
+	StatusCode int
+	RetryAfter time.Duration // 服务器通过 Retry-After 头建议的等待时间
+	err        error
+}
+
+func (e *handshakeError) Error() string {
+	return fmt.Sprintf("%v (HTTP %d)", e.err, e.StatusCode)
+}
+
+func (e *handshakeError) Unwrap() error {
+	return e.err
+}
+
+// newHandshakeError 根据握手响应构造错误
+func newHandshakeError(resp *http.Response, err error) *handshakeError {
+	he := &handshakeError{StatusCode: resp.StatusCode, err: err}
+	if seconds, convErr := strconv.Atoi(resp.Header.Get("Retry-After")); convErr == nil && seconds >= 0 {
+		he.RetryAfter = time.Duration(seconds) * time.Second
+	}
+	return he
+}
+
+// isTransientError 判断连接错误是否是暂时性的，值得重试
+// 例如 DNS 暂时无法解析、服务器尚未启动（连接被拒绝）、超时、服务器正在重启（502/503/504）；
+// 地址格式错误、域名不存在、路径不存在、未授权、TLS 握手失败等错误重试也不会成功
+func isTransientError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var he *handshakeError
+	if errors.As(err, &he) {
+		switch he.StatusCode {
+		case http.StatusTooManyRequests, http.StatusBadGateway,
+			http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return !dnsErr.IsNotFound
+	}
+
+	if errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNABORTED) ||
+		errors.Is(err, syscall.EHOSTUNREACH) ||
+		errors.Is(err, syscall.ENETUNREACH) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
@@ -0,0 +1,50 @@
+package websocket
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"syscall"
+	"testing"
+)
+
+// timeoutError 超时的网络错误
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestIsTransientError(t *testing.T) {
+	dialErr := func(err error) error {
+		return &net.OpError{Op: "dial", Net: "tcp", Err: err}
+	}
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"connection refused", dialErr(os.NewSyscallError("connect", syscall.ECONNREFUSED)), true},
+		{"host unreachable", dialErr(os.NewSyscallError("connect", syscall.EHOSTUNREACH)), true},
+		{"unexpected eof", fmt.Errorf("read: %w", io.ErrUnexpectedEOF), true},
+		{"dial timeout", dialErr(timeoutError{}), true},
+		{"dns temporary", dialErr(&net.DNSError{Err: "server misbehaving", Name: "relay.example", IsTemporary: true}), true},
+		{"dns no such host", dialErr(&net.DNSError{Err: "no such host", Name: "relay.exmaple", IsNotFound: true}), false},
+		{"other dial error", dialErr(errors.New("tls: handshake failure")), false},
+		{"permission denied", dialErr(os.NewSyscallError("connect", syscall.EACCES)), false},
+		{"http 503", &handshakeError{StatusCode: http.StatusServiceUnavailable, err: errors.New("bad handshake")}, true},
+		{"http 404", &handshakeError{StatusCode: http.StatusNotFound, err: errors.New("bad handshake")}, false},
+		{"http 401", &handshakeError{StatusCode: http.StatusUnauthorized, err: errors.New("bad handshake")}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isTransientError(tt.err); got != tt.want {
+				t.Errorf("isTransientError(%v) = %v，期望 %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
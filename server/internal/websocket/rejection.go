@@ -0,0 +1,232 @@
+package websocket
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"server/internal/protocol"
+)
+
+// ==========================================
+// 错误消息
+// ==========================================
+//
+// 服务器拒绝客户端发来的消息（条目过大、未握手、类型不支持等）时回复
+// 错误消息（TypeError），连接保持不变；客户端拒绝服务器发来的条目时同样
+// 回复错误消息。发送方收到后记录日志并通过回调显示在界面上。错误消息本身不会再引起错误回复，避免双方来回响应。
+//
+// 发送方中途取消多分片条目时同样发送错误消息（cancelled），msgId 为被取消的条目；
+// 接收方据此丢弃已收到的分片，不作为错误显示。
+
+// PeerError 对端回复的错误消息
+type PeerError struct {
+	Peer      string `json:"peer"` // 对端名称或地址
+	Code      string `json:"code"`
+	MsgID     uint32 `json:"msgId"`
+	Reason    string `json:"reason"`
+	Timestamp int64  `json:"timestamp"` // 收到的时间（毫秒时间戳）
+
+	// target 被拒绝的消息来源；hasTarget 为 false 时对端是不带 target 的旧版本
+	target    protocol.Origin
+	hasTarget bool
+}
+
+// recentOrigins 最近发出的消息来源（环形缓冲区）
+type recentOrigins struct {
+	list [64]protocol.Origin
+	next int
+}
+
+// add 记录一条发出的消息
+func (r *recentOrigins) add(o protocol.Origin) {
+	r.list[r.next] = o
+	r.next = (r.next + 1) % len(r.list)
+}
+
+// contains 是否发出过 target 对应的消息；没有 target 时只比较消息 ID
+func (r *recentOrigins) contains(target protocol.Origin, hasTarget bool) bool {
+	for _, o := range r.list {
+		if o.IsZero() || o.MsgID != target.MsgID {
+			continue
+		}
+		if !hasTarget || o.Sender == target.Sender {
+			return true
+		}
+	}
+	return false
+}
+
+// PeerErrorCallback 收到对端错误消息的回调
+type PeerErrorCallback func(e PeerError)
+
+// newPeerError 从错误消息中解析 PeerError
+func newPeerError(peer string, msg *protocol.BinaryMessage) (PeerError, error) {
+	payload, err := msg.GetError()
+	if err != nil {
+		return PeerError{}, err
+	}
+	target, hasTarget := payload.Origin()
+	return PeerError{
+		Peer:      peer,
+		Code:      payload.Code,
+		MsgID:     payload.MsgID,
+		Reason:    payload.Reason,
+		Timestamp: time.Now().UnixMilli(),
+		target:    target,
+		hasTarget: hasTarget,
+	}, nil
+}
+
+// rejectionCode 接收错误对应的错误码
+func rejectionCode(err error) string {
+	var tooLarge *ItemTooLargeError
+	switch {
+	case errors.As(err, &tooLarge):
+		return protocol.ErrorCodeTooLarge
+	case errors.Is(err, errBufferFull):
+		return protocol.ErrorCodeBufferFull
+	case errors.Is(err, protocol.ErrChecksumMismatch), errors.Is(err, protocol.ErrHashMismatch):
+		return protocol.ErrorCodeCorrupt
+	default:
+		return protocol.ErrorCodeBadMeta
+	}
+}
+
+// sendError 向客户端回复错误消息，target 为被拒绝的消息
+func (s *Server) sendError(client *Client, code string, target protocol.Origin, reason string) {
+	data, err := s.protocolMgr.CreateError(code, target, reason)
+	if err != nil {
+		s.logProtocol("ERROR", fmt.Sprintf("创建错误消息失败: %v", err))
+		return
+	}
+	if !client.enqueueControl(data) {
+		client.stats.recordDropped(1)
+	}
+}
+
+// rejectItem 拒绝客户端发来的条目，并以错误消息告知客户端原因
+func (s *Server) rejectItem(client *Client, target protocol.Origin, err error) {
+	s.log("WARNING", fmt.Sprintf("拒绝客户端 %s 的数据: %v", s.displayName(client), err))
+	s.sendError(client, rejectionCode(err), target, err.Error())
+}
+
+// rejectItem 拒绝服务器发来的条目，并以错误消息告知原因
+// 错误消息中带有条目的发送者：经中继转发时只有发送者本人处理
+func (c *WSClient) rejectItem(target protocol.Origin, err error) {
+	c.log("WARNING", fmt.Sprintf("拒绝服务器的数据: %v", err))
+	data, cerr := c.protocolMgr.CreateError(rejectionCode(err), target, err.Error())
+	if cerr != nil {
+		c.logProtocol("ERROR", fmt.Sprintf("创建错误消息失败: %v", cerr))
+		return
+	}
+	if err := c.sendBinaryData(data); err != nil {
+		c.log("WARNING", fmt.Sprintf("发送错误消息失败: %v", err))
+	}
+}
+
+// handlePeerError 处理客户端回复的错误消息
+func (s *Server) handlePeerError(client *Client, msg *protocol.BinaryMessage) {
+	peerErr, err := newPeerError(s.displayName(client), msg)
+	if err != nil {
+		s.logProtocol("ERROR", fmt.Sprintf("解析错误消息失败: %v", err))
+		return
+	}
+	if peerErr.Code == protocol.ErrorCodeCancelled {
+		s.abortPending(client, peerErr.MsgID)
+		return
+	}
+	s.log("WARNING", fmt.Sprintf("客户端 %s 拒绝了消息 #%d: %s", peerErr.Peer, peerErr.MsgID, describePeerError(peerErr)))
+
+	s.mu.RLock()
+	cb := s.peerErrorCb
+	s.mu.RUnlock()
+	if cb != nil {
+		cb(peerErr)
+	}
+}
+
+// handlePeerError 处理服务器（或经中继转发的其他成员）回复的错误消息
+func (c *WSClient) handlePeerError(msg *protocol.BinaryMessage) {
+	peerErr, err := newPeerError(c.peerName(), msg)
+	if err != nil {
+		c.logProtocol("ERROR", fmt.Sprintf("解析错误消息失败: %v", err))
+		return
+	}
+	if peerErr.Code == protocol.ErrorCodeCancelled {
+		c.abortPending(peerErr.MsgID)
+		return
+	}
+
+	// 经中继转发时房间内所有成员都会收到错误消息，只处理针对本机发出的消息的
+	c.mu.RLock()
+	mine := c.sent.contains(peerErr.target, peerErr.hasTarget)
+	c.mu.RUnlock()
+	if !mine {
+		c.logProtocol("INFO", fmt.Sprintf("忽略不是针对本机消息的错误消息 #%d: %s", peerErr.MsgID, peerErr.Code))
+		return
+	}
+	c.log("ERROR", fmt.Sprintf("服务器拒绝了消息 #%d: %s", peerErr.MsgID, describePeerError(peerErr)))
+
+	c.mu.RLock()
+	cb := c.peerErrorCb
+	c.mu.RUnlock()
+	if cb != nil {
+		cb(peerErr)
+	}
+}
+
+// abortPending 客户端取消了正在发送的条目：丢弃已收到的分片
+func (s *Server) abortPending(client *Client, msgID uint32) {
+	client.mu.Lock()
+	aborted := client.pending != nil && client.PendingMsgID == msgID
+	if aborted {
+		client.resetPending(TransferCancelled)
+	}
+	client.mu.Unlock()
+	if aborted {
+		s.log("INFO", fmt.Sprintf("客户端 %s 取消了消息 #%d 的发送，丢弃已收到的数据", s.displayName(client), msgID))
+	}
+}
+
+// abortPending 服务器取消了正在发送的条目：丢弃已收到的分片
+func (c *WSClient) abortPending(msgID uint32) {
+	c.mu.Lock()
+	aborted := c.pending != nil && c.PendingMsgID == msgID
+	if aborted {
+		c.resetPending(TransferCancelled)
+	}
+	c.mu.Unlock()
+	if aborted {
+		c.log("INFO", fmt.Sprintf("服务器取消了消息 #%d 的发送，丢弃已收到的数据", msgID))
+	}
+}
+
+// describePeerError 错误的中文说明
+func describePeerError(e PeerError) string {
+	var text string
+	switch e.Code {
+	case protocol.ErrorCodeTooLarge:
+		text = "数据过大"
+	case protocol.ErrorCodeBufferFull:
+		text = "对方接收缓冲区已满，请稍后重试"
+	case protocol.ErrorCodeUnsupportedType:
+		text = "不支持的消息类型"
+	case protocol.ErrorCodeBadMeta:
+		text = "元数据无效"
+	case protocol.ErrorCodeNotHandshaken:
+		text = "尚未完成握手"
+	case protocol.ErrorCodeBadHandshake:
+		text = "握手消息无效"
+	case protocol.ErrorCodeCorrupt:
+		text = "数据校验失败，传输中可能损坏"
+	case protocol.ErrorCodeCancelled:
+		text = "发送方取消了传输"
+	default:
+		text = e.Code
+	}
+	if e.Reason != "" {
+		text += "（" + e.Reason + "）"
+	}
+	return text
+}
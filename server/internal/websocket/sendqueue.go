@@ -0,0 +1,217 @@
+package websocket
+
+import (
+	"fmt"
+	"time"
+
+	"server/internal/protocol"
+
+	"github.com/gorilla/websocket"
+)
+
+// ==========================================
+// 发送队列与慢速客户端
+// ==========================================
+//
+// 服务器端每个客户端的发送队列以条目为单位：一个剪贴板条目的全部分片
+// 一起入队，writePump 取出后连续写出，因此不会出现只发出部分分片的情况。
+// 队列已满（客户端接收过慢）时按慢速客户端策略处理：
+//   - drop：丢弃新条目
+//   - latest：丢弃队列中尚未开始发送的条目，只保留最新的条目
+//   - disconnect：丢弃新条目；持续积压超过 slowConsumerTimeout 时断开客户端，
+//     积压开始时启动计时器，之后即使没有新条目也会按时检查
+
+// 慢速客户端策略
+const (
+	SlowConsumerDrop       = "drop"
+	SlowConsumerLatest     = "latest"
+	SlowConsumerDisconnect = "disconnect"
+)
+
+// sendQueueSize 每个客户端发送队列可容纳的条目数
+const sendQueueSize = 32
+
+// slowConsumerTimeout disconnect 策略下允许持续积压的最长时间（测试中可缩短）
+var slowConsumerTimeout = 10 * time.Second
+
+// ValidSlowConsumerPolicy 是否为已知的慢速客户端策略
+func ValidSlowConsumerPolicy(policy string) bool {
+	switch policy {
+	case SlowConsumerDrop, SlowConsumerLatest, SlowConsumerDisconnect:
+		return true
+	}
+	return false
+}
+
+// outFrame 条目中的一帧
+type outFrame struct {
+	data  []byte
+	bytes int // 该帧携带的数据字节数，用于累加传输进度
+}
+
+// outItem 发送队列中的一个条目：剪贴板内容的全部分片，或一条控制消息
+type outItem struct {
+	frames   []outFrame
+	dataType string // 剪贴板内容的类型，控制消息为空
+	mime     string
+	size     int // 条目大小，全部分片写出后计入统计
+}
+
+// enqueueControl 非阻塞地放入控制消息（如心跳回复），队列已满时返回 false
+func (c *Client) enqueueControl(data []byte) bool {
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+
+	select {
+	case c.send <- outItem{frames: []outFrame{{data: data}}}:
+		return true
+	default:
+		return false
+	}
+}
+
+// deliver 按慢速客户端策略把条目放入客户端的发送队列
+// 只有持有 sendMu 的一方会写入队列，writePump 只会腾出空间，因此检查与写入之间队列不会被占满
+func (s *Server) deliver(client *Client, item outItem, policy string) {
+	client.sendMu.Lock()
+	defer client.sendMu.Unlock()
+
+	select {
+	case client.send <- item:
+		client.clearBacklog()
+		return
+	default:
+	}
+
+	if policy == SlowConsumerLatest {
+		s.coalesce(client, item)
+		return
+	}
+
+	client.stats.recordDropped(1)
+	now := time.Now()
+	if client.backedUpSince.IsZero() {
+		client.backedUpSince = now
+		if policy == SlowConsumerDisconnect {
+			client.backedUpTimer = time.AfterFunc(slowConsumerTimeout, func() { s.checkBacklog(client) })
+		}
+	}
+	if policy == SlowConsumerDisconnect && now.Sub(client.backedUpSince) >= slowConsumerTimeout {
+		s.disconnectSlow(client, now.Sub(client.backedUpSince))
+		return
+	}
+	s.log("WARNING", fmt.Sprintf("客户端 %s 发送队列已满，丢弃 %s 条目", client.ID, item.dataType))
+}
+
+// checkBacklog 积压计时器到期：队列仍然是满的则断开客户端，已经腾出空间则视为积压结束
+func (s *Server) checkBacklog(client *Client) {
+	s.mu.RLock()
+	policy := s.slowConsumer
+	s.mu.RUnlock()
+
+	client.sendMu.Lock()
+	defer client.sendMu.Unlock()
+
+	if client.backedUpSince.IsZero() {
+		return
+	}
+	if policy != SlowConsumerDisconnect || len(client.send) < cap(client.send) {
+		client.clearBacklog()
+		return
+	}
+	s.disconnectSlow(client, time.Since(client.backedUpSince))
+}
+
+// disconnectSlow 断开持续积压的客户端（调用方需持有 client.sendMu）
+func (s *Server) disconnectSlow(client *Client, backlog time.Duration) {
+	s.log("WARNING", fmt.Sprintf("客户端 %s 持续 %v 接收过慢，断开连接", client.ID, backlog.Round(time.Second)))
+	client.stats.recordSlowDisconnect()
+	client.requestClose(websocket.CloseTryAgainLater, "slow consumer")
+}
+
+// clearBacklog 标记积压结束并停止积压计时器（调用方需持有 sendMu）
+func (c *Client) clearBacklog() {
+	c.backedUpSince = time.Time{}
+	if c.backedUpTimer != nil {
+		c.backedUpTimer.Stop()
+		c.backedUpTimer = nil
+	}
+}
+
+// coalesce 丢弃队列中尚未开始发送的剪贴板条目（保留控制消息），再放入最新条目（调用方需持有 client.sendMu）
+func (s *Server) coalesce(client *Client, item outItem) {
+	var control []outItem
+	discarded := 0
+drain:
+	for {
+		select {
+		case queued := <-client.send:
+			if queued.dataType == "" {
+				control = append(control, queued)
+			} else {
+				discarded++
+			}
+		default:
+			break drain
+		}
+	}
+	for _, queued := range control {
+		client.send <- queued
+	}
+
+	select {
+	case client.send <- item:
+		client.clearBacklog()
+	default:
+		// 队列中全是控制消息，只能丢弃新条目
+		discarded++
+	}
+	client.stats.recordCoalesced(discarded)
+	s.log("WARNING", fmt.Sprintf("客户端 %s 接收过慢，丢弃 %d 个未发送的条目，只保留最新条目", client.ID, discarded))
+}
+
+// writeItem 连续写出条目的全部分片（V1.1: 使用二进制帧发送）
+// 多分片条目登记为传输并更新进度；传输被取消时跳过剩余分片，
+// 已经发出部分分片的还要发送取消消息，让客户端丢弃已收到的数据
+func (s *Server) writeItem(client *Client, item outItem) error {
+	var transfer *Transfer
+	if len(item.frames) > 1 {
+		client.mu.RLock()
+		peer := client.peerName()
+		client.mu.RUnlock()
+		transfer = s.transfers.Begin(TransferSend, peer, item.dataType, item.mime, int64(item.size))
+	}
+
+	for i, frame := range item.frames {
+		if transfer.Cancelled() {
+			transfer.Finish(TransferCancelled)
+			if i == 0 {
+				return nil
+			}
+			return s.writeAbort(client, item.frames[0].data)
+		}
+		client.Conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+		if err := client.Conn.WriteMessage(websocket.BinaryMessage, frame.data); err != nil {
+			transfer.Finish(TransferFailed)
+			return err
+		}
+		transfer.Add(frame.bytes)
+	}
+
+	transfer.Finish(TransferCompleted)
+	if item.dataType != "" {
+		client.stats.recordSent(item.dataType, item.size)
+	}
+	return nil
+}
+
+// writeAbort 告知客户端已发出部分分片的条目被取消（在 writePump 中调用）
+func (s *Server) writeAbort(client *Client, firstFrame []byte) error {
+	origin, _ := protocol.HeaderOrigin(firstFrame)
+	data, err := s.protocolMgr.CreateError(protocol.ErrorCodeCancelled, origin, "")
+	if err != nil {
+		return err
+	}
+	client.Conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	return client.Conn.WriteMessage(websocket.BinaryMessage, data)
+}
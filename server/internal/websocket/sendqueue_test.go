@@ -0,0 +1,60 @@
+package websocket
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// newQueuedClient 只有发送队列的客户端，用于测试入队策略
+func newQueuedClient(size int) *Client {
+	return &Client{
+		ID:      "slow",
+		send:    make(chan outItem, size),
+		stats:   NewStats(),
+		closing: make(chan []byte, 1),
+		done:    make(chan struct{}),
+	}
+}
+
+func TestDisconnectPolicyClosesIdleBackloggedClient(t *testing.T) {
+	timeout := slowConsumerTimeout
+	slowConsumerTimeout = 50 * time.Millisecond
+	t.Cleanup(func() { slowConsumerTimeout = timeout })
+
+	s := NewServer()
+	if err := s.SetSlowConsumerPolicy(SlowConsumerDisconnect); err != nil {
+		t.Fatal(err)
+	}
+	item := outItem{dataType: "text", frames: []outFrame{{data: []byte("x")}}}
+
+	// 队列占满后不再有新条目：计时器到期时仍应断开
+	client := newQueuedClient(1)
+	s.deliver(client, item, SlowConsumerDisconnect)
+	s.deliver(client, item, SlowConsumerDisconnect)
+	select {
+	case msg := <-client.closing:
+		if want := websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "slow consumer"); string(msg) != string(want) {
+			t.Fatalf("Close 帧 = %q，期望 %q", msg, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("积压的客户端没有在没有新条目时被断开")
+	}
+
+	// 计时器到期前队列已经腾出空间：积压结束，不断开
+	client = newQueuedClient(1)
+	s.deliver(client, item, SlowConsumerDisconnect)
+	s.deliver(client, item, SlowConsumerDisconnect)
+	<-client.send
+	select {
+	case <-client.closing:
+		t.Fatalf("队列已腾出空间的客户端被断开")
+	case <-time.After(150 * time.Millisecond):
+	}
+	client.sendMu.Lock()
+	defer client.sendMu.Unlock()
+	if !client.backedUpSince.IsZero() {
+		t.Errorf("队列腾出空间后仍标记为积压")
+	}
+}
@@ -3,11 +3,16 @@ package websocket
 import (
 	"context"
 	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"log"
 	"net"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -17,11 +22,29 @@ import (
 	"github.com/gorilla/websocket"
 )
 
-var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool {
-		return true // 允许所有来源
-	},
-}
+// readTimeout 服务器等待客户端消息的最长时间
+// 收到任何消息或 Pong 都会延长期限。服务器每 pingInterval 发送一次 Ping，客户端（含不发送
+// 应用层心跳的旧客户端）回复的 Pong 即可保持连接，因此客户端心跳间隔（默认 15 秒，
+// 可在设置中调整）不受此值限制
+const readTimeout = 60 * time.Second
+
+// pingInterval 服务器发送 WebSocket Ping 的间隔，须小于 readTimeout
+const pingInterval = 30 * time.Second
+
+// DefaultHandshakeTimeout 新连接完成握手的默认期限
+const DefaultHandshakeTimeout = 10 * time.Second
+
+// clientState 客户端连接状态
+// 新连接处于 clientPending，只接受握手与心跳；收到有效握手后进入 clientReady，
+// 开始收发剪贴板内容；握手时发现设备已被屏蔽则进入 clientBlocked，等待连接关闭。
+// 超过握手期限仍未握手的连接会被关闭。
+type clientState int
+
+const (
+	clientPending clientState = iota
+	clientReady
+	clientBlocked
+)
 
 // Client 表示一个 WebSocket 客户端
 type Client struct {
@@ -30,13 +53,103 @@ type Client struct {
 	DeviceName string
 	Platform   string
 	ConnTime   time.Time
-	Send       chan []byte
+	send       chan outItem
 	mu         sync.RWMutex
 
+	// 握手中的设备详情（旧版本客户端不发送，为空）
+	DeviceID    string // 发送者 UUID（十六进制），即对端的设备身份
+	Arch        string
+	OSVersion   string
+	AppVersion  string
+	DeviceClass string
+	// state 连接状态，见 clientState
+	state clientState
+
+	// stats 该连接的同步统计，同时累加到服务器统计
+	stats *Stats
+
 	// 分片重组缓冲区
-	PendingMsgID  uint32
-	PendingBuffer []byte
-	PendingMeta   *protocol.TransferMeta
+	PendingMsgID    uint32
+	PendingMeta     *protocol.TransferMeta
+	PendingTransfer *Transfer   // 多分片接收的进度，单帧条目为 nil
+	pending         *reassembly // 正在重组的条目，没有时为 nil
+
+	// sendMu 保证条目整体入队；backedUpSince 发送队列开始持续积压的时间，未积压时为零值
+	// backedUpTimer disconnect 策略下积压开始时启动，没有新条目入队也能按时断开
+	sendMu        sync.Mutex
+	backedUpSince time.Time
+	backedUpTimer *time.Timer
+
+	// closing 关闭请求（Close 帧内容），由 writePump 发送
+	closing   chan []byte
+	closeOnce sync.Once
+	// done readPump 退出时关闭
+	done chan struct{}
+}
+
+// requestClose 请求 writePump 发送完队列中的消息后发送 Close 帧
+func (c *Client) requestClose(code int, reason string) {
+	c.closeOnce.Do(func() {
+		c.closing <- websocket.FormatCloseMessage(code, reason)
+	})
+}
+
+// isReady 是否已完成握手（可以收发剪贴板内容）
+func (c *Client) isReady() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.state == clientReady
+}
+
+// isReceiving 是否正在接收该客户端的分片数据
+func (c *Client) isReceiving() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.pending != nil
+}
+
+// peerName 传输进度中显示的对端名称：握手前使用连接 ID（调用方需持有 c.mu）
+func (c *Client) peerName() string {
+	if c.DeviceName != "" {
+		return c.DeviceName
+	}
+	return c.ID
+}
+
+// resetPending 丢弃分片重组缓冲区，未完成的接收记为 state（调用方需持有 c.mu）
+func (c *Client) resetPending(state string) {
+	c.PendingTransfer.Finish(state)
+	c.pending.discard()
+	c.pending = nil
+	c.PendingMeta = nil
+	c.PendingTransfer = nil
+}
+
+// 服务器主动断开客户端时使用的 Close 帧状态码（4000-4999 为应用自定义范围）
+// 客户端收到后不再自动重连
+const (
+	CloseKicked  = 4001 // 被服务器断开
+	CloseBlocked = 4003 // 设备已被服务器屏蔽
+)
+
+// ReconnectHintPrefix Close 帧 reason 中的重连提示前缀，如 "reconnect-after=5"（秒）
+const ReconnectHintPrefix = "reconnect-after="
+
+// reconnectHint 生成 Close 帧中的重连提示
+func reconnectHint(d time.Duration) string {
+	return fmt.Sprintf("%s%d", ReconnectHintPrefix, int(d.Round(time.Second)/time.Second))
+}
+
+// parseReconnectHint 从 Close 帧 reason 中解析重连提示
+func parseReconnectHint(reason string) (time.Duration, bool) {
+	if !strings.HasPrefix(reason, ReconnectHintPrefix) {
+		return 0, false
+	}
+	seconds, err := strconv.Atoi(strings.TrimPrefix(reason, ReconnectHintPrefix))
+	if err != nil || seconds < 0 {
+		return 0, false
+	}
+	return time.Duration(seconds) * time.Second, true
 }
 
 // LogCallback 日志回调函数
@@ -45,31 +158,235 @@ type LogCallback func(level, message string)
 // BinaryClipboardCallback 剪贴板数据回调函数（V1.1 二进制协议）
 // dataType: "text" 或 "image"
 // content: 文本字符串或图片二进制数据（不再是 Base64）
-type BinaryClipboardCallback func(dataType string, content []byte)
+// origin: 条目的原始来源（发送者 UUID + 消息 ID），转发时需保持不变
+type BinaryClipboardCallback func(dataType string, content []byte, origin protocol.Origin)
 
 // Server WebSocket 服务器（V1.1 二进制协议版本）
 type Server struct {
 	address           string
 	port              int
 	server            *http.Server
+	listener          net.Listener
 	clients           map[string]*Client
 	mu                sync.RWMutex
 	ctx               context.Context
 	cancel            context.CancelFunc
 	isRunning         bool
+	startedAt         time.Time
+	draining          bool
+	drainTimeout      time.Duration       // 停止时等待进行中传输完成的最长时间
+	reconnectAfter    time.Duration       // 停止时建议客户端的重连等待时间
+	allowedOrigins    []string            // 允许的浏览器来源，为空时拒绝所有浏览器来源
+	handshakeTimeout  time.Duration       // 新连接完成握手的期限
+	device            protocol.DeviceInfo // 握手回复中的本机设备信息
+	slowConsumer      string              // 慢速客户端策略，见 SlowConsumerDrop 等
+	limits            Limits              // 接收限制
+	buffered          bufferBudget        // 所有客户端正在内存中重组的数据
+	spilled           bufferBudget        // 所有客户端正在临时文件中重组的数据
+	blockedDevices    map[string]bool     // 已屏蔽的设备 UUID（十六进制），握手时拒绝
+	deviceAliases     map[string]string   // 设备 UUID（十六进制）→ 服务器端别名
+	upgrader          websocket.Upgrader
 	logCb             LogCallback
+	protocolLogCb     LogCallback // 协议层日志（解析失败、未知消息等），为空时使用 logCb
 	clipboardCallback BinaryClipboardCallback
+	peerErrorCb       PeerErrorCallback
+	transfers         *TransferTracker // 分片传输进度，为空时不记录
+	stats             *Stats           // 所有客户端的同步统计（含已断开的客户端）
 
 	// V1.1 二进制协议管理器
 	protocolMgr *protocol.BinaryProtocolManager
+	// seen 近期处理过的条目来源，同一条目经不同路径到达时只处理一次
+	seen *protocol.SeenCache
 }
 
-// NewServer 创建 WebSocket 服务器
+// NewServer 创建 WebSocket 服务器，使用本机设备 UUID
 func NewServer() *Server {
-	return &Server{
-		clients:     make(map[string]*Client),
-		protocolMgr: protocol.NewBinaryProtocolManager(),
+	return NewServerWithUUID(protocol.DeviceUUID())
+}
+
+// NewServerWithUUID 创建以指定设备 UUID 收发消息的 WebSocket 服务器
+func NewServerWithUUID(deviceUUID [16]byte) *Server {
+	s := &Server{
+		clients:          make(map[string]*Client),
+		blockedDevices:   make(map[string]bool),
+		deviceAliases:    make(map[string]string),
+		drainTimeout:     10 * time.Second,
+		reconnectAfter:   5 * time.Second,
+		handshakeTimeout: DefaultHandshakeTimeout,
+		slowConsumer:     SlowConsumerDrop,
+		limits:           DefaultLimits(),
+		protocolMgr:      protocol.NewBinaryProtocolManagerWithUUID(deviceUUID),
+		seen:             protocol.NewSeenCache(10*time.Minute, 4096),
+		stats:            NewStats(),
+	}
+	s.upgrader = websocket.Upgrader{
+		// 来源已在 handleWebSocket 中校验，这里再次检查以防遗漏
+		CheckOrigin: func(r *http.Request) bool {
+			return originAllowed(r, s.AllowedOrigins())
+		},
+	}
+	return s
+}
+
+// SetAllowedOrigins 设置允许连接的浏览器来源
+// 不带 Origin 头的客户端（桌面端、鸿蒙端）始终允许；为空时拒绝所有浏览器来源
+func (s *Server) SetAllowedOrigins(origins []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.allowedOrigins = append([]string(nil), origins...)
+}
+
+// AllowedOrigins 获取允许连接的浏览器来源
+func (s *Server) AllowedOrigins() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]string(nil), s.allowedOrigins...)
+}
+
+// NormalizeDeviceID 把设备 UUID（标准格式或 32 位十六进制）转换为握手中记录的十六进制形式
+func NormalizeDeviceID(id string) (string, error) {
+	u, err := uuid.Parse(strings.TrimSpace(id))
+	if err != nil {
+		return "", fmt.Errorf("设备 UUID 无效: %s", id)
 	}
+	return hex.EncodeToString(u[:]), nil
+}
+
+// SetBlockedDevices 设置已屏蔽的设备，已连接的被屏蔽设备立即断开
+func (s *Server) SetBlockedDevices(ids []string) error {
+	blocked := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		normalized, err := NormalizeDeviceID(id)
+		if err != nil {
+			return err
+		}
+		blocked[normalized] = true
+	}
+
+	s.mu.Lock()
+	s.blockedDevices = blocked
+	clients := make([]*Client, 0)
+	for _, client := range s.clients {
+		client.mu.Lock()
+		if client.DeviceID != "" && blocked[client.DeviceID] && client.state != clientBlocked {
+			client.state = clientBlocked
+			clients = append(clients, client)
+		}
+		client.mu.Unlock()
+	}
+	s.mu.Unlock()
+
+	for _, client := range clients {
+		s.log("WARNING", fmt.Sprintf("断开已屏蔽的设备: %s", s.displayName(client)))
+		client.requestClose(CloseBlocked, "")
+	}
+	return nil
+}
+
+// isBlocked 设备是否已被屏蔽
+func (s *Server) isBlocked(deviceID string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.blockedDevices[deviceID]
+}
+
+// SetDeviceAliases 设置设备别名（设备 UUID → 别名），仅在本机显示
+func (s *Server) SetDeviceAliases(aliases map[string]string) error {
+	normalized := make(map[string]string, len(aliases))
+	for id, alias := range aliases {
+		key, err := NormalizeDeviceID(id)
+		if err != nil {
+			return err
+		}
+		normalized[key] = alias
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deviceAliases = normalized
+	return nil
+}
+
+// displayName 客户端的显示名称：别名 > 握手中的设备名称 > 连接 ID
+func (s *Server) displayName(client *Client) string {
+	client.mu.RLock()
+	deviceID := client.DeviceID
+	name := client.peerName()
+	client.mu.RUnlock()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if alias := s.deviceAliases[deviceID]; alias != "" {
+		return alias
+	}
+	return name
+}
+
+// KickClient 断开指定客户端，reason 随 Close 帧发送给客户端（可为空）
+// 客户端收到后不再自动重连
+func (s *Server) KickClient(id, reason string) error {
+	s.mu.RLock()
+	client, ok := s.clients[id]
+	s.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("客户端不存在: %s", id)
+	}
+
+	s.log("INFO", fmt.Sprintf("断开客户端: %s", s.displayName(client)))
+	client.requestClose(CloseKicked, reason)
+	return nil
+}
+
+// SetHandshakeTimeout 设置新连接完成握手的期限，对之后建立的连接生效
+func (s *Server) SetHandshakeTimeout(timeout time.Duration) {
+	if timeout <= 0 {
+		timeout = DefaultHandshakeTimeout
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handshakeTimeout = timeout
+}
+
+// SetDevice 设置握手回复中的本机设备信息
+func (s *Server) SetDevice(device protocol.DeviceInfo) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.device = device
+}
+
+// SetSlowConsumerPolicy 设置客户端发送队列已满时的处理策略
+func (s *Server) SetSlowConsumerPolicy(policy string) error {
+	if !ValidSlowConsumerPolicy(policy) {
+		return fmt.Errorf("未知的慢速客户端策略: %s", policy)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.slowConsumer = policy
+	return nil
+}
+
+// SetLimits 设置接收限制，单帧上限对之后建立的连接生效
+func (s *Server) SetLimits(limits Limits) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.limits = limits
+}
+
+// Limits 获取接收限制
+func (s *Server) Limits() Limits {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.limits
+}
+
+// SetDrainOptions 设置优雅停止参数
+// drainTimeout: 等待进行中传输完成的最长时间
+// reconnectAfter: 通过 Close 帧提示客户端多久后重连
+func (s *Server) SetDrainOptions(drainTimeout, reconnectAfter time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.drainTimeout = drainTimeout
+	s.reconnectAfter = reconnectAfter
 }
 
 // SetClipboardCallback 设置剪贴板数据回调（V1.1）
@@ -79,17 +396,47 @@ func (s *Server) SetClipboardCallback(cb BinaryClipboardCallback) {
 	s.clipboardCallback = cb
 }
 
+// SetPeerErrorCallback 设置收到客户端错误消息的回调
+func (s *Server) SetPeerErrorCallback(cb PeerErrorCallback) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.peerErrorCb = cb
+}
+
+// SetTransferTracker 设置分片传输进度记录器，需在 Start 之前调用
+func (s *Server) SetTransferTracker(t *TransferTracker) {
+	s.transfers = t
+}
+
 // Start 启动服务器
 func (s *Server) Start(address string, port int, logCb LogCallback) error {
+	if s.IsRunning() {
+		return fmt.Errorf("server is already running")
+	}
+
+	ln, err := net.Listen("tcp", net.JoinHostPort(address, strconv.Itoa(port)))
+	if err != nil {
+		return fmt.Errorf("监听 %s:%d 失败: %w", address, port, err)
+	}
+	return s.StartListener(ln, logCb)
+}
+
+// StartListener 在已创建的监听器上启动服务器（如监听随机端口），Stop 时关闭监听器
+func (s *Server) StartListener(ln net.Listener, logCb LogCallback) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	if s.isRunning {
+		ln.Close()
 		return fmt.Errorf("server is already running")
 	}
 
-	s.address = address
-	s.port = port
+	addr := ln.Addr().String()
+	if host, port, err := net.SplitHostPort(addr); err == nil {
+		s.address = host
+		s.port, _ = strconv.Atoi(port)
+	}
+	s.listener = ln
 	s.logCb = logCb
 	s.ctx, s.cancel = context.WithCancel(context.Background())
 
@@ -97,15 +444,17 @@ func (s *Server) Start(address string, port int, logCb LogCallback) error {
 	mux.HandleFunc("/ws", s.handleWebSocket)
 
 	s.server = &http.Server{
-		Addr:    fmt.Sprintf("%s:%d", address, port),
+		Addr:    addr,
 		Handler: mux,
 	}
 
 	s.isRunning = true
+	s.startedAt = time.Now()
 
+	server := s.server
 	go func() {
-		s.log("INFO", fmt.Sprintf("WebSocket 服务器启动在 %s:%d (V1.1 二进制协议)", address, port))
-		if err := s.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		s.log("INFO", fmt.Sprintf("WebSocket 服务器启动在 %s (V1.1 二进制协议)", addr))
+		if err := server.Serve(ln); err != nil && err != http.ErrServerClosed {
 			s.log("ERROR", fmt.Sprintf("服务器错误: %v", err))
 		}
 	}()
@@ -113,42 +462,119 @@ func (s *Server) Start(address string, port int, logCb LogCallback) error {
 	return nil
 }
 
-// Stop 停止服务器
+// Addr 服务器实际监听的地址，未运行时为 nil
+func (s *Server) Addr() net.Addr {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if !s.isRunning || s.listener == nil {
+		return nil
+	}
+	return s.listener.Addr()
+}
+
+// Stop 优雅停止服务器
+// 先拒绝新连接并等待进行中的分片传输完成，再向客户端发送带重连提示的
+// "going away" Close 帧，最后关闭 HTTP 服务器
 func (s *Server) Stop() error {
 	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	if !s.isRunning {
+	if !s.isRunning || s.draining {
+		s.mu.Unlock()
 		return nil
 	}
+	s.draining = true
+	drainTimeout := s.drainTimeout
+	reconnectAfter := s.reconnectAfter
+	s.mu.Unlock()
+
+	deadline := time.Now().Add(drainTimeout)
+
+	// 等待进行中的传输完成
+	if s.countReceiving() > 0 {
+		s.log("INFO", "正在等待进行中的传输完成...")
+		s.waitUntil(deadline, func() bool { return s.countReceiving() == 0 })
+	}
+
+	// 通知客户端服务器即将关闭
+	reason := reconnectHint(reconnectAfter)
+	s.mu.RLock()
+	for _, client := range s.clients {
+		client.requestClose(websocket.CloseGoingAway, reason)
+	}
+	s.mu.RUnlock()
+	s.waitUntil(deadline, func() bool { return s.GetClientCount() == 0 })
 
 	if s.cancel != nil {
 		s.cancel()
 	}
 
-	// 关闭所有客户端连接
+	// 强制关闭剩余的客户端连接
+	s.mu.Lock()
 	for _, client := range s.clients {
 		client.Conn.Close()
-		close(client.Send)
 	}
 	s.clients = make(map[string]*Client)
+	s.mu.Unlock()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	if err := s.server.Shutdown(ctx); err != nil {
+	err := s.server.Shutdown(ctx)
+
+	s.mu.Lock()
+	s.isRunning = false
+	s.draining = false
+	s.mu.Unlock()
+
+	if err != nil {
 		s.log("ERROR", fmt.Sprintf("关闭服务器失败: %v", err))
 		return err
 	}
 
-	s.isRunning = false
 	s.log("INFO", "WebSocket 服务器已停止")
 	return nil
 }
 
+// countReceiving 统计正在发送分片数据的客户端数量
+func (s *Server) countReceiving() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	count := 0
+	for _, client := range s.clients {
+		if client.isReceiving() {
+			count++
+		}
+	}
+	return count
+}
+
+// waitUntil 轮询等待条件满足或到达截止时间
+func (s *Server) waitUntil(deadline time.Time, cond func() bool) {
+	for !cond() && time.Now().Before(deadline) {
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
 // handleWebSocket 处理 WebSocket 连接
 func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
-	conn, err := upgrader.Upgrade(w, r, nil)
+	// 正在停止：拒绝新连接，并提示客户端稍后重连
+	s.mu.RLock()
+	draining := s.draining
+	reconnectAfter := s.reconnectAfter
+	s.mu.RUnlock()
+	if draining {
+		w.Header().Set("Retry-After", strconv.Itoa(int(reconnectAfter/time.Second)))
+		http.Error(w, "Server is shutting down", http.StatusServiceUnavailable)
+		return
+	}
+
+	if !originAllowed(r, s.AllowedOrigins()) {
+		s.log("WARNING", fmt.Sprintf("拒绝来源不被允许的连接: %s (Origin: %s)", r.RemoteAddr, r.Header.Get("Origin")))
+		http.Error(w, "Origin not allowed", http.StatusForbidden)
+		return
+	}
+
+	conn, err := s.upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		s.log("ERROR", fmt.Sprintf("WebSocket 升级失败: %v", err))
 		return
@@ -158,11 +584,17 @@ func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 		ID:       uuid.New().String(),
 		Conn:     conn,
 		ConnTime: time.Now(),
-		Send:     make(chan []byte, 256),
+		send:     make(chan outItem, sendQueueSize),
+		stats:    NewStats(),
+		closing:  make(chan []byte, 1),
+		done:     make(chan struct{}),
 	}
 
+	client.stats.SetParent(s.stats)
+
 	s.mu.Lock()
 	s.clients[client.ID] = client
+	handshakeTimeout := s.handshakeTimeout
 	s.mu.Unlock()
 
 	s.log("INFO", fmt.Sprintf("新客户端连接: %s (来自 %s)", client.ID, r.RemoteAddr))
@@ -170,25 +602,60 @@ func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 	// 启动读写协程
 	go s.readPump(client)
 	go s.writePump(client)
+	go s.awaitHandshake(client, handshakeTimeout)
+}
+
+// awaitHandshake 等待客户端在期限内完成握手，超时则关闭连接
+func (s *Server) awaitHandshake(client *Client, timeout time.Duration) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-client.done:
+		return
+	}
+
+	client.mu.RLock()
+	pending := client.state == clientPending
+	client.mu.RUnlock()
+	if pending {
+		s.log("WARNING", fmt.Sprintf("客户端 %s 未在 %v 内完成握手，关闭连接", client.ID, timeout))
+		client.requestClose(websocket.ClosePolicyViolation, "handshake timeout")
+	}
 }
 
 // readPump 读取客户端消息（V1.1 二进制协议）
 func (s *Server) readPump(client *Client) {
 	defer func() {
+		close(client.done)
 		s.removeClient(client)
 		client.Conn.Close()
 	}()
 
-	client.Conn.SetReadDeadline(time.Now().Add(60 * time.Second))
-	client.Conn.SetPongHandler(func(string) error {
-		client.Conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+	// WebSocket Pong 帧带回 Ping 中的纳秒时间戳
+	client.Conn.SetPongHandler(func(appData string) error {
+		client.Conn.SetReadDeadline(time.Now().Add(readTimeout))
+		if len(appData) == 8 {
+			sent := int64(binary.BigEndian.Uint64([]byte(appData)))
+			client.stats.recordLatency(time.Since(time.Unix(0, sent)))
+		}
 		return nil
 	})
 
+	// 超过单帧上限时 gorilla/websocket 以 1009 关闭连接
+	maxFrameSize := s.Limits().MaxFrameSize
+	client.Conn.SetReadLimit(maxFrameSize)
+
 	for {
+		// 收到任何消息（含心跳）都会延长读取超时，对端静默超过 readTimeout 视为断线
+		client.Conn.SetReadDeadline(time.Now().Add(readTimeout))
 		messageType, message, err := client.Conn.ReadMessage()
 		if err != nil {
-			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+			if errors.Is(err, websocket.ErrReadLimit) {
+				s.log("WARNING", fmt.Sprintf("客户端 %s 发送的消息超过单帧上限 %d 字节，断开连接", client.ID, maxFrameSize))
+			}
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure, websocket.ClosePolicyViolation, websocket.CloseTryAgainLater, CloseKicked, CloseBlocked) {
 				s.log("ERROR", fmt.Sprintf("客户端 %s 异常断开: %v", client.ID, err))
 			}
 			break
@@ -196,7 +663,7 @@ func (s *Server) readPump(client *Client) {
 
 		// V1.1 二进制协议：只处理二进制消息
 		if messageType != websocket.BinaryMessage {
-			s.log("WARNING", "收到非二进制消息，不兼容的协议版本")
+			s.logProtocol("WARNING", "收到非二进制消息，不兼容的协议版本")
 			continue
 		}
 
@@ -206,7 +673,7 @@ func (s *Server) readPump(client *Client) {
 
 // writePump 向客户端发送消息（V1.1 二进制协议）
 func (s *Server) writePump(client *Client) {
-	ticker := time.NewTicker(30 * time.Second)
+	ticker := time.NewTicker(pingInterval)
 	defer func() {
 		ticker.Stop()
 		client.Conn.Close()
@@ -214,23 +681,44 @@ func (s *Server) writePump(client *Client) {
 
 	for {
 		select {
-		case message, ok := <-client.Send:
-			client.Conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
-			if !ok {
-				client.Conn.WriteMessage(websocket.CloseMessage, []byte{})
+		case item := <-client.send:
+			if err := s.writeItem(client, item); err != nil {
 				return
 			}
 
-			// V1.1: 使用二进制帧发送
-			if err := client.Conn.WriteMessage(websocket.BinaryMessage, message); err != nil {
+		case <-ticker.C:
+			now := time.Now()
+			ping := binary.BigEndian.AppendUint64(nil, uint64(now.UnixNano()))
+			client.Conn.SetWriteDeadline(now.Add(10 * time.Second))
+			if err := client.Conn.WriteMessage(websocket.PingMessage, ping); err != nil {
 				return
 			}
 
-		case <-ticker.C:
+		case closeMsg := <-client.closing:
+			// 先把队列中已有的消息发完，再发送 Close 帧
+			for {
+				select {
+				case item := <-client.send:
+					if err := s.writeItem(client, item); err != nil {
+						return
+					}
+					continue
+				default:
+				}
+				break
+			}
 			client.Conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
-			if err := client.Conn.WriteMessage(websocket.PingMessage, nil); err != nil {
-				return
+			client.Conn.WriteMessage(websocket.CloseMessage, closeMsg)
+
+			// 等待客户端回应 Close 帧
+			select {
+			case <-client.done:
+			case <-time.After(time.Second):
 			}
+			return
+
+		case <-client.done:
+			return
 		}
 	}
 }
@@ -243,7 +731,37 @@ func (s *Server) handleBinaryMessage(client *Client, data []byte) {
 		if errors.Is(err, protocol.ErrLoopbackDetected) {
 			return
 		}
-		s.log("ERROR", fmt.Sprintf("解析二进制消息失败: %v", err))
+		origin, ok := protocol.HeaderOrigin(data)
+		if ok && errors.Is(err, protocol.ErrChecksumMismatch) {
+			s.discardCorrupt(client, origin.MsgID)
+			// 错误消息本身损坏时只记录，不再回复
+			if msgType, _ := protocol.HeaderType(data); msgType == protocol.TypeError {
+				s.log("WARNING", fmt.Sprintf("客户端 %s 的错误消息校验失败: %v", s.displayName(client), err))
+				return
+			}
+			s.rejectItem(client, origin, err)
+			return
+		}
+		s.logProtocol("ERROR", fmt.Sprintf("解析二进制消息失败: %v", err))
+		client.stats.recordParseError()
+		if ok && errors.Is(err, protocol.ErrMetaParseFailed) {
+			s.sendError(client, protocol.ErrorCodeBadMeta, origin, err.Error())
+		}
+		return
+	}
+
+	client.mu.RLock()
+	state := client.state
+	client.mu.RUnlock()
+	switch {
+	case state == clientBlocked:
+		// 已屏蔽的设备在连接关闭前发来的消息一律忽略
+		return
+	case state == clientPending && msg.Type != protocol.TypeHandshake && msg.Type != protocol.TypeHeartbeat:
+		s.logProtocol("WARNING", fmt.Sprintf("客户端 %s 未握手就发送消息（类型 0x%02X），已忽略", client.ID, msg.Type))
+		if msg.Type != protocol.TypeError {
+			s.sendError(client, protocol.ErrorCodeNotHandshaken, msg.Origin(), "")
+		}
 		return
 	}
 
@@ -255,9 +773,17 @@ func (s *Server) handleBinaryMessage(client *Client, data []byte) {
 	case protocol.TypeImage:
 		s.handleBinaryImage(client, msg)
 	case protocol.TypeHeartbeat:
-		// 心跳消息只需重置读取超时，无需特殊处理
+		// 心跳已在 readPump 中重置读取超时；带时间戳的请求原样回复，供客户端计算延迟
+		if kind, timestamp, ok := protocol.ParseHeartbeat(msg); ok && kind == protocol.HeartbeatPing {
+			if !client.enqueueControl(s.protocolMgr.CreateHeartbeatPong(timestamp)) {
+				client.stats.recordDropped(1)
+			}
+		}
+	case protocol.TypeError:
+		s.handlePeerError(client, msg)
 	default:
-		s.log("WARNING", fmt.Sprintf("未知的消息类型: 0x%02X", msg.Type))
+		s.logProtocol("WARNING", fmt.Sprintf("未知的消息类型: 0x%02X", msg.Type))
+		s.sendError(client, protocol.ErrorCodeUnsupportedType, msg.Origin(), fmt.Sprintf("0x%02X", msg.Type))
 	}
 }
 
@@ -265,16 +791,52 @@ func (s *Server) handleBinaryMessage(client *Client, data []byte) {
 func (s *Server) handleBinaryHandshake(client *Client, msg *protocol.BinaryMessage) {
 	meta, err := msg.GetHandshakeMeta()
 	if err != nil {
-		s.log("ERROR", fmt.Sprintf("解析握手消息失败: %v", err))
+		s.logProtocol("ERROR", fmt.Sprintf("解析握手消息失败: %v", err))
+		s.sendError(client, protocol.ErrorCodeBadHandshake, msg.Origin(), err.Error())
+		client.requestClose(websocket.ClosePolicyViolation, "invalid handshake")
 		return
 	}
 
+	deviceID := hex.EncodeToString(msg.SenderUUID)
+	blocked := s.isBlocked(deviceID)
+
 	client.mu.Lock()
 	client.DeviceName = meta.Name
 	client.Platform = meta.OS
+	client.DeviceID = deviceID
+	client.Arch = meta.Arch
+	client.OSVersion = meta.OSVersion
+	client.AppVersion = meta.AppVersion
+	client.DeviceClass = meta.DeviceClass
+	if blocked {
+		client.state = clientBlocked
+	} else {
+		client.state = clientReady
+	}
 	client.mu.Unlock()
 
-	s.log("SUCCESS", fmt.Sprintf("客户端握手成功: %s (%s) [协议 V1.%d]", meta.Name, meta.OS, meta.Ver%10))
+	if blocked {
+		s.log("WARNING", fmt.Sprintf("拒绝已屏蔽的设备: %s (%s)", meta.Name, deviceID))
+		client.requestClose(CloseBlocked, "")
+		return
+	}
+
+	// 回复握手，客户端收到后才补发离线期间的数据
+	s.mu.RLock()
+	device := s.device
+	s.mu.RUnlock()
+	if reply, err := s.protocolMgr.CreateDeviceHandshake(device); err == nil && !client.enqueueControl(reply) {
+		s.log("WARNING", fmt.Sprintf("发送队列已满，未能回复 %s 的握手", meta.Name))
+	}
+
+	platform := meta.OS
+	if meta.OSVersion != "" {
+		platform = meta.OSVersion
+	}
+	if meta.AppVersion != "" {
+		platform += ", NextPaste " + meta.AppVersion
+	}
+	s.log("SUCCESS", fmt.Sprintf("客户端握手成功: %s (%s) [协议 V1.%d]", meta.Name, platform, meta.Ver%10))
 }
 
 // handleBinaryText 处理文本消息（V1.1）
@@ -285,15 +847,26 @@ func (s *Server) handleBinaryText(client *Client, msg *protocol.BinaryMessage) {
 	deviceName := client.DeviceName
 	client.mu.RUnlock()
 
+	if limit := s.Limits().MaxItemSize; int64(len(text)) > limit {
+		s.rejectItem(client, msg.Origin(), &ItemTooLargeError{Size: int64(len(text)), Limit: limit})
+		return
+	}
+
 	s.log("INFO", fmt.Sprintf("收到文本数据 [%d 字符] 来自 %s", len(text), deviceName))
+	client.stats.recordReceived("text", len(text))
 
 	// 调用回调函数（通知 App 层写入本地剪贴板）
+	origin := msg.Origin()
+	if !s.seen.MarkNew(origin) {
+		s.log("INFO", fmt.Sprintf("忽略重复的文本数据 来自 %s", deviceName))
+		return
+	}
 	if s.clipboardCallback != nil {
-		s.clipboardCallback("text", []byte(text))
+		s.clipboardCallback("text", []byte(text), origin)
 	}
 
-	// 广播给其他客户端
-	s.broadcastContent("text", []byte(text), "", client.ID)
+	// 广播给其他客户端（保持原始来源）
+	s.broadcastContent("text", []byte(text), "", origin, client.ID)
 }
 
 // handleBinaryImage 处理图片消息（V1.1）
@@ -301,7 +874,9 @@ func (s *Server) handleBinaryImage(client *Client, msg *protocol.BinaryMessage)
 	var fullData []byte
 	var mime string
 	var deviceName string
-	var finished bool
+	var finished, cancelled, spilled bool
+	var rejectErr error
+	limits := s.Limits()
 
 	func() {
 		client.mu.Lock()
@@ -310,33 +885,49 @@ func (s *Server) handleBinaryImage(client *Client, msg *protocol.BinaryMessage)
 		deviceName = client.DeviceName
 
 		// 检查是否是分片消息
-		isPending := client.PendingBuffer != nil
+		isPending := client.pending != nil
 
 		// 如果包含元数据（首帧）
 		if (msg.Flags & protocol.FlagHasMeta) != 0 {
 			if isPending {
 				s.log("WARNING", fmt.Sprintf("客户端 %s 未完成上一次传输就开始新传输，丢弃旧数据", client.ID))
+				client.resetPending(TransferFailed)
 			}
 
-			// 初始化缓冲区
-			client.PendingMsgID = msg.MsgID
-			client.PendingMeta = msg.Meta
-
-			expectedSize := int(0)
+			// 初始化缓冲区：声明的大小超过限制或内存预算不足时立即拒绝
+			var declared int64
 			if msg.Meta != nil {
-				expectedSize = int(msg.Meta.Size)
+				declared = msg.Meta.Size
 			}
-			// 限制预分配大小，防止 OOM
-			if expectedSize > 100*1024*1024 {
-				expectedSize = 100 * 1024 * 1024
+			pending, err := newReassembly(limits, &s.buffered, &s.spilled, declared)
+			if err != nil {
+				rejectErr = err
+				return
 			}
-			client.PendingBuffer = make([]byte, 0, expectedSize)
+			client.PendingMsgID = msg.MsgID
+			client.PendingMeta = msg.Meta
+			client.pending = pending
 
 			// 追加数据（BinaryData 是剥离元数据后的）
+			chunk := msg.Payload
 			if msg.BinaryData != nil {
-				client.PendingBuffer = append(client.PendingBuffer, msg.BinaryData...)
-			} else {
-				client.PendingBuffer = append(client.PendingBuffer, msg.Payload...)
+				chunk = msg.BinaryData
+			}
+			if err := client.pending.write(chunk); err != nil {
+				client.resetPending(TransferFailed)
+				rejectErr = err
+				return
+			}
+
+			// 多分片传输记录接收进度
+			if (msg.Flags & protocol.FlagMF) != 0 {
+				var mime string
+				var total int64
+				if msg.Meta != nil {
+					mime, total = msg.Meta.Mime, msg.Meta.Size
+				}
+				client.PendingTransfer = s.transfers.Begin(TransferReceive, client.peerName(), "image", mime, total)
+				client.PendingTransfer.Add(len(chunk))
 			}
 		} else {
 			// 后续分片
@@ -344,11 +935,21 @@ func (s *Server) handleBinaryImage(client *Client, msg *protocol.BinaryMessage)
 				return
 			}
 			if msg.MsgID != client.PendingMsgID {
-				client.PendingBuffer = nil
-				client.PendingMeta = nil
+				client.resetPending(TransferFailed)
+				return
+			}
+			if client.PendingTransfer.Cancelled() {
+				// 已取消：丢弃已收到的数据，剩余分片因没有进行中的传输而被忽略
+				client.resetPending(TransferCancelled)
+				cancelled = true
 				return
 			}
-			client.PendingBuffer = append(client.PendingBuffer, msg.Payload...)
+			if err := client.pending.write(msg.Payload); err != nil {
+				client.resetPending(TransferFailed)
+				rejectErr = err
+				return
+			}
+			client.PendingTransfer.Add(len(msg.Payload))
 		}
 
 		// 检查是否还有后续分片
@@ -356,40 +957,87 @@ func (s *Server) handleBinaryImage(client *Client, msg *protocol.BinaryMessage)
 			return
 		}
 
-		// 传输完成
-		fullData = client.PendingBuffer
+		// 传输完成：与首帧元数据中的哈希比对，不一致时丢弃
+		data, err := client.pending.bytes()
+		if err == nil {
+			err = protocol.VerifyContentHash(client.PendingMeta, data)
+		}
+		if err != nil {
+			client.resetPending(TransferFailed)
+			rejectErr = err
+			return
+		}
+		fullData = data
+		spilled = client.pending.spilled()
 		mime = "image/png"
 		if client.PendingMeta != nil && client.PendingMeta.Mime != "" {
 			mime = client.PendingMeta.Mime
 		}
 
 		// 清理缓冲区
-		client.PendingBuffer = nil
-		client.PendingMeta = nil
+		client.resetPending(TransferCompleted)
 		finished = true
 	}()
 
+	if rejectErr != nil {
+		if errors.Is(rejectErr, protocol.ErrHashMismatch) {
+			client.stats.recordCorrupt()
+		}
+		s.rejectItem(client, msg.Origin(), rejectErr)
+		return
+	}
+	if cancelled {
+		s.log("INFO", fmt.Sprintf("已取消接收来自 %s 的图片数据", deviceName))
+		return
+	}
 	if finished {
 		sizeMB := float64(len(fullData)) / 1024 / 1024
-		s.log("INFO", fmt.Sprintf("收到完整图片数据 [%.2f MB] 来自 %s", sizeMB, deviceName))
+		if spilled {
+			s.log("INFO", fmt.Sprintf("收到完整图片数据 [%.2f MB，经临时文件重组] 来自 %s", sizeMB, deviceName))
+		} else {
+			s.log("INFO", fmt.Sprintf("收到完整图片数据 [%.2f MB] 来自 %s", sizeMB, deviceName))
+		}
+		client.stats.recordReceived("image", len(fullData))
 
 		// 调用回调函数
+		origin := msg.Origin()
+		if !s.seen.MarkNew(origin) {
+			s.log("INFO", fmt.Sprintf("忽略重复的图片数据 来自 %s", deviceName))
+			return
+		}
 		if s.clipboardCallback != nil {
-			s.clipboardCallback("image", fullData)
+			s.clipboardCallback("image", fullData, origin)
 		}
 
-		// 广播给其他客户端
-		s.broadcastContent("image", fullData, mime, client.ID)
+		// 广播给其他客户端（保持原始来源）
+		s.broadcastContent("image", fullData, mime, origin, client.ID)
+	}
+}
+
+// discardCorrupt 丢弃校验失败的帧所属的条目：正在重组时放弃已收到的数据，剩余分片随之被忽略
+func (s *Server) discardCorrupt(client *Client, msgID uint32) {
+	client.stats.recordCorrupt()
+
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	if client.pending != nil && client.PendingMsgID == msgID {
+		client.resetPending(TransferFailed)
 	}
 }
 
 // broadcastContent 广播内容（通用方法，支持分片）
-func (s *Server) broadcastContent(dataType string, content []byte, mime string, excludeID string) error {
+// origin 为空时视为本机新产生的条目
+func (s *Server) broadcastContent(dataType string, content []byte, mime string, origin protocol.Origin, excludeID string) error {
+	if origin.IsZero() {
+		origin = s.protocolMgr.NewOrigin()
+	}
+	s.seen.MarkNew(origin)
+
 	var msgs [][]byte
 
 	switch dataType {
 	case "text":
-		msg, err := s.protocolMgr.CreateText(string(content))
+		msg, err := s.protocolMgr.CreateTextFrom(origin, string(content))
 		if err != nil {
 			return err
 		}
@@ -398,7 +1046,7 @@ func (s *Server) broadcastContent(dataType string, content []byte, mime string,
 		if mime == "" {
 			mime = "image/png"
 		}
-		chunks, err := s.protocolMgr.CreateImageChunks(content, mime, 64*1024)
+		chunks, err := s.protocolMgr.CreateImageChunksFrom(origin, content, mime, 64*1024)
 		if err != nil {
 			return err
 		}
@@ -407,20 +1055,22 @@ func (s *Server) broadcastContent(dataType string, content []byte, mime string,
 		return fmt.Errorf("不支持的数据类型: %s", dataType)
 	}
 
+	// 所有客户端共用同一组分片，条目整体入队
+	item := outItem{dataType: dataType, mime: mime, size: len(content)}
+	sizes := chunkDataSizes(msgs, len(content))
+	for i, msg := range msgs {
+		item.frames = append(item.frames, outFrame{data: msg, bytes: sizes[i]})
+	}
+
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
 	for id, client := range s.clients {
-		if id == excludeID {
+		// 未完成握手的客户端不接收剪贴板内容
+		if id == excludeID || !client.isReady() {
 			continue
 		}
-		for _, msg := range msgs {
-			select {
-			case client.Send <- msg:
-			default:
-				s.log("WARNING", fmt.Sprintf("客户端 %s 发送队列已满", id))
-			}
-		}
+		s.deliver(client, item, s.slowConsumer)
 	}
 	return nil
 }
@@ -428,7 +1078,23 @@ func (s *Server) broadcastContent(dataType string, content []byte, mime string,
 // BroadcastClipboardBinary 广播剪贴板数据（V1.1 二进制协议）
 func (s *Server) BroadcastClipboardBinary(dataType string, content []byte) error {
 	s.log("INFO", fmt.Sprintf("广播剪贴板数据: %s", dataType))
-	return s.broadcastContent(dataType, content, "", "")
+	return s.broadcastContent(dataType, content, "", protocol.Origin{}, "")
+}
+
+// BroadcastItem 以指定来源广播条目（用于从其他连接转发，保持原始发送者与消息 ID）
+func (s *Server) BroadcastItem(dataType string, content []byte, origin protocol.Origin) error {
+	s.log("INFO", fmt.Sprintf("广播剪贴板数据: %s", dataType))
+	return s.broadcastContent(dataType, content, "", origin, "")
+}
+
+// DeviceUUID 服务器收发消息使用的设备 UUID
+func (s *Server) DeviceUUID() [16]byte {
+	return [16]byte(s.protocolMgr.GetDeviceUUID())
+}
+
+// NewOrigin 为本机新产生的条目分配来源
+func (s *Server) NewOrigin() protocol.Origin {
+	return s.protocolMgr.NewOrigin()
 }
 
 // BroadcastClipboard 广播剪贴板数据（兼容旧接口，内部将 Base64 转为二进制）
@@ -456,9 +1122,10 @@ func (s *Server) removeClient(client *Client) {
 
 	if _, ok := s.clients[client.ID]; ok {
 		delete(s.clients, client.ID)
-		client.mu.RLock()
-		deviceName := client.DeviceName
-		client.mu.RUnlock()
+		client.mu.Lock()
+		deviceName := client.peerName()
+		client.resetPending(TransferFailed)
+		client.mu.Unlock()
 		s.log("INFO", fmt.Sprintf("客户端断开: %s", deviceName))
 	}
 }
@@ -475,20 +1142,100 @@ func (s *Server) GetClients() []map[string]interface{} {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	clients := make([]map[string]interface{}, 0, len(s.clients))
+	// 按连接时间排序，界面列表顺序稳定
+	sorted := make([]*Client, 0, len(s.clients))
 	for _, client := range s.clients {
+		sorted = append(sorted, client)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].ConnTime.Before(sorted[j].ConnTime)
+	})
+
+	clients := make([]map[string]interface{}, 0, len(sorted))
+	for _, client := range sorted {
 		client.mu.RLock()
 		clients = append(clients, map[string]interface{}{
-			"id":         client.ID,
-			"deviceName": client.DeviceName,
-			"platform":   client.Platform,
-			"connTime":   client.ConnTime.Format("2006-01-02 15:04:05"),
+			"id":          client.ID,
+			"deviceId":    client.DeviceID,
+			"alias":       s.deviceAliases[client.DeviceID],
+			"deviceName":  client.DeviceName,
+			"platform":    client.Platform,
+			"arch":        client.Arch,
+			"osVersion":   client.OSVersion,
+			"appVersion":  client.AppVersion,
+			"deviceClass": client.DeviceClass,
+			"connTime":    client.ConnTime.Format("2006-01-02 15:04:05"),
 		})
 		client.mu.RUnlock()
 	}
 	return clients
 }
 
+// ClientStatistics 连接到本机服务器的客户端的同步统计
+type ClientStatistics struct {
+	ID           string        `json:"id"`
+	DeviceName   string        `json:"deviceName"`
+	ConnectedSec int64         `json:"connectedSec"`
+	Stats        StatsSnapshot `json:"stats"`
+}
+
+// ServerStatistics 本机服务器的同步统计
+type ServerStatistics struct {
+	Running   bool               `json:"running"`
+	UptimeSec int64              `json:"uptimeSec"` // 本次启动以来的运行时间，未运行时为 0
+	Totals    StatsSnapshot      `json:"totals"`    // 所有客户端（含已断开的）合计
+	Clients   []ClientStatistics `json:"clients"`   // 当前连接的客户端，按连接时间排序
+}
+
+// Stats 服务器的同步统计计数（所有客户端合计）
+func (s *Server) Stats() *Stats {
+	return s.stats
+}
+
+// Statistics 获取服务器与各客户端的同步统计
+func (s *Server) Statistics() ServerStatistics {
+	s.mu.RLock()
+	stats := ServerStatistics{
+		Running: s.isRunning,
+		Totals:  s.stats.Snapshot(),
+		Clients: make([]ClientStatistics, 0, len(s.clients)),
+	}
+	if s.isRunning {
+		stats.UptimeSec = int64(time.Since(s.startedAt) / time.Second)
+	}
+	clients := make([]*Client, 0, len(s.clients))
+	for _, client := range s.clients {
+		clients = append(clients, client)
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(clients, func(i, j int) bool {
+		return clients[i].ConnTime.Before(clients[j].ConnTime)
+	})
+	for _, client := range clients {
+		client.mu.RLock()
+		name := client.DeviceName
+		client.mu.RUnlock()
+		stats.Clients = append(stats.Clients, ClientStatistics{
+			ID:           client.ID,
+			DeviceName:   name,
+			ConnectedSec: int64(time.Since(client.ConnTime) / time.Second),
+			Stats:        client.stats.Snapshot(),
+		})
+	}
+	return stats
+}
+
+// ResetStats 清零服务器与当前各客户端的同步统计
+func (s *Server) ResetStats() {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	s.stats.Reset()
+	for _, client := range s.clients {
+		client.stats.Reset()
+	}
+}
+
 // IsRunning 检查服务器是否运行中
 func (s *Server) IsRunning() bool {
 	s.mu.RLock()
@@ -543,3 +1290,17 @@ func (s *Server) log(level, message string) {
 		log.Printf("[%s] %s", level, message)
 	}
 }
+
+// SetProtocolLogCallback 设置协议层日志回调，需在 Start 之前调用
+func (s *Server) SetProtocolLogCallback(cb LogCallback) {
+	s.protocolLogCb = cb
+}
+
+// logProtocol 记录协议层日志
+func (s *Server) logProtocol(level, message string) {
+	if s.protocolLogCb != nil {
+		s.protocolLogCb(level, message)
+		return
+	}
+	s.log(level, message)
+}
@@ -0,0 +1,162 @@
+package websocket
+
+import (
+	"sync"
+	"time"
+)
+
+// ==========================================
+// 同步统计
+// ==========================================
+//
+// 每个连接（服务器端的客户端、出站客户端）各有一份计数，记录时同时累加到
+// 上级计数：服务器端客户端 → 服务器 → 全局。连接断开后其计数已计入上级，
+// 全局统计不会因连接减少而变小。
+
+// TrafficStats 按类型统计的条目数与字节数（剪贴板内容大小，不含协议头）
+type TrafficStats struct {
+	TextItems  int64 `json:"textItems"`
+	TextBytes  int64 `json:"textBytes"`
+	ImageItems int64 `json:"imageItems"`
+	ImageBytes int64 `json:"imageBytes"`
+}
+
+// add 累加一个条目
+func (t *TrafficStats) add(dataType string, size int) {
+	switch dataType {
+	case "text":
+		t.TextItems++
+		t.TextBytes += int64(size)
+	case "image":
+		t.ImageItems++
+		t.ImageBytes += int64(size)
+	}
+}
+
+// StatsSnapshot 统计快照
+type StatsSnapshot struct {
+	Sent           TrafficStats `json:"sent"`
+	Received       TrafficStats `json:"received"`
+	Dropped        int64        `json:"dropped"`        // 发送队列已满（整条丢弃）或离线队列溢出而丢弃的消息
+	ParseErrors    int64        `json:"parseErrors"`    // 无法解析的消息
+	Corrupt        int64        `json:"corrupt"`        // 帧校验或内容哈希不匹配而丢弃的条目
+	Coalesced      int64        `json:"coalesced"`      // latest 策略下被更新条目替换而未发送的条目
+	SlowDisconnect int64        `json:"slowDisconnect"` // 因持续接收过慢而被断开的次数
+	LastActivity   int64        `json:"lastActivity"`   // 最后一次收发条目的时间（毫秒时间戳），没有时为 0
+	AvgLatencyMs   float64      `json:"avgLatencyMs"`   // 心跳往返延迟平均值，没有样本时为 0
+	LatencySamples int64        `json:"latencySamples"` // 延迟样本数
+	Since          int64        `json:"since"`          // 开始统计（或上次重置）的时间（毫秒时间戳）
+}
+
+// Stats 同步统计计数
+type Stats struct {
+	snapshot     StatsSnapshot
+	latencyTotal time.Duration
+	parent       *Stats
+	mu           sync.Mutex
+}
+
+// NewStats 创建统计计数
+func NewStats() *Stats {
+	return &Stats{snapshot: StatsSnapshot{Since: time.Now().UnixMilli()}}
+}
+
+// SetParent 设置上级计数，之后的记录同时累加到上级
+func (s *Stats) SetParent(parent *Stats) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.parent = parent
+}
+
+// update 在锁内修改本级计数，再逐级修改上级计数
+func (s *Stats) update(fn func(s *Stats)) {
+	for stats := s; stats != nil; {
+		stats.mu.Lock()
+		fn(stats)
+		parent := stats.parent
+		stats.mu.Unlock()
+		stats = parent
+	}
+}
+
+// recordSent 记录发出的条目
+func (s *Stats) recordSent(dataType string, size int) {
+	now := time.Now().UnixMilli()
+	s.update(func(s *Stats) {
+		s.snapshot.Sent.add(dataType, size)
+		s.snapshot.LastActivity = now
+	})
+}
+
+// recordReceived 记录收到的条目
+func (s *Stats) recordReceived(dataType string, size int) {
+	now := time.Now().UnixMilli()
+	s.update(func(s *Stats) {
+		s.snapshot.Received.add(dataType, size)
+		s.snapshot.LastActivity = now
+	})
+}
+
+// recordDropped 记录丢弃的消息
+func (s *Stats) recordDropped(n int) {
+	s.update(func(s *Stats) {
+		s.snapshot.Dropped += int64(n)
+	})
+}
+
+// recordCoalesced 记录被更新条目替换而未发送的条目
+func (s *Stats) recordCoalesced(n int) {
+	s.update(func(s *Stats) {
+		s.snapshot.Coalesced += int64(n)
+	})
+}
+
+// recordSlowDisconnect 记录一次因接收过慢而断开连接
+func (s *Stats) recordSlowDisconnect() {
+	s.update(func(s *Stats) {
+		s.snapshot.SlowDisconnect++
+	})
+}
+
+// recordParseError 记录无法解析的消息
+func (s *Stats) recordParseError() {
+	s.update(func(s *Stats) {
+		s.snapshot.ParseErrors++
+	})
+}
+
+// recordCorrupt 记录校验失败而丢弃的条目
+func (s *Stats) recordCorrupt() {
+	s.update(func(s *Stats) {
+		s.snapshot.Corrupt++
+	})
+}
+
+// recordLatency 记录一次心跳往返延迟
+func (s *Stats) recordLatency(rtt time.Duration) {
+	s.update(func(s *Stats) {
+		s.latencyTotal += rtt
+		s.snapshot.LatencySamples++
+	})
+}
+
+// Snapshot 获取统计快照
+func (s *Stats) Snapshot() StatsSnapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snapshot := s.snapshot
+	if snapshot.LatencySamples > 0 {
+		avg := s.latencyTotal / time.Duration(snapshot.LatencySamples)
+		snapshot.AvgLatencyMs = float64(avg) / float64(time.Millisecond)
+	}
+	return snapshot
+}
+
+// Reset 清零本级计数（不影响上级）
+func (s *Stats) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.snapshot = StatsSnapshot{Since: time.Now().UnixMilli()}
+	s.latencyTotal = 0
+}
@@ -0,0 +1,264 @@
+package websocket
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"server/internal/protocol"
+)
+
+// ==========================================
+// 传输进度
+// ==========================================
+//
+// 图片等大条目以分片形式收发。每次分片传输登记为一个 Transfer，
+// 发送方在每个分片写出后、接收方在每个分片到达后累加字节数；进度
+// 通过回调节流推送（开始、结束各推送一次，中间至多每 progressInterval 一次）。
+// 取消传输后发送方停止写出剩余分片，接收方丢弃已收到的数据。
+
+// progressInterval 进度回调的最小间隔
+const progressInterval = 200 * time.Millisecond
+
+// 传输方向
+const (
+	TransferSend    = "send"
+	TransferReceive = "receive"
+)
+
+// 传输状态
+const (
+	TransferActive    = "active"
+	TransferCompleted = "completed"
+	TransferCancelled = "cancelled"
+	TransferFailed    = "failed"
+)
+
+// TransferProgress 传输进度快照
+type TransferProgress struct {
+	ID          string  `json:"id"`
+	Direction   string  `json:"direction"` // send / receive
+	Peer        string  `json:"peer"`      // 对端设备名称或地址
+	DataType    string  `json:"dataType"`
+	Mime        string  `json:"mime"`
+	BytesDone   int64   `json:"bytesDone"`
+	Total       int64   `json:"total"` // 来自 TransferMeta.Size，未知时为 0
+	BytesPerSec float64 `json:"bytesPerSec"`
+	EtaMs       int64   `json:"etaMs"` // 预计剩余时间，无法估计时为 -1
+	StartedAt   int64   `json:"startedAt"`
+	State       string  `json:"state"`
+}
+
+// TransferCallback 传输进度回调
+type TransferCallback func(progress TransferProgress)
+
+// Transfer 一次进行中的分片传输
+type Transfer struct {
+	id        string
+	direction string
+	peer      string
+	dataType  string
+	mime      string
+	total     int64
+	startedAt time.Time
+	tracker   *TransferTracker
+
+	done      atomic.Int64
+	cancelled atomic.Bool
+	mu        sync.Mutex
+	state     string
+	lastEmit  time.Time
+}
+
+// TransferTracker 记录进行中的传输并推送进度
+type TransferTracker struct {
+	transfers map[string]*Transfer
+	nextID    uint64
+	callback  TransferCallback
+	mu        sync.Mutex
+}
+
+// NewTransferTracker 创建传输进度记录器
+func NewTransferTracker() *TransferTracker {
+	return &TransferTracker{
+		transfers: make(map[string]*Transfer),
+	}
+}
+
+// SetCallback 设置进度回调
+func (t *TransferTracker) SetCallback(cb TransferCallback) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.callback = cb
+}
+
+// Begin 登记一次新的传输；tracker 为 nil 时返回 nil，Transfer 的方法均可在 nil 上调用
+func (t *TransferTracker) Begin(direction, peer, dataType, mime string, total int64) *Transfer {
+	if t == nil {
+		return nil
+	}
+
+	t.mu.Lock()
+	t.nextID++
+	tr := &Transfer{
+		id:        fmt.Sprintf("t%d", t.nextID),
+		direction: direction,
+		peer:      peer,
+		dataType:  dataType,
+		mime:      mime,
+		total:     total,
+		startedAt: time.Now(),
+		tracker:   t,
+		state:     TransferActive,
+	}
+	t.transfers[tr.id] = tr
+	t.mu.Unlock()
+
+	tr.emit(true)
+	return tr
+}
+
+// Active 获取进行中的传输，按开始时间排序
+func (t *TransferTracker) Active() []TransferProgress {
+	t.mu.Lock()
+	transfers := make([]*Transfer, 0, len(t.transfers))
+	for _, tr := range t.transfers {
+		transfers = append(transfers, tr)
+	}
+	t.mu.Unlock()
+
+	sort.Slice(transfers, func(i, j int) bool {
+		return transfers[i].startedAt.Before(transfers[j].startedAt)
+	})
+	progress := make([]TransferProgress, 0, len(transfers))
+	for _, tr := range transfers {
+		progress = append(progress, tr.Progress())
+	}
+	return progress
+}
+
+// Cancel 取消进行中的传输
+func (t *TransferTracker) Cancel(id string) error {
+	t.mu.Lock()
+	tr := t.transfers[id]
+	t.mu.Unlock()
+
+	if tr == nil {
+		return fmt.Errorf("传输 %s 不存在或已结束", id)
+	}
+	tr.cancelled.Store(true)
+	tr.Finish(TransferCancelled)
+	return nil
+}
+
+// ID 传输 ID
+func (tr *Transfer) ID() string {
+	if tr == nil {
+		return ""
+	}
+	return tr.id
+}
+
+// Add 累加已传输的字节数
+func (tr *Transfer) Add(n int) {
+	if tr == nil {
+		return
+	}
+	tr.done.Add(int64(n))
+	tr.emit(false)
+}
+
+// Cancelled 传输是否已被取消
+func (tr *Transfer) Cancelled() bool {
+	return tr != nil && tr.cancelled.Load()
+}
+
+// Finish 结束传输（完成、取消或失败），重复调用时只有第一次生效
+func (tr *Transfer) Finish(state string) {
+	if tr == nil {
+		return
+	}
+
+	tr.mu.Lock()
+	if tr.state != TransferActive {
+		tr.mu.Unlock()
+		return
+	}
+	tr.state = state
+	tr.mu.Unlock()
+
+	tr.tracker.mu.Lock()
+	delete(tr.tracker.transfers, tr.id)
+	tr.tracker.mu.Unlock()
+
+	tr.emit(true)
+}
+
+// Progress 当前进度快照
+func (tr *Transfer) Progress() TransferProgress {
+	tr.mu.Lock()
+	state := tr.state
+	tr.mu.Unlock()
+
+	done := tr.done.Load()
+	p := TransferProgress{
+		ID:        tr.id,
+		Direction: tr.direction,
+		Peer:      tr.peer,
+		DataType:  tr.dataType,
+		Mime:      tr.mime,
+		BytesDone: done,
+		Total:     tr.total,
+		EtaMs:     -1,
+		StartedAt: tr.startedAt.UnixMilli(),
+		State:     state,
+	}
+
+	if elapsed := time.Since(tr.startedAt).Seconds(); elapsed > 0 && done > 0 {
+		p.BytesPerSec = float64(done) / elapsed
+		if tr.total >= done {
+			p.EtaMs = int64(float64(tr.total-done) / p.BytesPerSec * 1000)
+		}
+	}
+	if state == TransferCompleted {
+		p.EtaMs = 0
+	}
+	return p
+}
+
+// emit 推送进度，force 为 false 时按 progressInterval 节流
+func (tr *Transfer) emit(force bool) {
+	now := time.Now()
+	tr.mu.Lock()
+	if !force && (tr.state != TransferActive || now.Sub(tr.lastEmit) < progressInterval) {
+		tr.mu.Unlock()
+		return
+	}
+	tr.lastEmit = now
+	tr.mu.Unlock()
+
+	tr.tracker.mu.Lock()
+	cb := tr.tracker.callback
+	tr.tracker.mu.Unlock()
+	if cb != nil {
+		cb(tr.Progress())
+	}
+}
+
+// chunkDataSizes 各分片帧携带的数据字节数（首帧扣除元数据），用于累加传输进度
+// 后续分片按头部中的 Payload 长度计算，不含帧校验
+func chunkDataSizes(chunks [][]byte, total int) []int {
+	sizes := make([]int, len(chunks))
+	rest := total
+	for i := len(chunks) - 1; i > 0; i-- {
+		n, _ := protocol.HeaderPayloadLen(chunks[i])
+		sizes[i] = int(n)
+		rest -= sizes[i]
+	}
+	if len(chunks) > 0 {
+		sizes[0] = rest
+	}
+	return sizes
+}
@@ -0,0 +1,35 @@
+package websocket
+
+import (
+	"testing"
+
+	"server/internal/protocol"
+)
+
+func TestChunkDataSizesExcludesChecksum(t *testing.T) {
+	protocol.SetFrameChecksum(true)
+	sender := protocol.NewBinaryProtocolManagerWithUUID([16]byte{1})
+	receiver := protocol.NewBinaryProtocolManagerWithUUID([16]byte{2})
+
+	image := make([]byte, 10000)
+	chunks, err := sender.CreateImageChunksFrom(sender.NewOrigin(), image, "image/png", 1024)
+	if err != nil {
+		t.Fatalf("CreateImageChunksFrom: %v", err)
+	}
+
+	// 与接收方解析出的数据字节数逐帧一致
+	sizes := chunkDataSizes(chunks, len(image))
+	for i, chunk := range chunks {
+		msg, err := receiver.Parse(chunk)
+		if err != nil {
+			t.Fatalf("解析第 %d 帧: %v", i, err)
+		}
+		want := len(msg.Payload)
+		if msg.Flags&protocol.FlagHasMeta != 0 {
+			want = len(msg.BinaryData)
+		}
+		if sizes[i] != want {
+			t.Errorf("第 %d 帧数据字节数 = %d，期望 %d", i, sizes[i], want)
+		}
+	}
+}
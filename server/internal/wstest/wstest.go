@@ -0,0 +1,426 @@
+// Package wstest 集成测试工具：在本进程内启动 WebSocket 服务器与多个客户端，
+// 以假剪贴板记录各端收到的条目。
+//
+// 每个服务器与客户端创建时注入各自的设备 UUID（同一 UUID 的消息会被当作回环丢弃），
+// 使它们像不同的设备一样互相通信；不修改进程的本机设备 UUID，测试可以并行运行。
+package wstest
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"server/internal/protocol"
+	ws "server/internal/websocket"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+// Timeout 等待异步结果的默认期限
+const Timeout = 5 * time.Second
+
+// ==========================================
+// 假剪贴板
+// ==========================================
+
+// Item 写入剪贴板的一个条目
+type Item struct {
+	Type    string
+	Content []byte
+	Origin  protocol.Origin // 通过 WriteLocal 写入时为空
+}
+
+// Clipboard 记录写入的条目，代替系统剪贴板
+type Clipboard struct {
+	items   []Item
+	changed chan struct{} // 每次写入后关闭并替换，用于唤醒等待者
+	mu      sync.Mutex
+}
+
+// NewClipboard 创建空的假剪贴板
+func NewClipboard() *Clipboard {
+	return &Clipboard{changed: make(chan struct{})}
+}
+
+// Write 写入条目，可直接用作 websocket.BinaryClipboardCallback
+func (c *Clipboard) Write(dataType string, content []byte, origin protocol.Origin) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.items = append(c.items, Item{Type: dataType, Content: bytes.Clone(content), Origin: origin})
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+// WriteLocal 写入条目，可直接用作 hub.LocalCallback
+func (c *Clipboard) WriteLocal(dataType string, content []byte) {
+	c.Write(dataType, content, protocol.Origin{})
+}
+
+// Items 已写入的全部条目
+func (c *Clipboard) Items() []Item {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Item(nil), c.items...)
+}
+
+// Len 已写入的条目数
+func (c *Clipboard) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.items)
+}
+
+// WaitFor 等待写入指定内容的条目，超时则测试失败
+func (c *Clipboard) WaitFor(t testing.TB, dataType string, content []byte) Item {
+	t.Helper()
+	deadline := time.NewTimer(Timeout)
+	defer deadline.Stop()
+	for {
+		c.mu.Lock()
+		for _, item := range c.items {
+			if item.Type == dataType && bytes.Equal(item.Content, content) {
+				c.mu.Unlock()
+				return item
+			}
+		}
+		changed := c.changed
+		n := len(c.items)
+		c.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-deadline.C:
+			t.Fatalf("等待剪贴板写入 %s 条目（%d 字节）超时，已有 %d 个条目", dataType, len(content), n)
+		}
+	}
+}
+
+// Consistently 在 d 时间内剪贴板始终只有 n 个条目，用于确认不会收到某个条目
+func (c *Clipboard) Consistently(t testing.TB, n int, d time.Duration) {
+	t.Helper()
+	time.Sleep(d)
+	if got := c.Len(); got != n {
+		t.Fatalf("剪贴板有 %d 个条目，期望 %d 个: %s", got, n, describe(c.Items()))
+	}
+}
+
+// describe 条目列表的简要说明，用于失败信息
+func describe(items []Item) string {
+	parts := make([]string, 0, len(items))
+	for _, item := range items {
+		parts = append(parts, fmt.Sprintf("%s(%d)", item.Type, len(item.Content)))
+	}
+	return "[" + strings.Join(parts, " ") + "]"
+}
+
+// ==========================================
+// 日志
+// ==========================================
+
+// Log 收集日志，测试失败时输出；测试结束后仍在运行的协程写入日志也不会出错
+type Log struct {
+	lines []string
+	mu    sync.Mutex
+}
+
+// NewLog 创建日志收集器，测试失败时输出收集到的日志
+func NewLog(t testing.TB) *Log {
+	l := &Log{}
+	t.Cleanup(func() {
+		if t.Failed() {
+			for _, line := range l.Lines() {
+				t.Log(line)
+			}
+		}
+	})
+	return l
+}
+
+// Callback 带名称前缀的日志回调
+func (l *Log) Callback(name string) ws.LogCallback {
+	return func(level, message string) {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		l.lines = append(l.lines, fmt.Sprintf("%s [%s] %s %s", time.Now().Format("15:04:05.000"), name, level, message))
+	}
+}
+
+// Lines 已收集的日志
+func (l *Log) Lines() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.lines...)
+}
+
+// ==========================================
+// 服务器与客户端
+// ==========================================
+
+// Server 在随机端口上运行的服务器，收到的条目写入 Clipboard
+type Server struct {
+	*ws.Server
+	UUID      [16]byte // 服务器的设备 UUID
+	Clipboard *Clipboard
+	addr      string
+	log       *Log
+	t         testing.TB
+}
+
+// NewServer 以新的设备 UUID 创建服务器并在 127.0.0.1 的随机端口上启动，测试结束时停止
+func NewServer(t testing.TB, log *Log) *Server {
+	t.Helper()
+	id := [16]byte(uuid.New())
+	s := &Server{Server: ws.NewServerWithUUID(id), UUID: id, Clipboard: NewClipboard(), addr: "127.0.0.1:0", log: log, t: t}
+	s.SetClipboardCallback(s.Clipboard.Write)
+	s.SetDrainOptions(time.Second, 0)
+	s.Resume()
+	s.addr = s.Addr().String()
+	t.Cleanup(func() { s.Stop() })
+	return s
+}
+
+// URL 客户端连接地址（服务器停止期间仍然有效）
+func (s *Server) URL() string {
+	return "ws://" + s.addr + "/ws"
+}
+
+// Resume 在原地址启动服务器（用于 Stop 之后模拟服务器恢复）
+func (s *Server) Resume() {
+	s.t.Helper()
+	ln, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		s.t.Fatalf("监听 %s 失败: %v", s.addr, err)
+	}
+	if err := s.StartListener(ln, s.log.Callback("server")); err != nil {
+		s.t.Fatalf("启动服务器失败: %v", err)
+	}
+}
+
+// Restart 停止服务器后在原地址重新启动，已连接的客户端需重连
+func (s *Server) Restart() {
+	s.t.Helper()
+	if err := s.Stop(); err != nil {
+		s.t.Fatalf("停止服务器失败: %v", err)
+	}
+	s.Resume()
+}
+
+// WaitForClient 等待服务器完成与指定设备的握手（之后广播才会发给该客户端）
+func (s *Server) WaitForClient(name string) {
+	s.t.Helper()
+	Eventually(s.t, func() bool { return s.clientID(name) != "" }, "服务器等待客户端 %s 握手", name)
+}
+
+// WaitForClientGone 等待服务器移除指定设备的连接
+func (s *Server) WaitForClientGone(name string) {
+	s.t.Helper()
+	Eventually(s.t, func() bool { return s.clientID(name) == "" }, "服务器等待客户端 %s 断开", name)
+}
+
+// ClientID 已握手的指定设备的连接 ID
+func (s *Server) ClientID(name string) string {
+	s.t.Helper()
+	id := s.clientID(name)
+	if id == "" {
+		s.t.Fatalf("服务器上没有客户端 %s", name)
+	}
+	return id
+}
+
+// clientID 按设备名称查找连接 ID，没有时返回空
+func (s *Server) clientID(name string) string {
+	for _, client := range s.GetClients() {
+		if client["deviceName"] == name {
+			id, _ := client["id"].(string)
+			return id
+		}
+	}
+	return ""
+}
+
+// Client 连接到测试服务器的客户端，收到的条目写入 Clipboard
+type Client struct {
+	*ws.WSClient
+	UUID      [16]byte // 客户端的设备 UUID
+	Name      string
+	Clipboard *Clipboard
+	t         testing.TB
+}
+
+// FastReconnect 测试使用的重连策略：快速重试，不限次数
+var FastReconnect = ws.ReconnectPolicy{
+	InitialDelay: 50 * time.Millisecond,
+	MaxDelay:     200 * time.Millisecond,
+	Multiplier:   2,
+}
+
+// NewClient 以新的设备 UUID 创建客户端（未连接），测试结束时断开
+func NewClient(t testing.TB, name string) *Client {
+	t.Helper()
+	id := [16]byte(uuid.New())
+	c := &Client{
+		WSClient:  ws.NewWSClientWithUUID(protocol.DeviceInfo{Name: name, OS: "test"}, id),
+		UUID:      id,
+		Name:      name,
+		Clipboard: NewClipboard(),
+		t:         t,
+	}
+	c.SetClipboardCallback(c.Clipboard.Write)
+	c.SetReconnectPolicy(FastReconnect)
+	t.Cleanup(func() { c.Disconnect() })
+	return c
+}
+
+// Dial 创建客户端并连接到服务器，等待双方完成握手
+func Dial(t testing.TB, s *Server, name string, log *Log) *Client {
+	t.Helper()
+	c := NewClient(t, name)
+	if err := c.Connect(s.URL(), log.Callback(name)); err != nil {
+		t.Fatalf("%s 连接失败: %v", name, err)
+	}
+	c.WaitConnected()
+	s.WaitForClient(name)
+	return c
+}
+
+// WaitConnected 等待客户端连接成功
+func (c *Client) WaitConnected() {
+	c.t.Helper()
+	Eventually(c.t, c.IsConnected, "%s 等待连接", c.Name)
+}
+
+// WaitState 等待客户端进入指定连接状态
+func (c *Client) WaitState(state ws.ConnectionState) {
+	c.t.Helper()
+	if !poll(func() bool { return c.State() == state }) {
+		c.t.Fatalf("超时: %s 等待状态 %s（当前 %s）", c.Name, state, c.State())
+	}
+}
+
+// ==========================================
+// 中继
+// ==========================================
+
+// Relay 简化的中继服务器：只有一个房间，把每个连接发来的消息原样转发给其他所有连接，
+// 不回复握手，也不解析消息内容
+type Relay struct {
+	srv   *httptest.Server
+	conns map[*relayConn]bool
+	mu    sync.Mutex
+	t     testing.TB
+}
+
+// relayConn 中继上的一个连接，写入需要加锁
+type relayConn struct {
+	conn *websocket.Conn
+	mu   sync.Mutex
+}
+
+// NewRelay 在随机端口上启动中继，测试结束时关闭
+func NewRelay(t testing.TB) *Relay {
+	t.Helper()
+	r := &Relay{conns: make(map[*relayConn]bool), t: t}
+	r.srv = httptest.NewServer(http.HandlerFunc(r.serve))
+	t.Cleanup(func() {
+		r.srv.CloseClientConnections()
+		r.srv.Close()
+	})
+	return r
+}
+
+// URL 房间的 WebSocket 地址
+func (r *Relay) URL() string {
+	return "ws" + strings.TrimPrefix(r.srv.URL, "http") + "/v2/ws/test-room"
+}
+
+// Dial 以新的设备 UUID 连接到中继，等待中继登记该连接
+func (r *Relay) Dial(name string, log *Log) *Client {
+	r.t.Helper()
+	n := r.Conns()
+	c := NewClient(r.t, name)
+	if err := c.Connect(r.URL(), log.Callback(name)); err != nil {
+		r.t.Fatalf("%s 连接中继失败: %v", name, err)
+	}
+	c.WaitConnected()
+	r.WaitForConns(n + 1)
+	return c
+}
+
+// Conns 中继上的连接数
+func (r *Relay) Conns() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.conns)
+}
+
+// WaitForConns 等待中继上至少有 n 个连接
+func (r *Relay) WaitForConns(n int) {
+	r.t.Helper()
+	Eventually(r.t, func() bool { return r.Conns() >= n }, "中继等待 %d 个连接", n)
+}
+
+// serve 转发一个连接发来的所有消息
+func (r *Relay) serve(w http.ResponseWriter, req *http.Request) {
+	conn, err := (&websocket.Upgrader{}).Upgrade(w, req, nil)
+	if err != nil {
+		return
+	}
+	self := &relayConn{conn: conn}
+	r.mu.Lock()
+	r.conns[self] = true
+	r.mu.Unlock()
+	defer func() {
+		r.mu.Lock()
+		delete(r.conns, self)
+		r.mu.Unlock()
+		conn.Close()
+	}()
+
+	for {
+		msgType, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		r.mu.Lock()
+		peers := make([]*relayConn, 0, len(r.conns))
+		for peer := range r.conns {
+			if peer != self {
+				peers = append(peers, peer)
+			}
+		}
+		r.mu.Unlock()
+		for _, peer := range peers {
+			peer.mu.Lock()
+			peer.conn.SetWriteDeadline(time.Now().Add(Timeout))
+			peer.conn.WriteMessage(msgType, data)
+			peer.mu.Unlock()
+		}
+	}
+}
+
+// Eventually 轮询等待条件成立，超时则测试失败
+func Eventually(t testing.TB, cond func() bool, format string, args ...any) {
+	t.Helper()
+	if !poll(cond) {
+		t.Fatalf("超时: "+format, args...)
+	}
+}
+
+// poll 在 Timeout 内轮询条件，返回条件是否成立
+func poll(cond func() bool) bool {
+	deadline := time.Now().Add(Timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return true
+}
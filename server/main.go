@@ -11,6 +11,9 @@ import (
 //go:embed all:frontend/dist
 var assets embed.FS
 
+// appVersion 应用版本，构建时通过 -ldflags "-X main.appVersion=x.y.z" 注入
+var appVersion = "dev"
+
 func main() {
 	// 创建应用实例
 	app := NewApp()